@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/petems/whisper-tray/internal/app"
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/control"
+	"github.com/rs/zerolog"
+)
+
+const ctlUsage = `Usage: whisper-tray ctl <command> [arguments]
+
+Commands:
+  redo [model]      Re-transcribe the last dictation (default: redo.model from config)
+  cancel            Stop recording and discard the dictation without injecting it
+  listen [on|off]   Toggle hands-free listening, or turn it on or off
+  commit            Inject the draft collected in append mode
+  help              List the commands the running app accepts
+`
+
+// runCtl implements the "ctl" subcommand
+func runCtl(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Print(ctlUsage)
+		return 2
+	}
+
+	reply, err := control.Send(config.ControlSocketPath(), args...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", args[0], err)
+		return 1
+	}
+	if reply != "" {
+		fmt.Println(reply)
+	}
+	return 0
+}
+
+// serveControl starts the control socket for the running app. Control is a
+// convenience, so failing to start it is only logged.
+func serveControl(application *app.App, log zerolog.Logger) *control.Server {
+	ctl, err := control.Listen(config.ControlSocketPath(), log)
+	if err != nil {
+		log.Warn().Err(err).Msg("Control socket unavailable")
+		return nil
+	}
+
+	ctl.Handle("redo", func(args []string) (string, error) {
+		model := ""
+		if len(args) > 0 {
+			model = args[0]
+		}
+		text, err := application.Redo(model)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("injected %q", text), nil
+	})
+	ctl.Handle("cancel", func([]string) (string, error) {
+		if !application.Cancel() {
+			return "", errors.New("nothing to cancel")
+		}
+		return "cancelled", nil
+	})
+
+	ctl.Handle("commit", func([]string) (string, error) {
+		text, err := application.Commit()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("injected %q", text), nil
+	})
+
+	ctl.Handle("listen", func(args []string) (string, error) {
+		on := !application.Listening()
+		if len(args) > 0 {
+			switch args[0] {
+			case "on":
+				on = true
+			case "off":
+				on = false
+			default:
+				return "", fmt.Errorf("expected on or off, got %q", args[0])
+			}
+		}
+		if !on {
+			application.StopListening()
+			return "stopped listening", nil
+		}
+		if err := application.StartListening(); err != nil {
+			return "", err
+		}
+		return "listening", nil
+	})
+
+	go func() {
+		if err := ctl.Serve(); err != nil {
+			log.Error().Err(err).Msg("Control socket stopped")
+		}
+	}()
+	return ctl
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -15,6 +17,8 @@ import (
 	"github.com/petems/whisper-tray/internal/permissions"
 	"github.com/petems/whisper-tray/internal/tray"
 	"github.com/petems/whisper-tray/internal/whisper"
+	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
 )
 
 var (
@@ -24,7 +28,52 @@ var (
 	Commit = "unknown"
 )
 
+const usage = `Usage: whisper-tray [flags] [command]
+
+Without a command, runs the tray app.
+
+Flags:
+  --offline   Never access the network; models must already be on disk
+  --serve     Also share the tray's model over the HTTP API (serve.enabled)
+
+Commands:
+  models      Manage Whisper models (list, pull, rm, verify, import)
+  ctl         Send a command to the running app (e.g. "ctl redo large-v3")
+  serve       Serve a model over an OpenAI-compatible HTTP API without the tray
+  transcribe  Transcribe audio files to txt, json, srt or vtt
+  watch       Transcribe audio files as they appear in a directory
+`
+
+var (
+	offline = flag.Bool("offline", false, "never access the network")
+	serve   = flag.Bool("serve", false, "share the model over an OpenAI-compatible HTTP API")
+)
+
 func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		// Subcommands log warnings to the console only
+		zlog.Logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).Level(zerolog.WarnLevel)
+
+		switch flag.Arg(0) {
+		case "models":
+			os.Exit(runModels(flag.Args()[1:]))
+		case "ctl":
+			os.Exit(runCtl(flag.Args()[1:]))
+		case "serve":
+			os.Exit(runServe(flag.Args()[1:]))
+		case "transcribe":
+			os.Exit(runTranscribe(flag.Args()[1:]))
+		case "watch":
+			os.Exit(runWatch(flag.Args()[1:]))
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", flag.Arg(0), usage)
+			os.Exit(2)
+		}
+	}
+
 	// Load config from XDG/Library/AppData
 	cfg, err := config.Load()
 	if err != nil {
@@ -32,6 +81,7 @@ func main() {
 		log := logging.New()
 		log.Fatal().Err(err).Msg("Failed to load config")
 	}
+	applyFlags(cfg)
 
 	// Initialize logger with configured level
 	log := logging.NewWithLevel(cfg.LogLevel)
@@ -51,8 +101,8 @@ func main() {
 	}
 	defer capture.Close()
 
-	// Initialize whisper
-	transcriber, err := whisper.New(cfg.Whisper)
+	// Initialize whisper; the model loads in the background once the tray is up
+	transcriber, err := whisper.NewLazy(cfg.Whisper)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize whisper")
 	}
@@ -68,29 +118,51 @@ func main() {
 	}
 	defer hkManager.Close()
 
-	// Create tray UI first (we'll pass it to app)
-	trayUI := tray.New(nil, cfg, Version, Commit) // App reference set below
-
-	// Create app with tray as status updater
 	application := app.New(app.Config{
-		Audio:         capture,
-		Transcriber:   transcriber,
-		Injector:      injector,
-		Hotkeys:       hkManager,
-		Config:        cfg,
-		Logger:        log,
-		StatusUpdater: trayUI,
+		Audio:       capture,
+		Transcriber: transcriber,
+		Injector:    injector,
+		Hotkeys:     hkManager,
+		Config:      cfg,
+		Logger:      log,
 	})
 
-	// Set app reference in tray
-	trayUI.SetApp(application)
+	// The tray follows the app's events once it's up
+	trayUI := tray.New(application, cfg, Version, Commit)
 
 	// Register global hotkey
 	if err := hkManager.Register(cfg.PlatformHotkey(), application.OnHotkey); err != nil {
 		log.Fatal().Err(err).Msg("Failed to register hotkey")
 	}
+	if cfg.Redo.Hotkey != "" {
+		if err := hkManager.Register(cfg.Redo.Hotkey, application.OnRedoHotkey); err != nil {
+			log.Warn().Err(err).Str("hotkey", cfg.Redo.Hotkey).Msg("Failed to register redo hotkey")
+		}
+	}
+	if cfg.Append.Enabled && cfg.Append.CommitHotkey != "" {
+		if err := hkManager.Register(cfg.Append.CommitHotkey, application.OnCommitHotkey); err != nil {
+			log.Warn().Err(err).Str("hotkey", cfg.Append.CommitHotkey).Msg("Failed to register commit hotkey")
+		}
+	}
+	if cfg.Listen.Hotkey != "" {
+		if err := hkManager.Register(cfg.Listen.Hotkey, application.OnListenHotkey); err != nil {
+			log.Warn().Err(err).Str("hotkey", cfg.Listen.Hotkey).Msg("Failed to register listen hotkey")
+		}
+	}
+
+	// Accept commands from "whisper-tray ctl"
+	if ctl := serveControl(application, log); ctl != nil {
+		defer ctl.Close()
+	}
+
+	// Share the dictation model with other tools over HTTP
+	if cfg.Serve.Enabled {
+		if srv := serveHTTP(cfg, transcriber, log); srv != nil {
+			defer srv.Close()
+		}
+	}
 
-	log.Info().Msg("WhisperTray starting...")
+	log.Info().Bool("offline", cfg.Whisper.Offline).Msg("WhisperTray starting...")
 
 	// Setup shutdown signal handling
 	sigChan := make(chan os.Signal, 1)
@@ -110,3 +182,20 @@ func main() {
 		log.Fatal().Err(err).Msg("Tray error")
 	}
 }
+
+// daemonLogger logs progress to the console for long-running subcommands
+func daemonLogger() zerolog.Logger {
+	log := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger().Level(zerolog.InfoLevel)
+	zlog.Logger = log
+	return log
+}
+
+// applyFlags layers command-line overrides on top of the saved config
+func applyFlags(cfg *config.Config) {
+	if *offline {
+		cfg.Whisper.Offline = true
+	}
+	if *serve {
+		cfg.Serve.Enabled = true
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/whisper"
+)
+
+const modelsUsage = `Usage: whisper-tray models <command> [arguments]
+
+Commands:
+  list                      List known and downloaded models
+  pull <name>...            Download models
+  rm <name>...              Remove downloaded or imported models
+  verify [name...]          Re-check checksums (default: all downloaded models)
+  import [-name N] <file>   Copy a model file into the models directory
+`
+
+// runModels implements the "models" subcommand
+func runModels(args []string) int {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	applyFlags(cfg)
+
+	registry, err := whisper.LoadRegistry(cfg.Whisper)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	cmd, rest := args[0], args[1:]
+	switch cmd {
+	case "list", "ls":
+		return listModels(registry, cfg.Whisper.Model)
+	case "pull":
+		return pullModels(registry, rest)
+	case "rm", "remove":
+		return eachModel(rest, "removed", registry.Remove)
+	case "verify":
+		if len(rest) == 0 {
+			for _, m := range append(registry.Models(), registry.Imported()...) {
+				if registry.IsDownloaded(m) && inModelsDir(m) {
+					rest = append(rest, m.Name)
+				}
+			}
+		}
+		return eachModel(rest, "ok", registry.Verify)
+	case "import":
+		return importModel(registry, rest)
+	case "help", "-h", "--help":
+		fmt.Print(modelsUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown models command %q\n\n%s", cmd, modelsUsage)
+		return 2
+	}
+}
+
+func listModels(registry *whisper.Registry, current string) int {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSIZE\tLANGUAGES\tQUANT\tSTATUS")
+
+	var total int64
+	for _, m := range append(registry.Models(), registry.Imported()...) {
+		status := "-"
+		size := "-"
+		if info, err := os.Stat(registry.LocalPath(m)); err == nil {
+			switch {
+			case !m.IsLocal():
+				status = "downloaded"
+			case inModelsDir(m):
+				status = "imported"
+			default:
+				status = "local"
+			}
+			size = formatMB(info.Size())
+			if inModelsDir(m) {
+				total += info.Size()
+			}
+		} else if m.IsLocal() {
+			status = "missing"
+		}
+		if m.Name == current {
+			status += " (selected)"
+		}
+
+		languages := "en"
+		if m.Multilingual {
+			languages = "multi"
+		}
+		quant := m.Quantization
+		if quant == "" {
+			quant = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Name, size, languages, quant, status)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%s used in %s\n", formatMB(total), config.ModelsPath())
+	return 0
+}
+
+func pullModels(registry *whisper.Registry, names []string) int {
+	if len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: whisper-tray models pull <name>...")
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	for _, name := range names {
+		var last time.Time
+		progress := func(downloaded, total int64) {
+			if time.Since(last) < 100*time.Millisecond && downloaded < total {
+				return
+			}
+			last = time.Now()
+			if total <= 0 {
+				fmt.Fprintf(os.Stderr, "\rpulling %s  %s", name, formatMB(downloaded))
+				return
+			}
+			fmt.Fprintf(os.Stderr, "\rpulling %s  %5.1f%%  %s / %s", name,
+				float64(downloaded)/float64(total)*100, formatMB(downloaded), formatMB(total))
+		}
+
+		err := registry.Pull(ctx, name, progress)
+		if !last.IsZero() {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			if ctx.Err() != nil {
+				fmt.Fprintln(os.Stderr, "interrupted; run pull again to resume")
+			}
+			return 1
+		}
+		fmt.Printf("%s: ready\n", name)
+	}
+	return 0
+}
+
+func importModel(registry *whisper.Registry, args []string) int {
+	fs := flag.NewFlagSet("models import", flag.ContinueOnError)
+	name := fs.String("name", "", "model name (default: derived from the file name)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: whisper-tray models import [-name NAME] <file>")
+		return 2
+	}
+
+	src := fs.Arg(0)
+	if *name == "" {
+		// ggml-small.en-q5_1.bin -> small.en-q5_1
+		*name = strings.TrimPrefix(strings.TrimSuffix(filepath.Base(src), ".bin"), "ggml-")
+	}
+
+	if err := registry.Import(*name, src); err != nil {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s: imported\n", *name)
+	return 0
+}
+
+// eachModel applies fn to every named model, reporting per-model results
+func eachModel(names []string, okMsg string, fn func(string) error) int {
+	if len(names) == 0 {
+		fmt.Fprintln(os.Stderr, "no models given")
+		return 2
+	}
+
+	code := 0
+	for _, name := range names {
+		if err := fn(name); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: %s\n", name, okMsg)
+	}
+	return code
+}
+
+// inModelsDir reports whether a model is managed by us rather than a file
+// the user pointed the registry at
+func inModelsDir(m whisper.ModelInfo) bool {
+	return !m.IsLocal() || filepath.Dir(m.Path) == filepath.Clean(config.ModelsPath())
+}
+
+func formatMB(bytes int64) string {
+	return fmt.Sprintf("%.1f MB", float64(bytes)/1024/1024)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/filter"
+	"github.com/petems/whisper-tray/internal/server"
+	"github.com/petems/whisper-tray/internal/whisper"
+)
+
+// runServe implements the "serve" subcommand: the model and the HTTP API
+// alone, for machines that don't need the tray. Alongside a tray app it
+// would hold a second copy of the model; use serve.enabled there instead.
+func runServe(args []string) int {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	applyFlags(cfg)
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.StringVar(&cfg.Serve.Addr, "addr", cfg.Serve.Addr, "listen address")
+	fs.StringVar(&cfg.Serve.TokenFile, "token-file", cfg.Serve.TokenFile, "file holding the bearer token clients must send")
+	fs.IntVar(&cfg.Serve.MaxConcurrent, "max-concurrent", cfg.Serve.MaxConcurrent, "requests queued for the model")
+	fs.StringVar(&cfg.Whisper.Model, "model", cfg.Whisper.Model, "model to serve")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	log := daemonLogger()
+
+	// Check before spending time on the model
+	token, err := serveToken(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	// Partials are only useful while dictating
+	cfg.Whisper.PartialModel = ""
+	log.Info().Str("model", cfg.Whisper.Model).Msg("Loading model")
+	transcriber, err := whisper.New(cfg.Whisper)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load model: %v\n", err)
+		return 1
+	}
+	defer transcriber.Close()
+
+	httpServer, err := startServer(cfg, token, transcriber, log)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	httpServer.Shutdown(shutdownCtx)
+	return 0
+}
+
+// serveHTTP exposes the app's transcriber over the OpenAI-compatible API, so
+// other tools share the model already loaded for dictation. Like the control
+// socket it's a convenience, so failing to start it is only logged.
+func serveHTTP(cfg *config.Config, transcriber whisper.Transcriber, log zerolog.Logger) *http.Server {
+	token, err := serveToken(cfg)
+	if err == nil {
+		var httpServer *http.Server
+		if httpServer, err = startServer(cfg, token, transcriber, log); err == nil {
+			return httpServer
+		}
+	}
+	log.Error().Err(err).Msg("Not serving transcriptions")
+	return nil
+}
+
+// serveToken checks cfg can be served safely and returns the bearer token
+// clients must send, or "" for none
+func serveToken(cfg *config.Config) (string, error) {
+	addr := cfg.Serve.Addr
+
+	// The http backend would relay every upload to the remote server on
+	// the user's credentials rather than share a local model
+	if whisper.Remote(cfg.Whisper) {
+		return "", errors.New("only a local model can be served, not the http backend")
+	}
+
+	// Serving other machines is networking too; only this one may connect
+	if cfg.Whisper.Offline && !isLoopback(addr) {
+		return "", fmt.Errorf("offline mode only serves on localhost, not %s", addr)
+	}
+
+	var token string
+	if cfg.Serve.TokenFile != "" {
+		data, err := os.ReadFile(cfg.Serve.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" && !isLoopback(addr) {
+		return "", fmt.Errorf("serving beyond localhost on %s needs a token (serve.token_file)", addr)
+	}
+	return token, nil
+}
+
+// startServer listens on cfg.Serve.Addr and serves transcriber in the background
+func startServer(cfg *config.Config, token string, transcriber whisper.Transcriber, log zerolog.Logger) (*http.Server, error) {
+	srv := server.New(transcriber, server.Options{
+		Token:         token,
+		MaxConcurrent: cfg.Serve.MaxConcurrent,
+		Defaults: whisper.SessionOpts{
+			Language:    cfg.Whisper.Language,
+			Temperature: cfg.Whisper.Temperature,
+			Threads:     cfg.Whisper.Threads,
+		},
+		Filter: filter.New(filter.ForBackend(cfg.Filter, cfg.Whisper)),
+		Logger: log,
+	})
+	httpServer := &http.Server{
+		Addr:              cfg.Serve.Addr,
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ln, err := net.Listen("tcp", cfg.Serve.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("addr", cfg.Serve.Addr).Bool("auth", token != "").Msg("Serving /v1/audio/transcriptions")
+	go func() {
+		if err := httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("Transcription server stopped")
+		}
+	}()
+	return httpServer, nil
+}
+
+// isLoopback reports whether addr only listens on the local machine
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/petems/whisper-tray/internal/audiofile"
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/filter"
+	"github.com/petems/whisper-tray/internal/transcript"
+	"github.com/petems/whisper-tray/internal/whisper"
+)
+
+const transcribeUsage = `Usage: whisper-tray transcribe [flags] <file or glob>...
+
+Transcribes audio files with the configured model. WAV is read directly;
+other formats need ffmpeg on PATH. Each worker loads its own copy of the
+model, so -j multiplies memory use.
+
+Flags:
+`
+
+// outputFormats maps -format values to transcript formats and extensions
+var outputFormats = map[string]struct{ format, ext string }{
+	"txt":          {"text", ".txt"},
+	"json":         {"json", ".json"},
+	"verbose_json": {"verbose_json", ".json"},
+	"srt":          {"srt", ".srt"},
+	"vtt":          {"vtt", ".vtt"},
+}
+
+// runTranscribe implements the "transcribe" subcommand
+func runTranscribe(args []string) int {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	applyFlags(cfg)
+
+	fs := flag.NewFlagSet("transcribe", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, transcribeUsage)
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "txt", "output format: txt, json, verbose_json, srt or vtt")
+	outDir := fs.String("o", "", "output directory (default: next to each input)")
+	model := fs.String("model", cfg.Whisper.Model, "model to transcribe with")
+	language := fs.String("language", cfg.Whisper.Language, `spoken language, or "auto"`)
+	jobs := fs.Int("j", defaultJobs(), "files transcribed in parallel")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	out, ok := outputFormats[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		return 2
+	}
+	files, err := expandInputs(fs.Args(), *outDir, out.ext)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+
+	// Split the CPUs between workers rather than oversubscribing them
+	workers := max(1, min(*jobs, len(files), runtime.NumCPU()))
+	opts := whisper.SessionOpts{
+		Language:    *language,
+		Temperature: cfg.Whisper.Temperature,
+		Threads:     cfg.Whisper.Threads,
+	}
+	if opts.Threads == 0 {
+		opts.Threads = max(1, runtime.NumCPU()/workers)
+	}
+	cfg.Whisper.Model = *model
+	cfg.Whisper.PartialModel = ""
+
+	// Decodes on one model are serialized, so each worker needs its own
+	transcribers := make([]whisper.Transcriber, 0, workers)
+	defer func() {
+		for _, t := range transcribers {
+			t.Close()
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		t, err := whisper.New(cfg.Whisper)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load model: %v\n", err)
+			return 1
+		}
+		transcribers = append(transcribers, t)
+	}
+
+	h := filter.New(filter.ForBackend(cfg.Filter, cfg.Whisper))
+	work := make(chan string)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+	)
+	for _, t := range transcribers {
+		wg.Add(1)
+		go func(t whisper.Transcriber) {
+			defer wg.Done()
+			for in := range work {
+				dest := outputPath(in, *outDir, out.ext)
+				start := time.Now()
+				audio, err := transcribeFile(t, *model, in, dest, out.format, opts, h)
+
+				mu.Lock()
+				if err != nil {
+					failed++
+					fmt.Fprintf(os.Stderr, "%s: %v\n", in, err)
+				} else {
+					fmt.Printf("%s -> %s (%s of audio in %s)\n", in, dest,
+						audio.Round(100*time.Millisecond), time.Since(start).Round(100*time.Millisecond))
+				}
+				mu.Unlock()
+			}
+		}(t)
+	}
+	for _, in := range files {
+		work <- in
+	}
+	close(work)
+	wg.Wait()
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d files failed\n", failed, len(files))
+		return 1
+	}
+	return 0
+}
+
+// defaultJobs runs a worker per four CPUs, the point past which whisper's
+// own threading stops scaling well
+func defaultJobs() int {
+	return max(1, runtime.NumCPU()/4)
+}
+
+// expandInputs resolves globs (for shells that don't) and rejects inputs
+// whose transcripts would overwrite each other
+func expandInputs(args []string, outDir, ext string) ([]string, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no input files; see whisper-tray transcribe -h")
+	}
+
+	seen := make(map[string]bool)
+	dests := make(map[string]string)
+	var files []string
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no such file", arg)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if seen[m] {
+				continue
+			}
+			if info, err := os.Stat(m); err != nil || info.IsDir() {
+				continue
+			}
+			seen[m] = true
+
+			dest := outputPath(m, outDir, ext)
+			if other, ok := dests[dest]; ok {
+				return nil, fmt.Errorf("%s and %s would both be written to %s", other, m, dest)
+			}
+			dests[dest] = m
+			files = append(files, m)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no input files matched")
+	}
+	return files, nil
+}
+
+// outputPath places the transcript for in inside dir, or next to in
+func outputPath(in, dir, ext string) string {
+	if dir == "" {
+		dir = filepath.Dir(in)
+	}
+	base := filepath.Base(in)
+	return filepath.Join(dir, strings.TrimSuffix(base, filepath.Ext(base))+ext)
+}
+
+// transcribeFile decodes one audio file and writes its transcript to dest,
+// returning the length of the audio. The transcript is written to a
+// temporary file first so readers never see a partial one.
+func transcribeFile(t whisper.Transcriber, model, in, dest, format string, opts whisper.SessionOpts, h *filter.Hallucination) (time.Duration, error) {
+	samples, err := audiofile.Load(in)
+	if err != nil {
+		return 0, err
+	}
+	segments, err := t.Transcribe(model, samples, opts, nil)
+	if err != nil {
+		return 0, err
+	}
+	duration := time.Duration(len(samples)) * time.Second / audiofile.SampleRate
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := transcript.Write(tmp, format, h.Segments(segments), duration); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return duration, os.Rename(tmp.Name(), dest)
+}
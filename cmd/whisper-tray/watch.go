@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/filter"
+	"github.com/petems/whisper-tray/internal/watch"
+	"github.com/petems/whisper-tray/internal/whisper"
+)
+
+const watchUsage = `Usage: whisper-tray watch [flags] <directory>
+
+Transcribes audio files already in the directory, then each new one as it
+arrives, until interrupted. Processed files are recorded in
+.whisper-tray-watch.json in the output directory so restarts skip them.
+
+Flags:
+`
+
+// runWatch implements the "watch" subcommand
+func runWatch(args []string) int {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	applyFlags(cfg)
+
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, watchUsage)
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "txt", "output format: txt, json, verbose_json, srt or vtt")
+	outDir := fs.String("o", "", "output directory (default: next to each file)")
+	model := fs.String("model", cfg.Whisper.Model, "model to transcribe with")
+	language := fs.String("language", cfg.Whisper.Language, `spoken language, or "auto"`)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	dir := fs.Arg(0)
+
+	out, ok := outputFormats[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		return 2
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "%s is not a directory\n", dir)
+		return 2
+	}
+	stateDir := dir
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		stateDir = *outDir
+	}
+
+	log := daemonLogger()
+
+	cfg.Whisper.Model = *model
+	cfg.Whisper.PartialModel = ""
+	log.Info().Str("model", *model).Msg("Loading model")
+	transcriber, err := whisper.New(cfg.Whisper)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load model: %v\n", err)
+		return 1
+	}
+	defer transcriber.Close()
+
+	opts := whisper.SessionOpts{
+		Language:    *language,
+		Temperature: cfg.Whisper.Temperature,
+		Threads:     cfg.Whisper.Threads,
+	}
+	h := filter.New(filter.ForBackend(cfg.Filter, cfg.Whisper))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = watch.Run(ctx, watch.Options{
+		Dir:       dir,
+		StatePath: filepath.Join(stateDir, ".whisper-tray-watch.json"),
+		Logger:    log,
+	}, func(path string) error {
+		_, err := transcribeFile(transcriber, *model, path, outputPath(path, *outDir, out.ext), out.format, opts, h)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -8,6 +8,7 @@ require (
 	github.com/ggerganov/whisper.cpp/bindings/go v0.0.0-20240101000000-000000000000
 	github.com/gordonklaus/portaudio v0.0.0-20230709114228-aafa478834f5
 	github.com/rs/zerolog v1.32.0
+	golang.org/x/sys v0.12.0
 )
 
 // Use vendored whisper.cpp bindings
@@ -24,5 +25,4 @@ require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/oxtoacart/bpool v0.0.0-20190530202638-03653db5a59c // indirect
-	golang.org/x/sys v0.12.0 // indirect
 )
@@ -9,8 +9,12 @@ import (
 
 	"github.com/petems/whisper-tray/internal/audio"
 	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/events"
+	"github.com/petems/whisper-tray/internal/filter"
 	"github.com/petems/whisper-tray/internal/hotkey"
 	"github.com/petems/whisper-tray/internal/inject"
+	"github.com/petems/whisper-tray/internal/supervise"
+	"github.com/petems/whisper-tray/internal/vad"
 	"github.com/petems/whisper-tray/internal/whisper"
 	"github.com/rs/zerolog"
 )
@@ -20,249 +24,531 @@ type Mode int
 const (
 	PushToTalk Mode = iota
 	Toggle
+	Hybrid
 )
 
-// StatusUpdater is an interface for updating status (e.g., tray icon)
-type StatusUpdater interface {
-	SetIdle()
-	SetRecording()
-	SetProcessing()
-	SetError()
-}
-
 type Config struct {
-	Audio         audio.Capture
-	Transcriber   whisper.Transcriber
-	Injector      inject.Injector
-	Hotkeys       hotkey.Manager
-	Config        *config.Config
-	Logger        zerolog.Logger
-	StatusUpdater StatusUpdater // Optional - can be nil
+	Audio       audio.Capture
+	Transcriber whisper.Transcriber
+	Injector    inject.Injector
+	Hotkeys     hotkey.Manager
+	Config      *config.Config
+	Logger      zerolog.Logger
 }
 
 type App struct {
-	audio  audio.Capture
-	stt    whisper.Transcriber
-	inj    inject.Injector
-	cfg    *config.Config
-	log    zerolog.Logger
-	status StatusUpdater
-
-	mu            sync.Mutex
-	dictating     bool
-	session       whisper.Session
-	audioCtx      context.Context
-	audioStop     context.CancelFunc
-	textBuffer    []string
-	collectorDone chan struct{}
+	audio   audio.Capture
+	stt     whisper.Transcriber
+	inj     inject.Injector
+	hotkeys hotkey.Manager
+	cfg     *config.Config
+	log     zerolog.Logger
+	events  *events.Bus
+	filter  *filter.Hallucination
+	now     func() time.Time
+
+	mu      sync.Mutex
+	loading bool // no usable model yet; hotkey presses are rejected
+	state   State
+	gesture gesture // hotkey timing in Hybrid mode
+
+	// loadFailed is set when the model failed to load and none is usable;
+	// the next hotkey press loads it again
+	loadFailed bool
+
+	// listener is hands-free listening, when it's on
+	listener *listener
+	// waker listens for the wake phrase while the app is otherwise idle
+	waker *waker
+	// wakeDone closes when the last stopped wake loop has freed its model
+	wakeDone <-chan struct{}
+
+	// draft collects dictations in append mode until they're committed.
+	// draftGen invalidates commit timers armed for an earlier draft.
+	draft      []string
+	draftAudio *recording
+	draftTimer *time.Timer
+	draftGen   int
+
+	// current is the dictation being recorded. pending holds dictations
+	// still finalizing or injecting, oldest first; latest is the newest
+	// dictation, the only one whose events move the state machine.
+	current *dictation
+	pending []*dictation
+	latest  *dictation
+	nextID  int
+
+	// last and lastInjected are kept from the previous dictation so it can
+	// be redone
+	last         *recording
+	lastInjected string
+	redoing      bool
+
+	// modelMu serializes background model loads; modelGen (guarded by mu)
+	// lets a superseded selection skip its load so the last choice wins.
+	modelMu  sync.Mutex
+	modelGen int
+
+	// cancelKeyMu guards cancelKeyOn, whether the cancel hotkey is grabbed
+	cancelKeyMu sync.Mutex
+	cancelKeyOn bool
 }
 
 func New(cfg Config) *App {
 	return &App{
-		audio:  cfg.Audio,
-		stt:    cfg.Transcriber,
-		inj:    cfg.Injector,
-		cfg:    cfg.Config,
-		log:    cfg.Logger,
-		status: cfg.StatusUpdater,
+		audio:   cfg.Audio,
+		stt:     cfg.Transcriber,
+		inj:     cfg.Injector,
+		hotkeys: cfg.Hotkeys,
+		cfg:     cfg.Config,
+		log:     cfg.Logger,
+		events:  events.NewBus(),
+		filter:  filter.New(filter.ForBackend(cfg.Config.Filter, cfg.Config.Whisper)),
+		now:     time.Now,
 	}
 }
 
+// Subscribe follows what the app is doing, such as dictations starting and
+// text being injected. Only events want accepts are delivered, or all of
+// them if want is nil. Close the subscription when done with it.
+func (a *App) Subscribe(buffer int, want func(events.Event) bool) *events.Subscription {
+	return a.events.SubscribeFiltered(buffer, want)
+}
+
+// Start loads the configured model in the background. Until it's ready the
+// status shows loading progress and hotkey presses are rejected.
+func (a *App) Start() {
+	a.mu.Lock()
+	a.loading = true
+	a.modelGen++
+	gen := a.modelGen
+	model, partial := a.cfg.Whisper.Model, a.cfg.Whisper.PartialModel
+	if a.cfg.Wake.Enabled {
+		a.startWakeLocked()
+	}
+	a.mu.Unlock()
+
+	go func() {
+		a.loadModel(model, gen)
+		a.loadPartialModel(partial)
+	}()
+}
+
 func (a *App) OnHotkey(pressed bool) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	mode := PushToTalk
-	if a.cfg.Mode == "Toggle" {
-		mode = Toggle
+	if a.loading {
+		if pressed {
+			a.log.Warn().Str("model", a.cfg.Whisper.Model).Msg("Model is still loading; ignoring hotkey")
+		}
+		return
 	}
-
-	switch mode {
-	case PushToTalk:
+	if a.loadFailed {
 		if pressed {
-			a.startDictationLocked()
-		} else {
-			a.stopAndInjectLocked()
+			a.retryLoadLocked()
 		}
-	case Toggle:
-		if !a.dictating {
-			a.startDictationLocked()
-		} else {
-			a.stopAndInjectLocked()
+		return
+	}
+	if a.redoing {
+		if pressed {
+			a.log.Warn().Msg("Redo in progress; ignoring hotkey")
 		}
+		return
+	}
+	if a.listener != nil {
+		if pressed {
+			a.log.Warn().Msg("Listening hands-free; ignoring hotkey")
+		}
+		return
 	}
-}
 
-func (a *App) startDictationLocked() {
-	if a.dictating {
+	if a.cfg.Mode == "Hybrid" {
+		a.onHybridHotkeyLocked(pressed)
 		return
 	}
 
-	a.log.Info().Msg("Starting dictation")
-	a.dictating = true
-	a.textBuffer = nil
+	recording := a.state == StateRecording
+	switch {
+	case pressed && !recording:
+		a.startDictationLocked(nil)
+	case recording && !pressed && a.cfg.Mode != "Toggle",
+		recording && pressed && a.cfg.Mode == "Toggle":
+		a.stopDictationLocked("")
+	}
+}
+
+// Cancel drops the dictation being recorded, or the one being transcribed
+// or injected once the key is up. Dictations queued ahead of it are still
+// injected. It reports whether there was anything to cancel.
+func (a *App) Cancel() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.cancelLocked()
+}
 
-	// Update status to recording
-	if a.status != nil {
-		a.status.SetRecording()
+func (a *App) cancelLocked() bool {
+	d := a.latest
+	if !a.fireLocked(nil, EventCancel) {
+		return false
+	}
+	a.log.Info().Msg("Cancelling dictation")
+
+	if d == nil {
+		return true
+	}
+	d.cancel()
+	if a.current == d {
+		a.current = nil
+		d.stopCapture()
+		go supervise.Run(a.log, "teardown", d.teardown, nil)
 	}
+	// Redo goes back to what it would have used without the discarded audio
+	if a.last == d.audio {
+		a.last, a.lastInjected = d.prevLast, d.prevInjected
+	}
+	a.latest = nil
+	return true
+}
 
-	a.audioCtx, a.audioStop = context.WithCancel(context.Background())
+// OnCancelHotkey cancels the dictation in progress
+func (a *App) OnCancelHotkey(pressed bool) {
+	if pressed {
+		a.Cancel()
+	}
+}
 
-	// Start whisper session
-	session, err := a.stt.StartSession(whisper.SessionOpts{
-		Language:    a.cfg.Whisper.Language,
-		Temperature: a.cfg.Whisper.Temperature,
-		Threads:     a.cfg.Whisper.Threads,
-	})
+// syncCancelHotkey grabs the cancel hotkey only while a dictation is in
+// progress, so a key like Escape keeps working in other apps the rest of
+// the time. It runs off a.mu since hotkey callbacks take a.mu.
+func (a *App) syncCancelHotkey() {
+	a.cancelKeyMu.Lock()
+	defer a.cancelKeyMu.Unlock()
+
+	switch a.State() {
+	case StateRecording, StateFinalizing, StateInjecting:
+		if a.cancelKeyOn {
+			return
+		}
+		for _, accel := range a.cancelAccels() {
+			if err := a.hotkeys.Register(accel, a.OnCancelHotkey); err != nil {
+				a.log.Warn().Err(err).Str("hotkey", accel).Msg("Failed to register cancel hotkey")
+			}
+		}
+		a.cancelKeyOn = true
+	default:
+		if !a.cancelKeyOn {
+			return
+		}
+		for _, accel := range a.cancelAccels() {
+			if err := a.hotkeys.Unregister(accel); err != nil {
+				a.log.Warn().Err(err).Str("hotkey", accel).Msg("Failed to unregister cancel hotkey")
+			}
+		}
+		a.cancelKeyOn = false
+	}
+}
+
+// cancelAccels lists the cancel hotkey as grabbed: on its own, and with the
+// dictation hotkey's modifiers, since a key pressed while Alt+Space is held
+// arrives as Alt+Escape.
+func (a *App) cancelAccels() []string {
+	accels := []string{a.cfg.CancelHotkey}
+	tokens := strings.Split(a.cfg.PlatformHotkey(), "+")
+	if mods := tokens[:len(tokens)-1]; len(mods) > 0 {
+		held := strings.Join(append(mods, a.cfg.CancelHotkey), "+")
+		if held != a.cfg.CancelHotkey {
+			accels = append(accels, held)
+		}
+	}
+	return accels
+}
+
+// State reports where the app is in a dictation
+func (a *App) State() State {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.state
+}
+
+// fireLocked moves the state machine on ev, raised by dictation d or by
+// the user when d is nil. Events from a dictation that has since been
+// superseded are ignored: the newer one owns the state.
+func (a *App) fireLocked(d *dictation, ev Event) bool {
+	if d != nil && d != a.latest {
+		return false
+	}
+	to, ok := next(a.state, ev)
+	if !ok {
+		return false
+	}
+	a.log.Debug().Stringer("from", a.state).Stringer("to", to).Stringer("event", ev).Msg("State transition")
+	a.state = to
+	a.reportStateLocked()
+	if a.hotkeys != nil && a.cfg.CancelHotkey != "" {
+		go a.syncCancelHotkey()
+	}
+	return true
+}
+
+// Status reports what the app shows it's doing, as last published in a
+// StateChanged. A subscriber that missed events can read it to catch up.
+func (a *App) Status() events.Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.statusLocked()
+}
+
+func (a *App) statusLocked() events.Status {
+	switch {
+	case a.listener != nil:
+		return events.StatusListening
+	case a.redoing:
+		return events.StatusProcessing
+	case a.state == StateRecording:
+		return events.StatusRecording
+	case a.state == StateFinalizing, a.state == StateInjecting:
+		return events.StatusProcessing
+	case a.state == StateError:
+		return events.StatusError
+	}
+	return events.StatusIdle
+}
+
+func (a *App) reportStateLocked() {
+	a.events.Publish(events.StateChanged{Status: a.statusLocked()})
+}
+
+// startDictationLocked starts recording a dictation, which begins with seed
+// when audio leading up to it was already captured. It returns nil if the
+// dictation couldn't start.
+func (a *App) startDictationLocked(seed []float32) *dictation {
+	if !a.fireLocked(nil, EventStart) {
+		return nil
+	}
+	a.log.Info().Msg("Starting dictation")
+	a.pauseWakeLocked()
+
+	session, err := a.stt.StartSession(a.sessionOpts())
 	if err != nil {
 		a.log.Error().Err(err).Msg("Failed to start session")
-		a.dictating = false
-		a.audioStop()
-		return
+		a.fireLocked(nil, EventFailed)
+		a.events.Publish(events.Error{Cause: events.CauseSession, Err: err})
+		return nil
+	}
+
+	// Inject after whichever dictation is still ahead of this one
+	var prev <-chan struct{}
+	if a.latest != nil {
+		prev = a.latest.done
 	}
-	a.session = session
+	a.nextID++
+	limits, gate := a.cfg.AutoStop, a.cfg.Gate
+	d := newDictation(a.nextID, session, vad.New(16000, limits.SilenceThreshold), prev)
+	d.speech = gate.MinMs <= 0 && gate.MinSpeechMs <= 0
+	a.current, a.latest = d, d
+	a.events.Publish(events.DictationStarted{ID: d.id})
 
-	// Create collector done channel
-	a.collectorDone = make(chan struct{})
+	var audioCtx context.Context
+	audioCtx, d.stopCapture = context.WithCancel(d.ctx)
 
 	// Bounded audio buffer
 	audioChan := make(chan []float32, 8)
 
+	// A panic in any of the dictation's goroutines fails just that dictation
+	crashed := func(p *supervise.Panic) {
+		a.failDictation(d, events.CausePanic, p)
+	}
+
 	// Start audio capture
-	go func() {
-		if err := a.audio.Start(a.audioCtx, a.cfg.Audio.DeviceID, 16000, audioChan); err != nil {
-			a.log.Error().Err(err).Msg("Audio error")
+	go supervise.Run(a.log, "capture", func() {
+		if err := a.audio.Start(audioCtx, a.cfg.Audio.DeviceID, 16000, audioChan); err != nil {
+			a.failDictation(d, events.CauseAudio, err)
 		}
-	}()
+	}, crashed)
 
 	// Feed whisper
-	go func() {
+	go supervise.Run(a.log, "feed", func() {
+		defer close(d.fed)
+		take := func(samples []float32) {
+			d.audio.append(samples)
+			d.det.Feed(samples)
+			a.events.Publish(events.AudioLevel{ID: d.id, Level: vad.RMS(samples)})
+			if err := d.feed(samples, gate); err != nil {
+				a.log.Error().Err(err).Msg("Feed error")
+			}
+			if reason := autoStopReason(d.det, limits); reason != "" {
+				a.autoStop(d, reason)
+			}
+		}
+
+		if len(seed) > 0 {
+			take(seed)
+		}
 		for {
 			select {
-			case <-a.audioCtx.Done():
+			case <-audioCtx.Done():
 				return
 			case samples, ok := <-audioChan:
 				if !ok {
 					return
 				}
-				if err := session.Feed(samples); err != nil {
-					a.log.Error().Err(err).Msg("Feed error")
-				}
+				take(samples)
 			}
 		}
-	}()
+	}, crashed)
 
-	// Collect results
-	go a.collectTranscripts(a.collectorDone)
+	go supervise.Run(a.log, "collector", func() {
+		d.collect(a.log, a.filter, a.cfg.StreamPartials, a.events)
+	}, crashed)
+	return d
 }
 
-func (a *App) stopAndInjectLocked() {
-	if !a.dictating {
+// stopDictationLocked ends capture and hands the dictation to finish. The
+// lock is not held while it transcribes and injects. reason is why it
+// stopped on its own, or "" when the hotkey stopped it.
+func (a *App) stopDictationLocked(reason string) {
+	d := a.current
+	if d == nil || !a.fireLocked(nil, EventStop) {
 		return
 	}
 
-	a.log.Info().Msg("Stopping dictation")
-	a.dictating = false
+	a.log.Info().Int("dictation", d.id).Msg("Stopping dictation")
+	a.events.Publish(events.DictationStopped{ID: d.id, Reason: reason})
+	d.stopCapture()
+	a.current = nil
+	a.pending = append(a.pending, d)
+	// In append mode redo targets the committed draft instead
+	d.toDraft = a.cfg.Append.Enabled
+	if !d.toDraft {
+		d.prevLast, d.prevInjected = a.last, a.lastInjected
+		a.last = d.audio
+		a.lastInjected = ""
+	}
+
+	go func() {
+		defer a.finished(d)
+		supervise.Run(a.log, "finish", func() { a.finish(d) }, func(p *supervise.Panic) {
+			a.failDictation(d, events.CausePanic, p)
+		})
+	}()
+}
 
-	// Update status to processing
-	if a.status != nil {
-		a.status.SetProcessing()
+// finish transcribes a stopped dictation and injects its text once the
+// dictations before it have
+func (a *App) finish(d *dictation) {
+	// Closed below once the audio is in; this covers a panic before then,
+	// which would otherwise leave the transcriber counting the session
+	defer d.session.Close()
+	<-d.fed
+	if !d.speech {
+		// Nothing reached the session, so closing it decodes nothing
+		d.session.Close()
+		<-d.collected
+		a.discard(d)
+		return
 	}
 
-	if a.audioStop != nil {
-		a.audioStop()
+	sessionErr := d.session.Close()
+	<-d.collected
+	if sessionErr != nil {
+		a.log.Error().Err(sessionErr).Msg("Transcription failed")
 	}
 
-	session := a.session
-	collectorDone := a.collectorDone
+	raw := d.text()
+	if d.wakePhrase != "" {
+		raw, _ = stripPhrase(raw, d.wakePhrase)
+	}
+	text := a.applyFilters(raw)
 
-	// Unlock before closing session to avoid deadlock
-	// (collectTranscripts needs the mutex to append finals)
+	a.mu.Lock()
+	if d.ctx.Err() != nil {
+		a.mu.Unlock()
+		return
+	}
+	switch {
+	case strings.TrimSpace(text) == "" && sessionErr != nil:
+		if a.fireLocked(d, EventFailed) {
+			a.events.Publish(events.Error{Cause: events.CauseTranscription, Err: sessionErr})
+		}
+	case strings.TrimSpace(text) == "":
+		a.log.Info().Msg("No text to inject")
+		a.fireLocked(d, EventNoSpeech)
+	default:
+		a.events.Publish(events.Final{ID: d.id, Text: text})
+		a.fireLocked(d, EventTranscribed)
+	}
 	a.mu.Unlock()
 
-	if session != nil {
-		session.Close()
+	if strings.TrimSpace(text) == "" {
+		return
 	}
 
-	// Wait for collector to finish receiving all finals
-	if collectorDone != nil {
-		a.log.Debug().Msg("Waiting for collector to finish")
-		<-collectorDone
-		a.log.Debug().Msg("Collector finished")
+	if d.prev != nil {
+		select {
+		case <-d.prev:
+		case <-d.ctx.Done():
+			return
+		}
 	}
 
-	// Re-lock to safely access textBuffer
-	a.mu.Lock()
-
-	text := a.joinText()
-	if text == "" {
-		a.log.Info().Msg("No text to inject")
-		if a.status != nil {
-			a.status.SetIdle()
-		}
+	if d.toDraft {
+		a.addToDraft(d, raw)
 		return
 	}
 
-	text = a.applyFilters(text)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(d.ctx, 5*time.Second)
 	defer cancel()
+	err := a.inj.PasteOrType(ctx, text)
 
-	if err := a.inj.PasteOrType(ctx, text); err != nil {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if d.ctx.Err() != nil {
+		return
+	}
+	if err != nil {
 		a.log.Error().Err(err).Msg("Inject error")
-		if a.status != nil {
-			a.status.SetError()
-		}
-	} else {
-		a.log.Info().Str("text", text).Msg("Injected")
-		if a.status != nil {
-			a.status.SetIdle()
-		}
+		a.fireLocked(d, EventFailed)
+		a.events.Publish(events.InjectionFailed{ID: d.id, Text: text, Err: err})
+		return
 	}
+	a.log.Info().Str("text", text).Msg("Injected")
+	if a.last == d.audio {
+		a.lastInjected = text
+	}
+	a.fireLocked(d, EventInjected)
+	a.events.Publish(events.Injected{ID: d.id, Text: text})
 }
 
-func (a *App) collectTranscripts(done chan struct{}) {
-	a.log.Debug().Msg("collectTranscripts started")
-	defer func() {
-		a.log.Debug().Msg("collectTranscripts exiting, signaling done")
-		close(done)
-	}()
-
-	partials := a.session.Partials()
-	finals := a.session.Finals()
-
-	for {
-		select {
-		case partial, ok := <-partials:
-			if !ok {
-				a.log.Debug().Msg("Partials channel closed")
-				partials = nil // Stop selecting on closed channel
-				continue
-			}
-			if a.cfg.StreamPartials {
-				a.log.Debug().Str("partial", partial).Msg("Partial")
-			}
-		case final, ok := <-finals:
-			if !ok {
-				// Finals channel closed, we're done
-				a.log.Debug().Msg("Finals channel closed")
-				return
-			}
-			a.mu.Lock()
-			a.textBuffer = append(a.textBuffer, final)
-			a.mu.Unlock()
-			a.log.Info().Str("final", final).Msg("Final received and buffered")
+// finished drops d from the pending queue and releases the dictation
+// queued behind it
+func (a *App) finished(d *dictation) {
+	a.mu.Lock()
+	for i, p := range a.pending {
+		if p == d {
+			a.pending = append(a.pending[:i], a.pending[i+1:]...)
+			break
 		}
 	}
+	a.mu.Unlock()
+
+	d.cancel()
+	close(d.done)
 }
 
-func (a *App) joinText() string {
-	result := strings.Join(a.textBuffer, " ")
-	return strings.TrimSpace(result)
+func (a *App) sessionOpts() whisper.SessionOpts {
+	return whisper.SessionOpts{
+		Language:    a.cfg.Whisper.Language,
+		Temperature: a.cfg.Whisper.Temperature,
+		Threads:     a.cfg.Whisper.Threads,
+	}
 }
 
 func (a *App) applyFilters(text string) string {
+	if a.filter != nil {
+		text = a.filter.Clean(text)
+	}
+
 	if len(text) == 0 {
 		return text
 	}
@@ -279,14 +565,41 @@ func (a *App) applyFilters(text string) string {
 	return text
 }
 
+// Shutdown finishes the dictation being recorded, waiting for it and any
+// earlier ones to be injected
 func (a *App) Shutdown(ctx context.Context) error {
 	a.mu.Lock()
-	defer a.mu.Unlock()
+	a.stopDictationLocked("")
+	pending := append([]*dictation(nil), a.pending...)
+	l := a.listener
+	a.stopListeningLocked(l)
+	w := a.waker
+	a.stopWakeLocked()
+	a.mu.Unlock()
 
-	if a.dictating {
-		a.stopAndInjectLocked()
+	if w != nil {
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 
+	if l != nil {
+		select {
+		case <-l.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for _, d := range pending {
+		select {
+		case <-d.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 	return nil
 }
 
@@ -303,7 +616,7 @@ func (a *App) SetDevice(id string) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.dictating {
+	if a.state == StateRecording {
 		return fmt.Errorf("cannot change while dictating")
 	}
 
@@ -311,22 +624,120 @@ func (a *App) SetDevice(id string) error {
 	return a.cfg.Save()
 }
 
+// SetModel saves the model selection and swaps the transcriber over to it
+// in the background, downloading it first if needed. A session that is
+// already running finishes on the model it started with.
 func (a *App) SetModel(model string) error {
 	a.mu.Lock()
-	defer a.mu.Unlock()
+	a.cfg.Whisper.Model = model
+	err := a.cfg.Save()
+	a.modelGen++
+	gen := a.modelGen
+	a.mu.Unlock()
 
-	if a.dictating {
-		return fmt.Errorf("cannot change while dictating")
+	go a.loadModel(model, gen)
+	return err
+}
+
+func (a *App) loadModel(model string, gen int) {
+	a.modelMu.Lock()
+	defer a.modelMu.Unlock()
+
+	a.mu.Lock()
+	superseded := gen != a.modelGen
+	a.mu.Unlock()
+	if superseded {
+		a.log.Debug().Str("model", model).Msg("Skipping superseded model load")
+		return
 	}
 
-	a.cfg.Whisper.Model = model
-	return a.cfg.Save()
+	a.log.Info().Str("model", model).Msg("Loading model in background")
+	a.reportLoading(model, 0, 0)
+	if err := a.stt.LoadModel(model, a.loadProgress(model)); err != nil {
+		a.log.Error().Err(err).Str("model", model).Msg("Failed to load model")
+		a.mu.Lock()
+		// With no model to fall back on, show the error rather than a
+		// loading status that never ends; the next press tries again. A
+		// failed switch keeps the transcriber on the model it had.
+		if a.loading || a.loadFailed {
+			a.loading, a.loadFailed = false, true
+			a.fireLocked(nil, EventFailed)
+		}
+		a.events.Publish(events.Error{Cause: events.CauseModel, Err: err})
+		a.mu.Unlock()
+		return
+	}
+	a.log.Info().Str("model", model).Msg("Model ready")
+
+	a.mu.Lock()
+	a.loading = false
+	if a.loadFailed {
+		a.loadFailed = false
+		a.fireLocked(nil, EventCancel)
+	}
+	a.events.Publish(events.ModelReady{Model: model})
+	if a.state == StateIdle {
+		a.reportStateLocked()
+	}
+	a.mu.Unlock()
 }
 
-func (a *App) IsDictating() bool {
+// retryLoadLocked loads the configured model again after it failed to
+func (a *App) retryLoadLocked() {
+	a.log.Info().Str("model", a.cfg.Whisper.Model).Msg("Retrying model load")
+	a.loadFailed = false
+	a.loading = true
+	a.fireLocked(nil, EventCancel)
+	a.modelGen++
+	go a.loadModel(a.cfg.Whisper.Model, a.modelGen)
+}
+
+// loadPartialModel turns on two-pass transcription. Without it dictation
+// still works, just without live partials, so a failure is only logged.
+func (a *App) loadPartialModel(model string) {
+	if model == "" {
+		return
+	}
+
+	a.log.Info().Str("model", model).Msg("Loading partials model in background")
+	if err := a.stt.LoadPartialModel(model, a.loadProgress(model)); err != nil {
+		a.log.Warn().Err(err).Str("model", model).Msg("Failed to load partials model; continuing without partials")
+	} else {
+		a.events.Publish(events.ModelReady{Model: model})
+	}
+
 	a.mu.Lock()
-	defer a.mu.Unlock()
-	return a.dictating
+	if a.state == StateIdle && !a.loading {
+		a.reportStateLocked()
+	}
+	a.mu.Unlock()
+}
+
+// loadProgress reports download progress whenever the whole percentage
+// changes
+func (a *App) loadProgress(model string) whisper.ProgressFunc {
+	last := int64(-1)
+	return func(downloaded, total int64) {
+		var step int64
+		if total > 0 {
+			step = downloaded * 100 / total
+		} else {
+			step = downloaded >> 20 // every MB when the size is unknown
+		}
+		if step == last {
+			return
+		}
+		last = step
+		a.reportLoading(model, downloaded, total)
+	}
+}
+
+func (a *App) reportLoading(model string, downloaded, total int64) {
+	a.events.Publish(events.ModelLoading{Model: model, Downloaded: downloaded, Total: total})
+}
+
+func (a *App) IsDictating() bool {
+	return a.State() == StateRecording
 }
 
 func (a *App) ListDevices() ([]audio.AudioDevice, error) {
@@ -1,6 +1,8 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -8,65 +10,84 @@ import (
 	"time"
 
 	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/events"
+	"github.com/petems/whisper-tray/internal/filter"
+	"github.com/petems/whisper-tray/internal/vad"
+	"github.com/petems/whisper-tray/internal/whisper"
 	"github.com/rs/zerolog"
 )
 
 type fakeSession struct {
 	partials       chan string
-	finals         chan string
+	finals         chan whisper.Segment
 	partialsCalled chan struct{}
 	finalsCalled   chan struct{}
 
 	partialsOnce sync.Once
 	finalsOnce   sync.Once
+
+	// release, if set, holds Close until it is closed. Close then emits
+	// text as the final transcript and returns err.
+	release   chan struct{}
+	text      string
+	err       error
+	closeOnce sync.Once
+
+	mu  sync.Mutex
+	fed int // samples fed
 }
 
 func newFakeSession() *fakeSession {
 	return &fakeSession{
 		partials:       make(chan string, 4),
-		finals:         make(chan string, 4),
+		finals:         make(chan whisper.Segment, 4),
 		partialsCalled: make(chan struct{}),
 		finalsCalled:   make(chan struct{}),
 	}
 }
 
-func (s *fakeSession) Feed(_ []float32) error { return nil }
+func (s *fakeSession) Feed(samples []float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fed += len(samples)
+	return nil
+}
+
+func (s *fakeSession) samplesFed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fed
+}
 
 func (s *fakeSession) Partials() <-chan string {
 	s.partialsOnce.Do(func() { close(s.partialsCalled) })
 	return s.partials
 }
 
-func (s *fakeSession) Finals() <-chan string {
+func (s *fakeSession) Finals() <-chan whisper.Segment {
 	s.finalsOnce.Do(func() { close(s.finalsCalled) })
 	return s.finals
 }
 
-func (s *fakeSession) Close() error { return nil }
-
-func startCollector(t *testing.T, a *App, done chan struct{}) <-chan error {
-	t.Helper()
-	errCh := make(chan error, 1)
-
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				errCh <- asError(r)
-				return
-			}
-			errCh <- nil
-		}()
-		a.collectTranscripts(done)
-	}()
-
-	return errCh
+func (s *fakeSession) Close() error {
+	if s.release != nil {
+		<-s.release
+	}
+	s.closeOnce.Do(func() {
+		if s.text != "" {
+			s.finals <- whisper.Segment{Text: s.text}
+		}
+		close(s.finals)
+	})
+	return s.err
 }
 
-func asError(r interface{}) error {
-	if err, ok := r.(error); ok {
-		return err
-	}
-	return fmt.Errorf("panic: %v", r)
+// startCollector runs a dictation's collector and returns a channel that
+// receives once it has finished
+func startCollector(a *App, session *fakeSession) (*dictation, <-chan struct{}) {
+	d := newDictation(1, session, vad.New(16000, 0), nil)
+	go d.collect(a.log, a.filter, false, nil)
+	return d, d.collected
 }
 
 func waitForSignal(t *testing.T, ch <-chan struct{}, msg string) {
@@ -81,15 +102,6 @@ func waitForSignal(t *testing.T, ch <-chan struct{}, msg string) {
 	}
 }
 
-func waitForClosed(t *testing.T, ch <-chan struct{}, msg string) {
-	t.Helper()
-	select {
-	case <-ch:
-	case <-time.After(2 * time.Second):
-		t.Fatalf("timeout waiting for %s", msg)
-	}
-}
-
 func TestCollectTranscriptsBuffersFinals(t *testing.T) {
 	app := &App{
 		cfg: &config.Config{},
@@ -97,79 +109,475 @@ func TestCollectTranscriptsBuffersFinals(t *testing.T) {
 	}
 
 	session := newFakeSession()
-	app.session = session
-
-	done := make(chan struct{})
-	app.collectorDone = done
-	errCh := startCollector(t, app, done)
+	d, done := startCollector(app, session)
 
 	waitForSignal(t, session.finalsCalled, "collector to read finals channel")
 
 	session.partials <- "partial ignored"
-	session.finals <- "final transcript"
+	session.finals <- whisper.Segment{Text: "final transcript"}
 	close(session.finals)
 
-	waitForClosed(t, done, "collector completion")
-
-	if err := <-errCh; err != nil {
-		t.Fatalf("collector returned error: %v", err)
-	}
-
-	app.mu.Lock()
-	defer app.mu.Unlock()
+	waitForSignal(t, done, "collector completion")
 
-	if len(app.textBuffer) != 1 || app.textBuffer[0] != "final transcript" {
-		t.Fatalf("expected buffered final, got %#v", app.textBuffer)
+	if got := d.text(); got != "final transcript" {
+		t.Fatalf("expected buffered final, got %q", got)
 	}
 }
 
-func TestCollectTranscriptsReassignmentSafe(t *testing.T) {
+func TestCollectTranscriptsPerDictation(t *testing.T) {
 	app := &App{
 		cfg: &config.Config{},
 		log: zerolog.New(io.Discard),
 	}
 
-	// Start first collector
+	// A second dictation starts before the first one finishes
 	session1 := newFakeSession()
-	done1 := make(chan struct{})
-	app.session = session1
-	app.collectorDone = done1
-	errCh1 := startCollector(t, app, done1)
+	d1, done1 := startCollector(app, session1)
 	waitForSignal(t, session1.finalsCalled, "first collector to read finals channel")
 
-	// Start second collector before the first one finishes to simulate a restart
 	session2 := newFakeSession()
-	done2 := make(chan struct{})
-	app.session = session2
-	app.collectorDone = done2
-	errCh2 := startCollector(t, app, done2)
+	d2, done2 := startCollector(app, session2)
 	waitForSignal(t, session2.finalsCalled, "second collector to read finals channel")
 
-	// Finish the first collector and ensure it closes its original done channel.
+	session1.finals <- whisper.Segment{Text: "first final"}
 	close(session1.finals)
-	waitForClosed(t, done1, "first collector to finish")
+	waitForSignal(t, done1, "first collector to finish")
 
 	select {
 	case <-done2:
-		t.Fatalf("second collector done channel closed unexpectedly")
+		t.Fatalf("second collector finished unexpectedly")
 	default:
 	}
 
-	// Send a final transcript through the second collector and close it.
-	session2.finals <- "second final"
+	session2.finals <- whisper.Segment{Text: "second final"}
 	close(session2.finals)
-	waitForClosed(t, done2, "second collector to finish")
+	waitForSignal(t, done2, "second collector to finish")
+
+	if d1.text() != "first final" || d2.text() != "second final" {
+		t.Fatalf("expected each dictation to keep its own finals, got %q and %q", d1.text(), d2.text())
+	}
+}
+
+func TestCollectTranscriptsDropsHallucinations(t *testing.T) {
+	app := &App{
+		cfg: &config.Config{},
+		log: zerolog.New(io.Discard),
+		filter: filter.New(config.FilterConfig{
+			DropNonSpeech:     true,
+			NoSpeechThreshold: 0.6,
+			Blocklist:         []string{"Thank you for watching."},
+		}),
+	}
+
+	session := newFakeSession()
+	d, done := startCollector(app, session)
+
+	waitForSignal(t, session.finalsCalled, "collector to read finals channel")
+
+	session.finals <- whisper.Segment{Text: "[BLANK_AUDIO]"}
+	session.finals <- whisper.Segment{Text: "thank you for watching"}
+	session.finals <- whisper.Segment{Text: "Hello there.", NoSpeechProb: 0.9}
+	session.finals <- whisper.Segment{Text: "kept"}
+	close(session.finals)
+
+	waitForSignal(t, done, "collector completion")
 
-	for i, errCh := range []<-chan error{errCh1, errCh2} {
-		if err := <-errCh; err != nil {
-			t.Fatalf("collector %d returned error: %v", i+1, err)
+	if got := d.text(); got != "kept" {
+		t.Fatalf("expected only the kept final buffered, got %q", got)
+	}
+}
+
+type fakeTranscriber struct {
+	mu      sync.Mutex
+	loaded  []string
+	started chan string
+	release chan struct{}
+
+	// transcript is returned by Transcribe, which records the model used
+	transcript  string
+	transcribed []string
+	// wake records each LoadWakeModel call
+	wake []string
+
+	// sessions are handed out by StartSession in order, then fresh ones
+	sessions []*fakeSession
+	startErr error
+	// loadErr fails LoadModel while it's set
+	loadErr error
+}
+
+func (f *fakeTranscriber) StartSession(_ whisper.SessionOpts) (whisper.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.startErr != nil {
+		return nil, f.startErr
+	}
+	if len(f.sessions) > 0 {
+		s := f.sessions[0]
+		f.sessions = f.sessions[1:]
+		return s, nil
+	}
+	return newFakeSession(), nil
+}
+
+func (f *fakeTranscriber) LoadModel(model string, _ whisper.ProgressFunc) error {
+	if f.started != nil {
+		f.started <- model
+	}
+	if f.release != nil {
+		<-f.release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.loadErr != nil {
+		return f.loadErr
+	}
+	f.loaded = append(f.loaded, model)
+	return nil
+}
+
+func (f *fakeTranscriber) LoadPartialModel(_ string, _ whisper.ProgressFunc) error { return nil }
+
+func (f *fakeTranscriber) LoadWakeModel(model string, _ whisper.ProgressFunc) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.wake = append(f.wake, model)
+	return nil
+}
+
+func (f *fakeTranscriber) Transcribe(model string, _ []float32, _ whisper.SessionOpts, _ whisper.ProgressFunc) ([]whisper.Segment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.transcribed = append(f.transcribed, model)
+	return []whisper.Segment{{Text: f.transcript}}, nil
+}
+
+func (f *fakeTranscriber) Close() error { return nil }
+
+func (f *fakeTranscriber) loadedModels() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.loaded...)
+}
+
+func TestSetModelLastSelectionWins(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("APPDATA", t.TempDir())
+
+	stt := &fakeTranscriber{
+		started: make(chan string, 4),
+		release: make(chan struct{}),
+	}
+	app := &App{
+		stt: stt,
+		cfg: &config.Config{},
+		log: zerolog.New(io.Discard),
+	}
+
+	// The first load blocks inside LoadModel while two more selections arrive
+	if err := app.SetModel("small.en"); err != nil {
+		t.Fatalf("SetModel returned error: %v", err)
+	}
+	select {
+	case <-stt.started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for first load")
+	}
+
+	if err := app.SetModel("medium.en"); err != nil {
+		t.Fatalf("SetModel returned error: %v", err)
+	}
+	if err := app.SetModel("large-v3"); err != nil {
+		t.Fatalf("SetModel returned error: %v", err)
+	}
+	close(stt.release)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(stt.loadedModels()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for loads, got %v", stt.loadedModels())
 		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond) // a superseded load must not follow
+
+	got := stt.loadedModels()
+	if len(got) != 2 || got[0] != "small.en" || got[1] != "large-v3" {
+		t.Fatalf("expected small.en then large-v3, got %v", got)
 	}
+	if app.cfg.Whisper.Model != "large-v3" {
+		t.Fatalf("expected config to hold large-v3, got %q", app.cfg.Whisper.Model)
+	}
+}
+
+// fakeStatus subscribes to the app and records, in order, what a status
+// display would show
+type fakeStatus struct {
+	sub *events.Subscription
+
+	mu      sync.Mutex
+	events  []events.Event
+	updates []string
+}
+
+func watchStatus(a *App) *fakeStatus {
+	return &fakeStatus{sub: a.Subscribe(1024, nil)}
+}
+
+// drain records the events published so far. Publishing never waits, so
+// everything published before the caller last took a.mu is queued.
+func (f *fakeStatus) drain() {
+	for {
+		select {
+		case ev := <-f.sub.Events():
+			f.events = append(f.events, ev)
+			switch ev := ev.(type) {
+			case events.StateChanged:
+				f.updates = append(f.updates, ev.Status.String())
+			case events.DraftChanged:
+				f.updates = append(f.updates, "draft: "+ev.Text)
+			case events.DictationStopped:
+				if ev.Reason != "" {
+					f.updates = append(f.updates, "auto-stopped: "+ev.Reason)
+				}
+			case events.ModelLoading:
+				f.updates = append(f.updates, fmt.Sprintf("loading %s %d/%d", ev.Model, ev.Downloaded, ev.Total))
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (f *fakeStatus) history() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.drain()
+	return append([]string(nil), f.updates...)
+}
+
+// published returns every event received so far
+func (f *fakeStatus) published() []events.Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.drain()
+	return append([]events.Event(nil), f.events...)
+}
+
+func waitForStatus(t *testing.T, f *fakeStatus, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := f.history()
+		if len(got) > 0 && got[len(got)-1] == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s shown, got %q", want, got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHotkeyRejectedUntilModelLoaded(t *testing.T) {
+	stt := &fakeTranscriber{
+		started: make(chan string, 1),
+		release: make(chan struct{}),
+	}
+	app := &App{
+		stt:    stt,
+		cfg:    &config.Config{Whisper: config.WhisperConfig{Model: "base.en"}},
+		log:    zerolog.New(io.Discard),
+		events: events.NewBus(),
+	}
+	status := watchStatus(app)
+
+	app.Start()
+	select {
+	case <-stt.started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for startup load")
+	}
+
+	// Pressed while loading: nothing starts
+	app.OnHotkey(true)
+	app.OnHotkey(false)
+	if app.IsDictating() {
+		t.Fatal("dictation started before the model was ready")
+	}
+
+	close(stt.release)
+	waitForStatus(t, status, "idle")
 
 	app.mu.Lock()
-	defer app.mu.Unlock()
+	loading := app.loading
+	app.mu.Unlock()
+	if loading {
+		t.Fatal("expected app to accept hotkeys once the model loaded")
+	}
+
+	want := []string{"loading base.en 0/0", "idle"}
+	if got := status.history(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected status updates %q, got %q", want, got)
+	}
+}
+
+func TestModelLoadFailureRetriedOnPress(t *testing.T) {
+	stt := &fakeTranscriber{loadErr: errors.New("download failed")}
+	app := &App{
+		audio:  fakeCapture{},
+		stt:    stt,
+		cfg:    &config.Config{Mode: "PushToTalk", Whisper: config.WhisperConfig{Model: "base.en"}},
+		log:    zerolog.New(io.Discard),
+		events: events.NewBus(),
+		now:    time.Now,
+	}
+	status := watchStatus(app)
 
-	if len(app.textBuffer) != 1 || app.textBuffer[0] != "second final" {
-		t.Fatalf("expected only the second final buffered, got %#v", app.textBuffer)
+	app.Start()
+	waitForState(t, app, StateError)
+	if cause, ok := errorCause(status); !ok || cause != events.CauseModel {
+		t.Fatalf("expected a model error, got %v", cause)
+	}
+	app.mu.Lock()
+	loading := app.loading
+	app.mu.Unlock()
+	if loading {
+		t.Fatal("expected loading to clear after the load failed")
+	}
+
+	// The press after a failure loads the model again instead of recording
+	stt.mu.Lock()
+	stt.loadErr = nil
+	stt.mu.Unlock()
+	app.OnHotkey(true)
+	app.OnHotkey(false)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		app.mu.Lock()
+		loading = app.loading
+		app.mu.Unlock()
+		if !loading {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the retried load")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if app.State() != StateIdle {
+		t.Fatalf("expected idle after the retried load, got %s", app.State())
+	}
+	if app.IsDictating() {
+		t.Fatal("dictation started without a model")
+	}
+	stt.mu.Lock()
+	loaded := fmt.Sprint(stt.loaded)
+	stt.mu.Unlock()
+	if loaded != "[base.en]" {
+		t.Fatalf("expected base.en loaded on retry, got %s", loaded)
+	}
+
+	// Then hotkeys work as normal
+	app.OnHotkey(true)
+	if app.State() != StateRecording {
+		t.Fatalf("expected recording once the model loaded, got %s", app.State())
+	}
+	app.OnHotkey(false)
+}
+
+// fakeInjector records injected text and erased character counts
+type fakeInjector struct {
+	mu       sync.Mutex
+	injected []string
+	erased   []int
+
+	// block, if set, holds each injection until it is closed or the
+	// context ends; err fails every injection
+	block chan struct{}
+	err   error
+}
+
+func (f *fakeInjector) Paste(ctx context.Context, text string) error {
+	if f.block != nil {
+		select {
+		case <-f.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if f.err != nil {
+		return f.err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.injected = append(f.injected, text)
+	return nil
+}
+
+func (f *fakeInjector) Type(ctx context.Context, text string) error { return f.Paste(ctx, text) }
+
+func (f *fakeInjector) PasteOrType(ctx context.Context, text string) error { return f.Paste(ctx, text) }
+
+func (f *fakeInjector) Erase(_ context.Context, n int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.erased = append(f.erased, n)
+	return nil
+}
+
+func (f *fakeInjector) texts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.injected...)
+}
+
+func TestRedoReplacesLastDictation(t *testing.T) {
+	stt := &fakeTranscriber{transcript: " kubernetes is great."}
+	inj := &fakeInjector{}
+	app := &App{
+		stt: stt,
+		inj: inj,
+		cfg: &config.Config{
+			AppendSpace: true,
+			Redo:        config.RedoConfig{Model: "large-v3", Replace: true},
+		},
+		log: zerolog.New(io.Discard),
+	}
+
+	if _, err := app.Redo(""); err == nil {
+		t.Fatal("expected an error with nothing to redo")
+	}
+
+	app.last = &recording{samples: make([]float32, 16000)}
+	app.lastInjected = "Cooper Netties is great. "
+
+	text, err := app.Redo("")
+	if err != nil {
+		t.Fatalf("Redo returned error: %v", err)
+	}
+	if text != "Kubernetes is great. " {
+		t.Fatalf("unexpected redo text %q", text)
+	}
+	if len(stt.transcribed) != 1 || stt.transcribed[0] != "large-v3" {
+		t.Fatalf("expected redo with the configured model, got %q", stt.transcribed)
+	}
+	if len(inj.erased) != 1 || inj.erased[0] != len("Cooper Netties is great. ") {
+		t.Fatalf("expected the previous text erased, got %v", inj.erased)
+	}
+	if len(inj.injected) != 1 || inj.injected[0] != text {
+		t.Fatalf("expected the new text injected, got %q", inj.injected)
+	}
+
+	// Redoing again with the same result leaves the text alone
+	if _, err := app.Redo("medium.en"); err != nil {
+		t.Fatalf("second Redo returned error: %v", err)
+	}
+	if stt.transcribed[1] != "medium.en" {
+		t.Fatalf("expected explicit model to be used, got %q", stt.transcribed)
+	}
+	if len(inj.erased) != 1 || len(inj.injected) != 1 {
+		t.Fatal("expected no erase or inject when the text is unchanged")
 	}
 }
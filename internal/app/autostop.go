@@ -0,0 +1,54 @@
+package app
+
+import (
+	"time"
+
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/vad"
+)
+
+// Reasons a dictation stops without the hotkey
+const (
+	stopSilence     = "silence"
+	stopMaxDuration = "max duration"
+)
+
+// autoStopReason says why the audio so far should end the dictation, or ""
+// to keep recording
+func autoStopReason(det *vad.Detector, limits config.AutoStopConfig) string {
+	switch {
+	case limits.MaxSeconds > 0 && det.Duration() >= time.Duration(limits.MaxSeconds)*time.Second:
+		return stopMaxDuration
+	case limits.SilenceSeconds > 0 && det.Silence() >= time.Duration(limits.SilenceSeconds*float64(time.Second)):
+		return stopSilence
+	}
+	return ""
+}
+
+// autoStop finalizes d as if the hotkey had stopped it. Silence doesn't
+// end a recording while the hotkey is held down for it.
+func (a *App) autoStop(d *dictation, reason string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.current != d || (reason == stopSilence && a.heldLocked()) {
+		return
+	}
+	a.log.Info().Int("dictation", d.id).Str("reason", reason).Msg("Auto-stopping dictation")
+	a.stopDictationLocked(reason)
+}
+
+// heldLocked reports whether the hotkey is being held for the current
+// recording, as opposed to it having been toggled or latched on
+func (a *App) heldLocked() bool {
+	if a.current != nil && a.current.handsFree {
+		return false
+	}
+	switch a.cfg.Mode {
+	case "Toggle":
+		return false
+	case "Hybrid":
+		return a.gesture.latchedAt.IsZero()
+	}
+	return true
+}
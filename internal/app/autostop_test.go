@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/petems/whisper-tray/internal/audio"
+	"github.com/petems/whisper-tray/internal/config"
+)
+
+// scriptedCapture plays samples in 100ms chunks each time it's started,
+// then runs silently until stopped. sent is closed once every chunk has
+// first been taken.
+type scriptedCapture struct {
+	samples  []float32
+	sent     chan struct{}
+	sentOnce sync.Once
+}
+
+func newScriptedCapture(samples []float32) *scriptedCapture {
+	return &scriptedCapture{samples: samples, sent: make(chan struct{})}
+}
+
+func (c *scriptedCapture) Start(ctx context.Context, _ string, _ int, out chan<- []float32) error {
+	for samples := c.samples; len(samples) > 0; {
+		n := min(1600, len(samples))
+		select {
+		case out <- samples[:n]:
+		case <-ctx.Done():
+			c.sentOnce.Do(func() { close(c.sent) })
+			return nil
+		}
+		samples = samples[n:]
+	}
+	c.sentOnce.Do(func() { close(c.sent) })
+	<-ctx.Done()
+	return nil
+}
+
+func (c *scriptedCapture) Stop() error                               { return nil }
+func (c *scriptedCapture) ListDevices() ([]audio.AudioDevice, error) { return nil, nil }
+func (c *scriptedCapture) Close() error                              { return nil }
+
+// speech is a loud square wave, plenty for the energy detector
+func speech(d time.Duration) []float32 {
+	samples := make([]float32, int(d*16000/time.Second))
+	for i := range samples {
+		if i/20%2 == 0 {
+			samples[i] = 0.3
+		} else {
+			samples[i] = -0.3
+		}
+	}
+	return samples
+}
+
+func quiet(d time.Duration) []float32 {
+	return make([]float32, int(d*16000/time.Second))
+}
+
+func TestAutoStop(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		limits  config.AutoStopConfig
+		samples []float32
+		reason  string // "" if the dictation should keep recording
+	}{
+		{
+			name:    "silence in toggle mode",
+			mode:    "Toggle",
+			limits:  config.AutoStopConfig{SilenceSeconds: 2},
+			samples: append(speech(time.Second), quiet(3*time.Second)...),
+			reason:  stopSilence,
+		},
+		{
+			name:    "pauses shorter than the limit",
+			mode:    "Toggle",
+			limits:  config.AutoStopConfig{SilenceSeconds: 2},
+			samples: append(append(speech(time.Second), quiet(time.Second)...), speech(time.Second)...),
+		},
+		{
+			name:    "silence while the hotkey is held",
+			mode:    "PushToTalk",
+			limits:  config.AutoStopConfig{SilenceSeconds: 2},
+			samples: quiet(3 * time.Second),
+		},
+		{
+			name:    "max duration while the hotkey is held",
+			mode:    "PushToTalk",
+			limits:  config.AutoStopConfig{MaxSeconds: 2},
+			samples: speech(3 * time.Second),
+			reason:  stopMaxDuration,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inj := &fakeInjector{}
+			a, status := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{released("spoken")}}, inj)
+			capture := newScriptedCapture(tt.samples)
+			a.audio = capture
+			a.cfg.Mode = tt.mode
+			a.cfg.AutoStop = tt.limits
+
+			a.OnHotkey(true)
+			if tt.mode != "Toggle" {
+				defer a.OnHotkey(false)
+			}
+
+			if tt.reason == "" {
+				waitForSignal(t, capture.sent, "audio to be captured")
+				time.Sleep(20 * time.Millisecond)
+				if a.State() != StateRecording {
+					t.Fatalf("expected to keep recording, got %s", a.State())
+				}
+				a.Cancel()
+				return
+			}
+
+			waitForState(t, a, StateIdle)
+			if got := inj.texts(); len(got) != 1 || got[0] != "Spoken" {
+				t.Fatalf("expected the dictation injected, got %q", got)
+			}
+			want := "auto-stopped: " + tt.reason
+			found := false
+			for _, s := range status.history() {
+				found = found || s == want
+			}
+			if !found {
+				t.Fatalf("expected %q reported, got %q", want, status.history())
+			}
+		})
+	}
+}
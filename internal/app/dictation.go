@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/petems/whisper-tray/internal/events"
+	"github.com/petems/whisper-tray/internal/filter"
+	"github.com/petems/whisper-tray/internal/vad"
+	"github.com/petems/whisper-tray/internal/whisper"
+	"github.com/rs/zerolog"
+)
+
+// dictation is one press-to-release recording and the work that follows
+// it. Each owns its session and transcript, so a dictation still being
+// finalized can't mix with the next one.
+type dictation struct {
+	id      int
+	session whisper.Session
+	audio   *recording
+
+	// stopCapture ends audio capture; cancel abandons the dictation,
+	// including an injection in progress
+	stopCapture context.CancelFunc
+	ctx         context.Context
+	cancel      context.CancelFunc
+
+	// det and speech belong to the capture goroutine until it closes fed.
+	// speech is set once the audio passes the gate and reaches the session.
+	det    *vad.Detector
+	speech bool
+	fed    chan struct{}
+
+	// handsFree dictations weren't started by the hotkey, so silence ends
+	// them in any mode. wakePhrase, if set, is stripped from the text.
+	handsFree  bool
+	wakePhrase string
+
+	// toDraft dictations are added to the append-mode draft, not injected
+	toDraft bool
+
+	// prevLast and prevInjected are what redo would have used had this
+	// dictation not been recorded, restored if it's discarded
+	prevLast     *recording
+	prevInjected string
+
+	// prev is closed once the dictation before this one has injected, so
+	// transcripts land in the order they were spoken
+	prev <-chan struct{}
+	done chan struct{}
+
+	mu        sync.Mutex
+	texts     []string
+	collected chan struct{}
+}
+
+func newDictation(id int, session whisper.Session, det *vad.Detector, prev <-chan struct{}) *dictation {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &dictation{
+		id:        id,
+		session:   session,
+		audio:     &recording{},
+		det:       det,
+		fed:       make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		prev:      prev,
+		done:      make(chan struct{}),
+		collected: make(chan struct{}),
+	}
+}
+
+// teardown closes the session of a dictation that won't be finished and
+// releases the dictations queued behind it. It drains the session's finals
+// itself in case the collector died, so closing can't block on them.
+func (d *dictation) teardown() {
+	defer close(d.done)
+
+	<-d.fed
+	go func() {
+		<-d.collected
+		for range d.session.Finals() {
+		}
+	}()
+	d.session.Close()
+	<-d.collected
+}
+
+// collect buffers the session's finals until its Finals channel closes,
+// publishing partials as they arrive
+func (d *dictation) collect(log zerolog.Logger, h *filter.Hallucination, streamPartials bool, bus *events.Bus) {
+	defer close(d.collected)
+
+	partials := d.session.Partials()
+	finals := d.session.Finals()
+
+	for {
+		select {
+		case partial, ok := <-partials:
+			if !ok {
+				partials = nil // Stop selecting on closed channel
+				continue
+			}
+			if streamPartials {
+				log.Debug().Str("partial", partial).Msg("Partial")
+			}
+			bus.Publish(events.Partial{ID: d.id, Text: partial})
+		case final, ok := <-finals:
+			if !ok {
+				return
+			}
+			if h != nil && !h.Keep(final) {
+				log.Info().
+					Str("final", final.Text).
+					Float64("avg_logprob", final.AvgLogProb).
+					Float64("no_speech_prob", final.NoSpeechProb).
+					Msg("Final dropped by hallucination filter")
+				continue
+			}
+			d.mu.Lock()
+			d.texts = append(d.texts, final.Text)
+			d.mu.Unlock()
+			log.Info().Str("final", final.Text).Msg("Final received and buffered")
+		}
+	}
+}
+
+// text joins the buffered finals
+func (d *dictation) text() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return strings.TrimSpace(strings.Join(d.texts, " "))
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/petems/whisper-tray/internal/events"
+)
+
+// In append mode each dictation's text is added to a draft rather than
+// injected. Committing runs the draft through the filters once and injects
+// it as a single piece of text, so fragments dictated with pauses between
+// them read as one.
+
+// OnCommitHotkey commits the append-mode draft
+func (a *App) OnCommitHotkey(pressed bool) {
+	if !pressed {
+		return
+	}
+	go func() {
+		if _, err := a.Commit(); err != nil {
+			a.log.Warn().Err(err).Msg("Commit failed")
+		}
+	}()
+}
+
+// SetAppendMode turns append mode on or off and saves the choice. A draft
+// left when it's turned off is committed.
+func (a *App) SetAppendMode(on bool) {
+	a.mu.Lock()
+	a.cfg.Append.Enabled = on
+	a.cfg.Save()
+	accel, hasDraft := a.cfg.Append.CommitHotkey, len(a.draft) > 0
+	a.mu.Unlock()
+
+	if a.hotkeys != nil && accel != "" {
+		var err error
+		if on {
+			err = a.hotkeys.Register(accel, a.OnCommitHotkey)
+		} else {
+			err = a.hotkeys.Unregister(accel)
+		}
+		if err != nil {
+			a.log.Warn().Err(err).Str("hotkey", accel).Msg("Failed to update commit hotkey")
+		}
+	}
+	if !on && hasDraft {
+		a.OnCommitHotkey(true)
+	}
+}
+
+// Draft returns the text waiting to be committed, before filtering
+func (a *App) Draft() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return strings.Join(a.draft, " ")
+}
+
+// Commit injects the draft and returns the injected text
+func (a *App) Commit() (string, error) {
+	a.mu.Lock()
+	switch {
+	case len(a.draft) == 0:
+		a.mu.Unlock()
+		return "", fmt.Errorf("nothing to commit")
+	case a.state == StateRecording || len(a.pending) > 0:
+		a.mu.Unlock()
+		return "", fmt.Errorf("still dictating")
+	}
+
+	fragments, audio := a.draft, a.draftAudio
+	text := a.applyFilters(strings.Join(fragments, " "))
+	a.clearDraftLocked()
+	a.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := a.inj.PasteOrType(ctx, text)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		// Keep the text and audio to try again, ahead of anything
+		// dictated since
+		if a.draftAudio != nil {
+			audio = joinRecordings(audio, a.draftAudio)
+		}
+		a.draftAudio = audio
+		a.draft = append(fragments, a.draft...)
+		a.reportDraftLocked()
+		a.armCommitTimerLocked()
+		a.events.Publish(events.InjectionFailed{Text: text, Err: err})
+		return "", fmt.Errorf("inject draft: %w", err)
+	}
+	a.log.Info().Str("text", text).Int("fragments", len(fragments)).Msg("Committed draft")
+	a.last, a.lastInjected = audio, text
+	a.events.Publish(events.Injected{Text: text})
+	return text, nil
+}
+
+// joinRecordings returns the audio of first followed by second
+func joinRecordings(first, second *recording) *recording {
+	joined := &recording{}
+	for _, r := range []*recording{first, second} {
+		samples, truncated := r.snapshot()
+		joined.append(samples)
+		joined.truncated = joined.truncated || truncated
+	}
+	return joined
+}
+
+// addToDraft appends a transcribed dictation to the draft in place of
+// injecting it
+func (a *App) addToDraft(d *dictation, raw string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if d.ctx.Err() != nil {
+		return
+	}
+
+	a.draft = append(a.draft, raw)
+	if a.draftAudio == nil {
+		a.draftAudio = &recording{}
+	}
+	samples, _ := d.audio.snapshot()
+	a.draftAudio.append(samples)
+
+	a.log.Info().Str("text", raw).Int("fragments", len(a.draft)).Msg("Added to draft")
+	a.fireLocked(d, EventInjected)
+	a.reportDraftLocked()
+	a.armCommitTimerLocked()
+}
+
+// armCommitTimerLocked (re)starts the countdown to committing the draft
+func (a *App) armCommitTimerLocked() {
+	if a.draftTimer != nil {
+		a.draftTimer.Stop()
+		a.draftTimer = nil
+	}
+	if a.cfg.Append.CommitSeconds <= 0 {
+		return
+	}
+
+	a.draftGen++
+	gen := a.draftGen
+	a.draftTimer = time.AfterFunc(time.Duration(a.cfg.Append.CommitSeconds*float64(time.Second)), func() {
+		a.mu.Lock()
+		if gen != a.draftGen {
+			a.mu.Unlock()
+			return
+		}
+		if a.state == StateRecording || len(a.pending) > 0 {
+			// Mid-sentence: wait for it to land in the draft
+			a.armCommitTimerLocked()
+			a.mu.Unlock()
+			return
+		}
+		a.mu.Unlock()
+
+		a.log.Info().Msg("Committing draft after timeout")
+		if _, err := a.Commit(); err != nil {
+			a.log.Warn().Err(err).Msg("Commit failed")
+		}
+	})
+}
+
+func (a *App) clearDraftLocked() {
+	a.draft, a.draftAudio = nil, nil
+	a.draftGen++
+	if a.draftTimer != nil {
+		a.draftTimer.Stop()
+		a.draftTimer = nil
+	}
+	a.reportDraftLocked()
+}
+
+func (a *App) reportDraftLocked() {
+	a.events.Publish(events.DraftChanged{Text: strings.Join(a.draft, " ")})
+}
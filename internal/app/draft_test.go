@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newAppendTestApp(sessions ...*fakeSession) (*App, *fakeInjector, *fakeStatus) {
+	inj := &fakeInjector{}
+	a, status := newStateTestApp(&fakeTranscriber{sessions: sessions}, inj)
+	a.cfg.Append.Enabled = true
+	return a, inj, status
+}
+
+// dictate records and finishes one push-to-talk dictation
+func dictate(t *testing.T, a *App) {
+	t.Helper()
+	a.OnHotkey(true)
+	a.OnHotkey(false)
+	waitForState(t, a, StateIdle)
+}
+
+func TestAppendModeCollectsDraft(t *testing.T) {
+	a, inj, status := newAppendTestApp(released("hello there"), released("how are you"))
+
+	dictate(t, a)
+	dictate(t, a)
+
+	if got := inj.texts(); len(got) != 0 {
+		t.Fatalf("expected nothing injected before committing, got %q", got)
+	}
+	if got := a.Draft(); got != "hello there how are you" {
+		t.Fatalf("expected both dictations in the draft, got %q", got)
+	}
+	if got := status.history(); got[len(got)-1] != "draft: hello there how are you" {
+		t.Fatalf("expected the draft shown, got %q", got)
+	}
+
+	text, err := a.Commit()
+	if err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if got := inj.texts(); len(got) != 1 || got[0] != "Hello there how are you" || text != got[0] {
+		t.Fatalf("expected the draft injected once, got %q", got)
+	}
+	if a.Draft() != "" {
+		t.Fatalf("expected the draft cleared, got %q", a.Draft())
+	}
+	if a.last == nil || a.lastInjected != "Hello there how are you" {
+		t.Fatal("expected redo to target the committed draft")
+	}
+
+	if _, err := a.Commit(); err == nil {
+		t.Fatal("expected an error committing an empty draft")
+	}
+}
+
+func TestAppendModeCommitsAfterTimeout(t *testing.T) {
+	a, inj, _ := newAppendTestApp(released("later"))
+	a.cfg.Append.CommitSeconds = 0.05
+
+	dictate(t, a)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(inj.texts()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the draft to be committed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := inj.texts(); got[0] != "Later" {
+		t.Fatalf("expected the draft injected, got %q", got)
+	}
+}
+
+// flakyInjector fails its first injection, then injects normally
+type flakyInjector struct {
+	*fakeInjector
+	failed bool
+}
+
+func (f *flakyInjector) PasteOrType(ctx context.Context, text string) error {
+	f.mu.Lock()
+	first := !f.failed
+	f.failed = true
+	f.mu.Unlock()
+	if first {
+		return errors.New("no focused window")
+	}
+	return f.fakeInjector.PasteOrType(ctx, text)
+}
+
+func TestAppendModeRetriesFailedCommit(t *testing.T) {
+	a, inj, _ := newAppendTestApp(released("again"))
+	flaky := &flakyInjector{fakeInjector: inj}
+	a.inj = flaky
+	a.cfg.Append.CommitSeconds = 0.05
+
+	dictate(t, a)
+
+	// The first timed commit fails and keeps the draft; the timer is armed
+	// again so the next one lands it
+	deadline := time.Now().Add(2 * time.Second)
+	for len(inj.texts()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the draft to be committed on retry")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := inj.texts(); got[0] != "Again" {
+		t.Fatalf("expected the draft injected, got %q", got)
+	}
+	if a.Draft() != "" {
+		t.Fatalf("expected the draft cleared, got %q", a.Draft())
+	}
+}
+
+func TestFailedCommitKeepsAudioAheadOfNewDictation(t *testing.T) {
+	a, inj, _ := newAppendTestApp(released("first"), released("second"))
+	record := func() {
+		a.audio = newScriptedCapture(speech(100 * time.Millisecond))
+		a.OnHotkey(true)
+		waitForCaptured(t, a, 1600)
+		a.OnHotkey(false)
+		waitForState(t, a, StateIdle)
+	}
+
+	record()
+
+	// Dictate again while the commit's paste is still in flight, then fail it
+	inj.block, inj.err = make(chan struct{}), errors.New("no focused window")
+	errs := make(chan error, 1)
+	go func() {
+		_, err := a.Commit()
+		errs <- err
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for a.Draft() != "" {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the commit to take the draft")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	record()
+	close(inj.block)
+	if err := <-errs; err == nil {
+		t.Fatal("expected the commit to fail")
+	}
+
+	if got := a.Draft(); got != "first second" {
+		t.Fatalf("expected both dictations kept in order, got %q", got)
+	}
+	a.mu.Lock()
+	samples, _ := a.draftAudio.snapshot()
+	a.mu.Unlock()
+	if len(samples) != 2*1600 {
+		t.Fatalf("expected the audio of both dictations kept, got %d samples", len(samples))
+	}
+}
+
+func TestAppendModeOffCommitsDraft(t *testing.T) {
+	// Turning append mode off saves the config
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("APPDATA", t.TempDir())
+	a, inj, _ := newAppendTestApp(released("leftover"))
+
+	dictate(t, a)
+	a.SetAppendMode(false)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(inj.texts()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the leftover draft to be committed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := inj.texts(); got[0] != "Leftover" {
+		t.Fatalf("expected the leftover draft injected, got %q", got)
+	}
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+	"github.com/petems/whisper-tray/internal/events"
+	"github.com/petems/whisper-tray/internal/supervise"
+)
+
+// failDictation abandons d after something the normal flow can't report
+// broke it: the microphone failing to start, or one of its goroutines
+// panicking. Its session is torn down and the app shows the error.
+func (a *App) failDictation(d *dictation, cause events.Cause, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if d.ctx.Err() != nil {
+		// Already cancelled or finished
+		return
+	}
+	a.log.Error().Err(err).Int("dictation", d.id).Stringer("cause", cause).Msg("Dictation failed")
+
+	// finish notices the cancellation and skips injecting
+	d.cancel()
+	if a.current == d {
+		a.current = nil
+		d.stopCapture()
+		go supervise.Run(a.log, "teardown", d.teardown, nil)
+	}
+	if a.last == d.audio {
+		a.last, a.lastInjected = d.prevLast, d.prevInjected
+	}
+	if a.fireLocked(d, EventFailed) {
+		a.events.Publish(events.Error{Cause: cause, Err: err})
+	}
+}
+
+// ReportPanic shows a panic recovered outside the app, such as in the tray,
+// as an error
+func (a *App) ReportPanic(p *supervise.Panic) {
+	a.events.Publish(events.Error{Cause: events.CausePanic, Err: p})
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/petems/whisper-tray/internal/audio"
+	"github.com/petems/whisper-tray/internal/events"
+)
+
+// brokenCapture fails to start with err, or panics if err is nil. With
+// gate set it only fails once gate is closed.
+type brokenCapture struct {
+	err  error
+	gate chan struct{}
+}
+
+func (c brokenCapture) Start(context.Context, string, int, chan<- []float32) error {
+	if c.gate != nil {
+		<-c.gate
+	}
+	if c.err != nil {
+		return c.err
+	}
+	panic("stream callback on a closed device")
+}
+
+func (brokenCapture) Stop() error                               { return nil }
+func (brokenCapture) ListDevices() ([]audio.AudioDevice, error) { return nil, nil }
+func (brokenCapture) Close() error                              { return nil }
+
+// panickyInjector panics on its first injection, then injects normally
+type panickyInjector struct {
+	*fakeInjector
+	panicked bool
+}
+
+func (f *panickyInjector) PasteOrType(ctx context.Context, text string) error {
+	f.mu.Lock()
+	first := !f.panicked
+	f.panicked = true
+	f.mu.Unlock()
+	if first {
+		panic("nil event source")
+	}
+	return f.fakeInjector.PasteOrType(ctx, text)
+}
+
+func TestCaptureFailureFailsDictation(t *testing.T) {
+	tests := []struct {
+		name    string
+		capture audio.Capture
+		cause   events.Cause
+	}{
+		{"audio error", brokenCapture{err: errors.New("device unplugged")}, events.CauseAudio},
+		{"panic", brokenCapture{}, events.CausePanic},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, status := newStateTestApp(&fakeTranscriber{}, &fakeInjector{})
+			a.audio = tt.capture
+
+			a.OnHotkey(true)
+			waitForState(t, a, StateError)
+			if cause, ok := errorCause(status); !ok || cause != tt.cause {
+				t.Fatalf("expected a %s error published, got %v", tt.cause, cause)
+			}
+
+			// The session is torn down, releasing anything queued behind it
+			a.mu.Lock()
+			d := a.latest
+			a.mu.Unlock()
+			waitForSignal(t, d.done, "the failed dictation to be torn down")
+
+			// Releasing the key does nothing; the next press starts over
+			a.OnHotkey(false)
+			if a.State() != StateError {
+				t.Fatalf("expected the error to stay shown, got %s", a.State())
+			}
+			a.audio = fakeCapture{}
+			a.OnHotkey(true)
+			waitForState(t, a, StateRecording)
+		})
+	}
+}
+
+func TestCaptureFailureReleasesCancelHotkey(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"audio error", errors.New("device unplugged")},
+		{"panic", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newStateTestApp(&fakeTranscriber{}, &fakeInjector{})
+			gate := make(chan struct{})
+			a.audio = brokenCapture{err: tt.err, gate: gate}
+			keys := &fakeHotkeys{}
+			a.hotkeys = keys
+			a.cfg.CancelHotkey = "Escape"
+
+			a.OnHotkey(true)
+			waitForHotkey(t, keys, "Escape", true)
+
+			// Escape must not stay grabbed once recording has failed
+			close(gate)
+			waitForState(t, a, StateError)
+			waitForHotkey(t, keys, "Escape", false)
+		})
+	}
+}
+
+func TestInjectionPanicFailsDictation(t *testing.T) {
+	inj := &panickyInjector{fakeInjector: &fakeInjector{}}
+	stt := &fakeTranscriber{sessions: []*fakeSession{released("first"), released("second")}}
+	a, status := newStateTestApp(stt, &fakeInjector{})
+	a.inj = inj
+
+	a.OnHotkey(true)
+	a.OnHotkey(false)
+	waitForState(t, a, StateError)
+	if cause, ok := errorCause(status); !ok || cause != events.CausePanic {
+		t.Fatalf("expected a panic error published, got %v", cause)
+	}
+
+	a.OnHotkey(true)
+	a.OnHotkey(false)
+	waitForState(t, a, StateIdle)
+	if got := inj.texts(); fmt.Sprint(got) != "[Second]" {
+		t.Fatalf("expected the next dictation injected, got %q", got)
+	}
+}
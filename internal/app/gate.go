@@ -0,0 +1,50 @@
+package app
+
+import (
+	"time"
+
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/vad"
+)
+
+// gateOpen reports whether the audio so far is long and loud enough to be
+// worth transcribing
+func gateOpen(det *vad.Detector, gate config.GateConfig) bool {
+	return det.Duration() >= time.Duration(gate.MinMs)*time.Millisecond &&
+		det.Voiced() >= time.Duration(gate.MinSpeechMs)*time.Millisecond
+}
+
+// feed passes samples on to the session once the dictation has passed the
+// gate. Until then they're only kept in the recording, and the whole
+// recording goes to the session when the gate opens.
+func (d *dictation) feed(samples []float32, gate config.GateConfig) error {
+	if d.speech {
+		return d.session.Feed(samples)
+	}
+	if !gateOpen(d.det, gate) {
+		return nil
+	}
+	d.speech = true
+	all, _ := d.audio.snapshot()
+	return d.session.Feed(all)
+}
+
+// discard ends a dictation that never passed the gate without injecting
+// anything, and puts back the recording redo had before it
+func (a *App) discard(d *dictation) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.last == d.audio {
+		a.last, a.lastInjected = d.prevLast, d.prevInjected
+	}
+	if d.ctx.Err() != nil {
+		return
+	}
+	a.log.Info().
+		Int("dictation", d.id).
+		Dur("duration", d.det.Duration()).
+		Dur("voiced", d.det.Voiced()).
+		Msg("Discarding dictation without speech")
+	a.fireLocked(d, EventNoSpeech)
+}
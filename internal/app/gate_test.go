@@ -0,0 +1,80 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/petems/whisper-tray/internal/config"
+)
+
+// waitForCaptured waits until the dictation being recorded holds n samples
+func waitForCaptured(t *testing.T, a *App, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		a.mu.Lock()
+		got := 0
+		if a.current != nil {
+			samples, _ := a.current.audio.snapshot()
+			got = len(samples)
+		}
+		a.mu.Unlock()
+		if got >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d samples, have %d", n, got)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGate(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []float32
+		kept    bool
+	}{
+		{"short tap", speech(200 * time.Millisecond), false},
+		{"no speech", quiet(2 * time.Second), false},
+		{"speech after a pause", append(quiet(time.Second), speech(500*time.Millisecond)...), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := released("spoken")
+			inj := &fakeInjector{}
+			a, _ := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{session}}, inj)
+			a.audio = newScriptedCapture(tt.samples)
+			a.cfg.Gate = config.GateConfig{MinMs: 300, MinSpeechMs: 100}
+			earlier := &recording{samples: make([]float32, 16000)}
+			a.last, a.lastInjected = earlier, "Earlier text "
+
+			a.OnHotkey(true)
+			waitForCaptured(t, a, len(tt.samples))
+			a.OnHotkey(false)
+			waitForState(t, a, StateIdle)
+
+			if !tt.kept {
+				if n := session.samplesFed(); n != 0 {
+					t.Fatalf("expected no audio sent to whisper, got %d samples", n)
+				}
+				if got := inj.texts(); len(got) != 0 {
+					t.Fatalf("expected nothing injected, got %q", got)
+				}
+				if a.last != earlier || a.lastInjected != "Earlier text " {
+					t.Fatal("expected redo to still target the earlier dictation")
+				}
+				return
+			}
+
+			// The audio held back before the gate opened is sent too
+			if n := session.samplesFed(); n != len(tt.samples) {
+				t.Fatalf("expected all %d samples sent to whisper, got %d", len(tt.samples), n)
+			}
+			if got := inj.texts(); len(got) != 1 || got[0] != "Spoken" {
+				t.Fatalf("expected the dictation injected, got %q", got)
+			}
+		})
+	}
+}
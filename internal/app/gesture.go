@@ -0,0 +1,84 @@
+package app
+
+import "time"
+
+// Hybrid mode reads the hotkey by how it's pressed. Holding it records until
+// release, like push-to-talk. A short tap latches recording on until the next
+// press, like toggle. A second tap soon after a latching tap is a double tap:
+// it discards the latched recording and runs gestures.double_tap instead.
+
+// gesture tracks hotkey timing in Hybrid mode. Guarded by App.mu.
+type gesture struct {
+	pressedAt time.Time // when the press that started recording went down
+	latchedAt time.Time // when the tap latching recording on was released; zero if not latched
+	ignoreUp  bool      // the next release belongs to a press already acted on
+}
+
+func (a *App) onHybridHotkeyLocked(pressed bool) {
+	now := a.now()
+	g := &a.gesture
+	recording := a.state == StateRecording
+
+	if !pressed {
+		if g.ignoreUp || !recording || !g.latchedAt.IsZero() {
+			g.ignoreUp = false
+			return
+		}
+		if now.Sub(g.pressedAt) < time.Duration(a.cfg.Gestures.TapMs)*time.Millisecond {
+			a.log.Debug().Msg("Tap latched recording on")
+			g.latchedAt = now
+			return
+		}
+		a.stopDictationLocked("")
+		return
+	}
+
+	if !recording {
+		*g = gesture{pressedAt: now}
+		a.startDictationLocked(nil)
+		return
+	}
+
+	// Recording with the key up means a tap latched it on
+	latchedAt := g.latchedAt
+	*g = gesture{ignoreUp: true}
+	if a.cfg.Gestures.DoubleTap != "" &&
+		now.Sub(latchedAt) < time.Duration(a.cfg.Gestures.DoubleTapMs)*time.Millisecond {
+		a.doubleTapLocked()
+		return
+	}
+	a.stopDictationLocked("")
+}
+
+// doubleTapLocked drops the recording the first tap started and runs the
+// configured double-tap action
+func (a *App) doubleTapLocked() {
+	action := a.cfg.Gestures.DoubleTap
+	a.log.Info().Str("action", action).Msg("Double tap")
+	d := a.current
+	a.cancelLocked()
+
+	switch action {
+	case "redo":
+		go a.redoAfter(d)
+	case "cancel":
+		// Cancelling above was the whole action
+	default:
+		a.log.Warn().Str("action", action).Msg("Unknown double-tap action")
+	}
+}
+
+// redoAfter redoes the last dictation once d, the recording just dropped,
+// is torn down and the dictations queued ahead of it are done, since redo
+// refuses to run while anything is still dictating
+func (a *App) redoAfter(d *dictation) {
+	if d != nil {
+		if d.prev != nil {
+			<-d.prev
+		}
+		<-d.done
+	}
+	if _, err := a.Redo(""); err != nil {
+		a.log.Warn().Err(err).Msg("Redo failed")
+	}
+}
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func newHybridTestApp(stt *fakeTranscriber, inj *fakeInjector) (*App, *fakeClock) {
+	a, _ := newStateTestApp(stt, inj)
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	a.now = clock.now
+	a.cfg.Mode = "Hybrid"
+	a.cfg.Gestures.TapMs = 300
+	a.cfg.Gestures.DoubleTapMs = 400
+	a.cfg.Redo.Model = "large-v3"
+	return a, clock
+}
+
+func released(text string) *fakeSession {
+	s := sessionWith(text)
+	close(s.release)
+	return s
+}
+
+func TestHybridHoldIsPushToTalk(t *testing.T) {
+	inj := &fakeInjector{}
+	a, clock := newHybridTestApp(&fakeTranscriber{sessions: []*fakeSession{released("held")}}, inj)
+
+	a.OnHotkey(true)
+	clock.advance(time.Second)
+	a.OnHotkey(false)
+	waitForState(t, a, StateIdle)
+
+	if got := inj.texts(); len(got) != 1 || got[0] != "Held" {
+		t.Fatalf("expected the held dictation injected, got %q", got)
+	}
+}
+
+func TestHybridTapLatches(t *testing.T) {
+	inj := &fakeInjector{}
+	a, clock := newHybridTestApp(&fakeTranscriber{sessions: []*fakeSession{released("latched")}}, inj)
+
+	a.OnHotkey(true)
+	clock.advance(100 * time.Millisecond)
+	a.OnHotkey(false)
+	if a.State() != StateRecording {
+		t.Fatalf("expected a tap to keep recording, got %s", a.State())
+	}
+
+	// A press after the double-tap window stops recording; its release
+	// mustn't start anything
+	clock.advance(5 * time.Second)
+	a.OnHotkey(true)
+	clock.advance(100 * time.Millisecond)
+	a.OnHotkey(false)
+	waitForState(t, a, StateIdle)
+
+	if got := inj.texts(); len(got) != 1 || got[0] != "Latched" {
+		t.Fatalf("expected the latched dictation injected, got %q", got)
+	}
+}
+
+func TestHybridDoubleTap(t *testing.T) {
+	doubleTap := func(a *App, clock *fakeClock) {
+		a.OnHotkey(true)
+		clock.advance(100 * time.Millisecond)
+		a.OnHotkey(false)
+		clock.advance(200 * time.Millisecond)
+		a.OnHotkey(true)
+		clock.advance(100 * time.Millisecond)
+		a.OnHotkey(false)
+	}
+
+	t.Run("redo", func(t *testing.T) {
+		stt := &fakeTranscriber{sessions: []*fakeSession{released("discarded")}, transcript: "redone"}
+		inj := &fakeInjector{}
+		a, clock := newHybridTestApp(stt, inj)
+		a.cfg.Gestures.DoubleTap = "redo"
+		a.last = &recording{samples: make([]float32, 16000)}
+
+		doubleTap(a, clock)
+		waitForState(t, a, StateIdle)
+
+		deadline := time.Now().Add(2 * time.Second)
+		for len(inj.texts()) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the redo")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if got := inj.texts(); len(got) != 1 || got[0] != "Redone" {
+			t.Fatalf("expected only the redo injected, got %q", got)
+		}
+	})
+
+	t.Run("redo waits for earlier dictations", func(t *testing.T) {
+		earlier := sessionWith("earlier")
+		stt := &fakeTranscriber{sessions: []*fakeSession{earlier, released("discarded")}, transcript: "redone"}
+		inj := &fakeInjector{}
+		a, clock := newHybridTestApp(stt, inj)
+		a.cfg.Gestures.DoubleTap = "redo"
+
+		// A held dictation is still transcribing when the double tap comes
+		a.OnHotkey(true)
+		clock.advance(time.Second)
+		a.OnHotkey(false)
+		waitForState(t, a, StateFinalizing)
+		doubleTap(a, clock)
+		time.Sleep(20 * time.Millisecond)
+		close(earlier.release)
+
+		deadline := time.Now().Add(2 * time.Second)
+		for len(inj.texts()) < 2 {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for the redo, got %q", inj.texts())
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if got := inj.texts(); got[0] != "Earlier" || got[1] != "Redone" {
+			t.Fatalf("expected the earlier dictation then its redo, got %q", got)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		inj := &fakeInjector{}
+		a, clock := newHybridTestApp(&fakeTranscriber{sessions: []*fakeSession{released("discarded")}}, inj)
+		a.cfg.Gestures.DoubleTap = "cancel"
+
+		doubleTap(a, clock)
+		waitForState(t, a, StateIdle)
+
+		time.Sleep(20 * time.Millisecond)
+		if got := inj.texts(); len(got) != 0 {
+			t.Fatalf("expected nothing injected, got %q", got)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		inj := &fakeInjector{}
+		a, clock := newHybridTestApp(&fakeTranscriber{sessions: []*fakeSession{released("kept")}}, inj)
+		a.cfg.Gestures.DoubleTap = ""
+
+		doubleTap(a, clock)
+		waitForState(t, a, StateIdle)
+
+		if got := inj.texts(); len(got) != 1 || got[0] != "Kept" {
+			t.Fatalf("expected the second tap to stop and inject, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/petems/whisper-tray/internal/events"
+	"github.com/petems/whisper-tray/internal/supervise"
+	"github.com/petems/whisper-tray/internal/vad"
+	"github.com/petems/whisper-tray/internal/whisper"
+)
+
+// listenPreRoll is audio kept from before each utterance so its first
+// syllable isn't clipped
+const listenPreRoll = 300 * time.Millisecond
+
+// listener is hands-free listening in progress. Capture runs until stop is
+// called; done is closed once the last utterance has been delivered.
+type listener struct {
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// OnListenHotkey toggles hands-free listening
+func (a *App) OnListenHotkey(pressed bool) {
+	if !pressed {
+		return
+	}
+	if a.Listening() {
+		a.StopListening()
+		return
+	}
+	if err := a.StartListening(); err != nil {
+		a.log.Warn().Err(err).Msg("Can't start listening")
+	}
+}
+
+// Listening reports whether hands-free listening is on
+func (a *App) Listening() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.listener != nil
+}
+
+// StartListening captures continuously and transcribes each utterance when
+// the speaker pauses. The dictation hotkey is ignored until StopListening.
+func (a *App) StartListening() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case a.listener != nil:
+		return nil
+	case a.loading:
+		return fmt.Errorf("model is still loading")
+	case a.state == StateRecording || len(a.pending) > 0 || a.redoing:
+		return fmt.Errorf("busy dictating")
+	}
+
+	a.pauseWakeLocked()
+	ctx, stop := context.WithCancel(context.Background())
+	l := &listener{stop: stop, done: make(chan struct{})}
+	a.listener = l
+	a.reportStateLocked()
+	go supervise.Run(a.log, "listen", func() { a.listen(ctx, l) }, func(p *supervise.Panic) {
+		a.failListening(l, events.CausePanic, p)
+	})
+	return nil
+}
+
+// StopListening ends hands-free listening. Speech already captured is
+// still transcribed and delivered. It reports whether listening was on.
+func (a *App) StopListening() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stopListeningLocked(a.listener)
+}
+
+func (a *App) stopListeningLocked(l *listener) bool {
+	if l == nil || a.listener != l {
+		return false
+	}
+	l.stop()
+	a.listener = nil
+	a.reportStateLocked()
+	return true
+}
+
+// listen segments captured audio into utterances and hands them, in order,
+// to a worker that transcribes and delivers them
+func (a *App) listen(ctx context.Context, l *listener) {
+	defer close(l.done)
+
+	a.mu.Lock()
+	cfg := a.cfg.Listen
+	// Speech is told from silence the same way as when dictating
+	seg := vad.NewSegmenter(16000, vad.SegmenterOptions{
+		Threshold: a.cfg.AutoStop.SilenceThreshold,
+		Pause:     time.Duration(cfg.PauseMs) * time.Millisecond,
+		PreRoll:   listenPreRoll,
+		MinSpeech: time.Duration(a.cfg.Gate.MinSpeechMs) * time.Millisecond,
+		Max:       time.Duration(cfg.MaxSeconds) * time.Second,
+	})
+	device := a.cfg.Audio.DeviceID
+	a.mu.Unlock()
+
+	a.log.Info().Msg("Listening hands-free")
+
+	audioChan := make(chan []float32, 8)
+	go supervise.Run(a.log, "listen capture", func() {
+		if err := a.audio.Start(ctx, device, 16000, audioChan); err != nil {
+			a.failListening(l, events.CauseAudio, err)
+		}
+	}, func(p *supervise.Panic) {
+		a.failListening(l, events.CausePanic, p)
+	})
+
+	// A panic delivering one utterance doesn't stop the ones after it
+	utterances := make(chan []float32, 4)
+	delivered := make(chan struct{})
+	go func() {
+		defer close(delivered)
+		for u := range utterances {
+			supervise.Run(a.log, "utterance", func() { a.deliverUtterance(u, cfg.OutputFile) }, a.ReportPanic)
+		}
+	}()
+	defer func() {
+		close(utterances)
+		<-delivered
+		a.log.Info().Msg("Stopped listening")
+	}()
+
+	for capturing := true; capturing; {
+		select {
+		case <-ctx.Done():
+			capturing = false
+		case samples, ok := <-audioChan:
+			if !ok {
+				capturing = false
+				break
+			}
+			for _, u := range seg.Feed(samples) {
+				utterances <- u
+			}
+		}
+	}
+	if u := seg.Flush(); u != nil {
+		utterances <- u
+	}
+}
+
+// failListening stops listening l when it can't carry on, and shows why
+func (a *App) failListening(l *listener, cause events.Cause, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.log.Error().Err(err).Stringer("cause", cause).Msg("Listening failed")
+	if a.stopListeningLocked(l) {
+		a.events.Publish(events.Error{Cause: cause, Err: err})
+	}
+}
+
+// deliverUtterance transcribes one utterance and injects the text, or
+// appends it to outputFile if that's set
+func (a *App) deliverUtterance(samples []float32, outputFile string) {
+	a.mu.Lock()
+	opts := a.sessionOpts()
+	a.mu.Unlock()
+
+	segments, err := a.transcribeSamples(samples, opts)
+	if err != nil {
+		a.log.Error().Err(err).Msg("Transcription failed")
+	}
+
+	text := a.applyFilters(a.segmentsText(segments))
+	if strings.TrimSpace(text) == "" {
+		a.log.Debug().Msg("Utterance had no text")
+		return
+	}
+	a.events.Publish(events.Final{Text: text})
+
+	if outputFile != "" {
+		err = appendLine(outputFile, strings.TrimSpace(text))
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = a.inj.PasteOrType(ctx, text)
+		cancel()
+		if err != nil {
+			a.events.Publish(events.InjectionFailed{Text: text, Err: err})
+		} else {
+			a.events.Publish(events.Injected{Text: text})
+		}
+	}
+	if err != nil {
+		a.log.Error().Err(err).Msg("Failed to deliver utterance")
+		return
+	}
+	a.log.Info().Str("text", text).Msg("Utterance delivered")
+}
+
+// segmentsText joins the segments the hallucination filter keeps
+func (a *App) segmentsText(segments []whisper.Segment) string {
+	texts := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		if a.filter == nil || a.filter.Keep(seg) {
+			texts = append(texts, seg.Text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(texts, " "))
+}
+
+// transcribeSamples runs samples through a session of their own
+func (a *App) transcribeSamples(samples []float32, opts whisper.SessionOpts) ([]whisper.Segment, error) {
+	session, err := a.stt.StartSession(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []whisper.Segment
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for seg := range session.Finals() {
+			segments = append(segments, seg)
+		}
+	}()
+
+	feedErr := session.Feed(samples)
+	closeErr := session.Close()
+	<-collected
+	if feedErr != nil {
+		return segments, feedErr
+	}
+	return segments, closeErr
+}
+
+func appendLine(path, line string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
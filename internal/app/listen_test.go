@@ -0,0 +1,100 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newListenTestApp(samples []float32, sessions ...*fakeSession) (*App, *fakeInjector, *fakeStatus, *scriptedCapture) {
+	inj := &fakeInjector{}
+	a, status := newStateTestApp(&fakeTranscriber{sessions: sessions}, inj)
+	capture := newScriptedCapture(samples)
+	a.audio = capture
+	a.cfg.Listen.PauseMs = 600
+	a.cfg.Listen.MaxSeconds = 30
+	return a, inj, status, capture
+}
+
+func TestListeningInjectsEachUtterance(t *testing.T) {
+	var samples []float32
+	for i := 0; i < 2; i++ {
+		samples = append(samples, speech(510*time.Millisecond)...)
+		samples = append(samples, quiet(990*time.Millisecond)...)
+	}
+	a, inj, status, capture := newListenTestApp(samples, released("first"), released("second"))
+
+	if err := a.StartListening(); err != nil {
+		t.Fatalf("StartListening: %v", err)
+	}
+	if got := status.history(); len(got) == 0 || got[len(got)-1] != "listening" {
+		t.Fatalf("expected listening shown, got %q", got)
+	}
+
+	a.OnHotkey(true)
+	a.OnHotkey(false)
+	if a.State() != StateIdle {
+		t.Fatalf("expected the hotkey ignored while listening, got %s", a.State())
+	}
+
+	waitForSignal(t, capture.sent, "audio to be captured")
+	deadline := time.Now().Add(2 * time.Second)
+	for len(inj.texts()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for utterances, got %q", inj.texts())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := inj.texts(); got[0] != "First" || got[1] != "Second" {
+		t.Fatalf("expected utterances in order, got %q", got)
+	}
+
+	if !a.StopListening() || a.Listening() {
+		t.Fatal("expected listening to stop")
+	}
+	if got := status.history(); got[len(got)-1] != "idle" {
+		t.Fatalf("expected idle shown after listening, got %q", got)
+	}
+}
+
+func TestListeningFlushesOnStop(t *testing.T) {
+	// Still speaking when listening is turned off
+	a, inj, _, capture := newListenTestApp(speech(time.Second), released("unfinished"))
+	out := filepath.Join(t.TempDir(), "notes.txt")
+	a.cfg.Listen.OutputFile = out
+
+	if err := a.StartListening(); err != nil {
+		t.Fatalf("StartListening: %v", err)
+	}
+	waitForSignal(t, capture.sent, "audio to be captured")
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := a.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("reading output: %v", err)
+	}
+	if string(data) != "Unfinished\n" {
+		t.Fatalf("expected the utterance appended, got %q", data)
+	}
+	if got := inj.texts(); len(got) != 0 {
+		t.Fatalf("expected nothing injected with an output file, got %q", got)
+	}
+}
+
+func TestListeningRefusedWhileDictating(t *testing.T) {
+	a, _, _, _ := newListenTestApp(nil)
+
+	a.OnHotkey(true)
+	if err := a.StartListening(); err == nil {
+		t.Fatal("expected listening refused while recording")
+	}
+	a.Cancel()
+}
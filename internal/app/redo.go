@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/petems/whisper-tray/internal/events"
+	"github.com/petems/whisper-tray/internal/whisper"
+)
+
+// maxRecording caps the audio kept for redo at ten minutes (about 38 MB)
+const maxRecording = 16000 * 60 * 10
+
+// recording is the audio of one dictation, kept so it can be re-transcribed
+type recording struct {
+	mu        sync.Mutex
+	samples   []float32
+	truncated bool
+	// phrase is the wake phrase the audio opens with, stripped from any
+	// transcript of it
+	phrase string
+}
+
+func (r *recording) append(samples []float32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.samples)+len(samples) > maxRecording {
+		r.truncated = true
+		return
+	}
+	r.samples = append(r.samples, samples...)
+}
+
+func (r *recording) snapshot() ([]float32, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.samples, r.truncated
+}
+
+// OnRedoHotkey redoes the last dictation with the configured redo model
+func (a *App) OnRedoHotkey(pressed bool) {
+	if !pressed {
+		return
+	}
+	go func() {
+		if _, err := a.Redo(""); err != nil {
+			a.log.Warn().Err(err).Msg("Redo failed")
+		}
+	}()
+}
+
+// Redo re-runs the last dictation's audio through model, or the configured
+// redo model if it's empty, and injects the result. With redo.replace set
+// the text injected last time is erased first. Blocks until done and
+// returns the new text.
+func (a *App) Redo(model string) (string, error) {
+	a.mu.Lock()
+	switch {
+	case a.loading:
+		a.mu.Unlock()
+		return "", fmt.Errorf("model is still loading")
+	case a.state == StateRecording || len(a.pending) > 0 || a.redoing || a.listener != nil:
+		a.mu.Unlock()
+		return "", fmt.Errorf("busy dictating")
+	case a.last == nil:
+		a.mu.Unlock()
+		return "", fmt.Errorf("nothing to redo yet")
+	}
+
+	samples, truncated := a.last.snapshot()
+	if truncated {
+		a.mu.Unlock()
+		return "", fmt.Errorf("last dictation was too long to keep for redo")
+	}
+	if model == "" {
+		model = a.cfg.Redo.Model
+	}
+	phrase := a.last.phrase
+	previous := a.lastInjected
+	opts := a.sessionOpts()
+	a.redoing = true
+	a.reportStateLocked()
+	a.mu.Unlock()
+
+	a.log.Info().Str("model", model).Float64("duration_sec", float64(len(samples))/16000).Msg("Redoing last dictation")
+	text, err := a.redo(model, samples, phrase, previous, opts)
+
+	a.mu.Lock()
+	a.redoing = false
+	if err == nil {
+		a.lastInjected = text
+		a.reportStateLocked()
+		if text != previous {
+			a.events.Publish(events.Injected{Text: text})
+		}
+	} else {
+		a.events.Publish(events.Error{Cause: events.CauseRedo, Err: err})
+	}
+	a.mu.Unlock()
+
+	return text, err
+}
+
+func (a *App) redo(model string, samples []float32, phrase, previous string, opts whisper.SessionOpts) (string, error) {
+	segments, err := a.stt.Transcribe(model, samples, opts, a.loadProgress(model))
+	if err != nil {
+		return "", err
+	}
+
+	var texts []string
+	for _, seg := range segments {
+		if a.filter != nil && !a.filter.Keep(seg) {
+			continue
+		}
+		texts = append(texts, strings.TrimSpace(seg.Text))
+	}
+	raw := strings.TrimSpace(strings.Join(texts, " "))
+	if phrase != "" {
+		raw, _ = stripPhrase(raw, phrase)
+	}
+	text := a.applyFilters(raw)
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("%s heard no speech in the last dictation", model)
+	}
+	if text == previous {
+		a.log.Info().Str("model", model).Msg("Redo produced the same text")
+		return text, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if a.cfg.Redo.Replace && previous != "" {
+		if err := a.inj.Erase(ctx, utf8.RuneCountInString(previous)); err != nil {
+			return "", fmt.Errorf("failed to erase previous text: %w", err)
+		}
+	}
+	if err := a.inj.PasteOrType(ctx, text); err != nil {
+		return "", fmt.Errorf("failed to inject text: %w", err)
+	}
+
+	a.log.Info().Str("model", model).Str("text", text).Msg("Injected redo")
+	return text, nil
+}
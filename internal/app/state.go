@@ -0,0 +1,100 @@
+package app
+
+// State is where the app is in a dictation
+type State int
+
+const (
+	StateIdle       State = iota
+	StateRecording        // capturing audio into a session
+	StateFinalizing       // capture stopped; waiting for the final transcript
+	StateInjecting        // typing or pasting the transcript
+	StateError            // the last dictation failed; the next press starts over
+)
+
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateRecording:
+		return "recording"
+	case StateFinalizing:
+		return "finalizing"
+	case StateInjecting:
+		return "injecting"
+	case StateError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Event moves the state machine between states
+type Event int
+
+const (
+	EventStart       Event = iota // hotkey pressed to start dictating
+	EventStop                     // hotkey released (or pressed again in toggle mode)
+	EventCancel                   // drop the dictation in progress
+	EventTranscribed              // final transcript ready, with text
+	EventNoSpeech                 // final transcript ready, but empty
+	EventInjected                 // transcript typed or pasted
+	EventFailed                   // a dictation or the model load failed
+)
+
+func (e Event) String() string {
+	switch e {
+	case EventStart:
+		return "start"
+	case EventStop:
+		return "stop"
+	case EventCancel:
+		return "cancel"
+	case EventTranscribed:
+		return "transcribed"
+	case EventNoSpeech:
+		return "no_speech"
+	case EventInjected:
+		return "injected"
+	case EventFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// transitions lists every allowed move; any other event is ignored in that
+// state. Starting while an earlier dictation is still finalizing or
+// injecting records straight away so no speech is lost: the earlier
+// dictation carries on in the background and is injected first.
+var transitions = map[State]map[Event]State{
+	StateIdle: {
+		EventStart:  StateRecording,
+		EventFailed: StateError,
+	},
+	StateRecording: {
+		EventStop:   StateFinalizing,
+		EventCancel: StateIdle,
+		EventFailed: StateError,
+	},
+	StateFinalizing: {
+		EventStart:       StateRecording,
+		EventCancel:      StateIdle,
+		EventTranscribed: StateInjecting,
+		EventNoSpeech:    StateIdle,
+		EventFailed:      StateError,
+	},
+	StateInjecting: {
+		EventStart:    StateRecording,
+		EventCancel:   StateIdle,
+		EventInjected: StateIdle,
+		EventFailed:   StateError,
+	},
+	StateError: {
+		EventStart:  StateRecording,
+		EventCancel: StateIdle,
+	},
+}
+
+// next returns the state ev leads to from s, and false if ev is ignored
+func next(s State, ev Event) (State, bool) {
+	to, ok := transitions[s][ev]
+	return to, ok
+}
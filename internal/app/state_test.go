@@ -0,0 +1,587 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/petems/whisper-tray/internal/audio"
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/events"
+	"github.com/rs/zerolog"
+)
+
+func TestTransitions(t *testing.T) {
+	const ignored = State(-1)
+
+	// Every state against every event; ignored events leave the state alone
+	tests := []struct {
+		from State
+		want map[Event]State
+	}{
+		{StateIdle, map[Event]State{
+			EventStart:       StateRecording,
+			EventStop:        ignored,
+			EventCancel:      ignored,
+			EventTranscribed: ignored,
+			EventNoSpeech:    ignored,
+			EventInjected:    ignored,
+			EventFailed:      StateError,
+		}},
+		{StateRecording, map[Event]State{
+			EventStart:       ignored,
+			EventStop:        StateFinalizing,
+			EventCancel:      StateIdle,
+			EventTranscribed: ignored,
+			EventNoSpeech:    ignored,
+			EventInjected:    ignored,
+			EventFailed:      StateError,
+		}},
+		{StateFinalizing, map[Event]State{
+			EventStart:       StateRecording,
+			EventStop:        ignored,
+			EventCancel:      StateIdle,
+			EventTranscribed: StateInjecting,
+			EventNoSpeech:    StateIdle,
+			EventInjected:    ignored,
+			EventFailed:      StateError,
+		}},
+		{StateInjecting, map[Event]State{
+			EventStart:       StateRecording,
+			EventStop:        ignored,
+			EventCancel:      StateIdle,
+			EventTranscribed: ignored,
+			EventNoSpeech:    ignored,
+			EventInjected:    StateIdle,
+			EventFailed:      StateError,
+		}},
+		{StateError, map[Event]State{
+			EventStart:       StateRecording,
+			EventStop:        ignored,
+			EventCancel:      StateIdle,
+			EventTranscribed: ignored,
+			EventNoSpeech:    ignored,
+			EventInjected:    ignored,
+			EventFailed:      ignored,
+		}},
+	}
+
+	for _, tt := range tests {
+		for ev, want := range tt.want {
+			t.Run(fmt.Sprintf("%s/%s", tt.from, ev), func(t *testing.T) {
+				got, ok := next(tt.from, ev)
+				switch {
+				case want == ignored && ok:
+					t.Fatalf("expected %s to be ignored in %s, moved to %s", ev, tt.from, got)
+				case want != ignored && (!ok || got != want):
+					t.Fatalf("expected %s in %s to move to %s, got %s (ok=%v)", ev, tt.from, want, got, ok)
+				}
+			})
+		}
+	}
+	if len(tests) != len(transitions) {
+		t.Fatalf("table covers %d states, machine has %d", len(tests), len(transitions))
+	}
+}
+
+// fakeCapture produces no audio and runs until stopped
+type fakeCapture struct{}
+
+func (fakeCapture) Start(ctx context.Context, _ string, _ int, _ chan<- []float32) error {
+	<-ctx.Done()
+	return nil
+}
+func (fakeCapture) Stop() error                               { return nil }
+func (fakeCapture) ListDevices() ([]audio.AudioDevice, error) { return nil, nil }
+func (fakeCapture) Close() error                              { return nil }
+
+func newStateTestApp(stt *fakeTranscriber, inj *fakeInjector) (*App, *fakeStatus) {
+	a := &App{
+		audio:  fakeCapture{},
+		stt:    stt,
+		inj:    inj,
+		cfg:    &config.Config{Mode: "PushToTalk"},
+		log:    zerolog.New(io.Discard),
+		events: events.NewBus(),
+		now:    time.Now,
+	}
+	return a, watchStatus(a)
+}
+
+func waitForState(t *testing.T, a *App, want State) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for a.State() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s, state is %s", want, a.State())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// sessionWith returns a session that emits text once released
+func sessionWith(text string) *fakeSession {
+	s := newFakeSession()
+	s.text = text
+	s.release = make(chan struct{})
+	return s
+}
+
+func TestDictationFlow(t *testing.T) {
+	session := sessionWith("hello world")
+	inj := &fakeInjector{block: make(chan struct{})}
+	a, status := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{session}}, inj)
+
+	a.OnHotkey(true)
+	waitForState(t, a, StateRecording)
+	a.OnHotkey(false)
+	waitForState(t, a, StateFinalizing)
+
+	close(session.release)
+	waitForState(t, a, StateInjecting)
+
+	// The lock isn't held while injecting, so the app stays responsive
+	a.SetMode("PushToTalk")
+
+	close(inj.block)
+	waitForState(t, a, StateIdle)
+
+	if got := inj.texts(); len(got) != 1 || got[0] != "Hello world" {
+		t.Fatalf("expected one injection, got %q", got)
+	}
+	want := "[recording processing processing idle]"
+	if got := fmt.Sprint(status.history()); got != want {
+		t.Fatalf("expected status updates %s, got %s", want, got)
+	}
+}
+
+func TestDictationEvents(t *testing.T) {
+	inj := &fakeInjector{}
+	a, status := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{released("hello")}}, inj)
+	a.audio = newScriptedCapture(speech(time.Second))
+	a.cfg.StreamPartials = true
+
+	a.OnHotkey(true)
+	waitForCaptured(t, a, 16000)
+	a.OnHotkey(false)
+	waitForState(t, a, StateIdle)
+
+	var got []string
+	for _, ev := range status.published() {
+		switch ev := ev.(type) {
+		case events.DictationStarted:
+			got = append(got, fmt.Sprintf("started %d", ev.ID))
+		case events.AudioLevel:
+			if ev.Level <= 0 {
+				t.Fatalf("expected the level of the speech, got %v", ev.Level)
+			}
+			if got[len(got)-1] != "level" {
+				got = append(got, "level")
+			}
+		case events.DictationStopped:
+			got = append(got, fmt.Sprintf("stopped %d %q", ev.ID, ev.Reason))
+		case events.Final:
+			got = append(got, fmt.Sprintf("final %d %s", ev.ID, ev.Text))
+		case events.Injected:
+			got = append(got, fmt.Sprintf("injected %d %s", ev.ID, ev.Text))
+		}
+	}
+	want := `[started 1 level stopped 1 "" final 1 Hello injected 1 Hello]`
+	if fmt.Sprint(got) != want {
+		t.Fatalf("expected events %s, got %s", want, got)
+	}
+}
+
+func TestPressWhileFinalizingQueuesInOrder(t *testing.T) {
+	first, second := sessionWith("first"), sessionWith("second")
+	inj := &fakeInjector{}
+	a, _ := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{first, second}}, inj)
+
+	a.OnHotkey(true)
+	a.OnHotkey(false)
+	waitForState(t, a, StateFinalizing)
+
+	// A quick second press records straight away
+	a.OnHotkey(true)
+	waitForState(t, a, StateRecording)
+	a.OnHotkey(false)
+	waitForState(t, a, StateFinalizing)
+
+	// The second finishes transcribing first but waits its turn
+	close(second.release)
+	time.Sleep(20 * time.Millisecond)
+	if got := inj.texts(); len(got) != 0 {
+		t.Fatalf("expected nothing injected before the first dictation, got %q", got)
+	}
+
+	close(first.release)
+	waitForState(t, a, StateIdle)
+	if got := inj.texts(); fmt.Sprint(got) != "[First Second]" {
+		t.Fatalf("expected both dictations injected in order, got %q", got)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	t.Run("while recording", func(t *testing.T) {
+		// The cancelled session is slow to drain; the next dictation
+		// mustn't wait for it
+		cancelled, next := sessionWith("discarded"), sessionWith("kept")
+		close(next.release)
+		defer close(cancelled.release)
+		inj := &fakeInjector{}
+		a, _ := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{cancelled, next}}, inj)
+
+		a.OnHotkey(true)
+		a.Cancel()
+		waitForState(t, a, StateIdle)
+		a.OnHotkey(false)
+		if a.State() != StateIdle {
+			t.Fatalf("expected release after cancel to be ignored, got %s", a.State())
+		}
+
+		a.OnHotkey(true)
+		a.OnHotkey(false)
+		waitForState(t, a, StateIdle)
+		if got := inj.texts(); len(got) != 1 || got[0] != "Kept" {
+			t.Fatalf("expected only the next dictation injected, got %q", got)
+		}
+	})
+
+	t.Run("while finalizing", func(t *testing.T) {
+		first, second := sessionWith("first"), sessionWith("second")
+		inj := &fakeInjector{}
+		a, _ := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{first, second}}, inj)
+
+		a.OnHotkey(true)
+		a.OnHotkey(false)
+		a.OnHotkey(true)
+		a.OnHotkey(false)
+		waitForState(t, a, StateFinalizing)
+
+		a.mu.Lock()
+		firstAudio := a.pending[0].audio
+		a.mu.Unlock()
+
+		a.Cancel()
+		waitForState(t, a, StateIdle)
+		close(first.release)
+		close(second.release)
+
+		// Only the latest dictation is dropped; the one queued ahead of it
+		// still lands, and redo targets it
+		deadline := time.Now().Add(2 * time.Second)
+		for len(inj.texts()) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the earlier dictation to be injected")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if got := inj.texts(); len(got) != 1 || got[0] != "First" {
+			t.Fatalf("expected only the earlier dictation injected, got %q", got)
+		}
+		if a.State() != StateIdle {
+			t.Fatalf("expected idle after cancel, got %s", a.State())
+		}
+		a.mu.Lock()
+		last := a.last
+		a.mu.Unlock()
+		if last != firstAudio {
+			t.Fatal("expected redo to target the earlier dictation, not the cancelled one")
+		}
+	})
+
+	t.Run("while injecting", func(t *testing.T) {
+		session := sessionWith("slow")
+		close(session.release)
+		inj := &fakeInjector{block: make(chan struct{})}
+		a, _ := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{session}}, inj)
+
+		a.OnHotkey(true)
+		a.OnHotkey(false)
+		waitForState(t, a, StateInjecting)
+
+		a.Cancel()
+		waitForState(t, a, StateIdle)
+		close(inj.block)
+
+		time.Sleep(20 * time.Millisecond)
+		if got := inj.texts(); len(got) != 0 || a.State() != StateIdle {
+			t.Fatalf("expected the injection abandoned, got %q in %s", got, a.State())
+		}
+	})
+}
+
+// fakeHotkeys records which accelerators are registered
+type fakeHotkeys struct {
+	mu        sync.Mutex
+	callbacks map[string]func(bool)
+}
+
+func (f *fakeHotkeys) Register(accel string, cb func(bool)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.callbacks == nil {
+		f.callbacks = make(map[string]func(bool))
+	}
+	f.callbacks[accel] = cb
+	return nil
+}
+
+func (f *fakeHotkeys) Unregister(accel string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.callbacks, accel)
+	return nil
+}
+
+func (f *fakeHotkeys) Close() error { return nil }
+
+func (f *fakeHotkeys) callback(accel string) func(bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.callbacks[accel]
+}
+
+func waitForHotkey(t *testing.T, f *fakeHotkeys, accel string, registered bool) func(bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		cb := f.callback(accel)
+		if (cb != nil) == registered {
+			return cb
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s registered=%v", accel, registered)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStatusMatchesLastStateChanged(t *testing.T) {
+	session := sessionWith("text")
+	a, status := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{session}}, &fakeInjector{})
+
+	a.OnHotkey(true)
+	a.OnHotkey(false)
+	if got, want := a.Status(), events.StatusProcessing; got != want {
+		t.Fatalf("expected %s while finalizing, got %s", want, got)
+	}
+	close(session.release)
+	waitForState(t, a, StateIdle)
+
+	history := status.history()
+	if got := a.Status().String(); got != history[len(history)-1] {
+		t.Fatalf("expected %s to match the last status published, %q", got, history)
+	}
+}
+
+func TestCancelHotkey(t *testing.T) {
+	session, next := sessionWith("discarded"), sessionWith("kept")
+	close(session.release)
+	close(next.release)
+	inj := &fakeInjector{}
+	a, _ := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{session, next}}, inj)
+	keys := &fakeHotkeys{}
+	a.hotkeys = keys
+	a.cfg.CancelHotkey = "Escape"
+
+	if a.Cancel() {
+		t.Fatal("expected nothing to cancel while idle")
+	}
+
+	a.OnHotkey(true)
+	cancel := waitForHotkey(t, keys, "Escape", true)
+	cancel(true)
+	waitForState(t, a, StateIdle)
+	waitForHotkey(t, keys, "Escape", false)
+
+	a.OnHotkey(false)
+	time.Sleep(20 * time.Millisecond)
+	if got := inj.texts(); len(got) != 0 {
+		t.Fatalf("expected the cancelled dictation not to be injected, got %q", got)
+	}
+
+	// Stopping normally releases the key too
+	a.OnHotkey(true)
+	waitForHotkey(t, keys, "Escape", true)
+	a.OnHotkey(false)
+	waitForHotkey(t, keys, "Escape", false)
+	waitForState(t, a, StateIdle)
+}
+
+func TestCancelHotkeyWhileHotkeyHeld(t *testing.T) {
+	session := sessionWith("discarded")
+	inj := &fakeInjector{}
+	a, _ := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{session}}, inj)
+	keys := &fakeHotkeys{}
+	a.hotkeys = keys
+	a.cfg.Hotkey = "Alt+Space"
+	a.cfg.CancelHotkey = "Escape"
+
+	// Escape pressed with Alt+Space still down arrives as Alt+Escape
+	a.OnHotkey(true)
+	cancel := waitForHotkey(t, keys, "Alt+Escape", true)
+	cancel(true)
+	waitForState(t, a, StateIdle)
+	waitForHotkey(t, keys, "Alt+Escape", false)
+	waitForHotkey(t, keys, "Escape", false)
+
+	a.OnHotkey(false)
+	close(session.release)
+	time.Sleep(20 * time.Millisecond)
+	if got := inj.texts(); len(got) != 0 {
+		t.Fatalf("expected the cancelled dictation not to be injected, got %q", got)
+	}
+}
+
+func TestCancelHotkeyWhileFinalizing(t *testing.T) {
+	session := sessionWith("discarded")
+	inj := &fakeInjector{}
+	a, _ := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{session}}, inj)
+	keys := &fakeHotkeys{}
+	a.hotkeys = keys
+	a.cfg.CancelHotkey = "Escape"
+
+	a.OnHotkey(true)
+	a.OnHotkey(false)
+	waitForState(t, a, StateFinalizing)
+
+	// A slow decode can still be cancelled once the key is up
+	cancel := waitForHotkey(t, keys, "Escape", true)
+	cancel(true)
+	waitForState(t, a, StateIdle)
+	waitForHotkey(t, keys, "Escape", false)
+
+	close(session.release)
+	time.Sleep(20 * time.Millisecond)
+	if got := inj.texts(); len(got) != 0 {
+		t.Fatalf("expected the cancelled dictation not to be injected, got %q", got)
+	}
+}
+
+// errorCause returns the cause of the last Error published
+func errorCause(f *fakeStatus) (events.Cause, bool) {
+	var cause events.Cause
+	found := false
+	for _, ev := range f.published() {
+		if ev, ok := ev.(events.Error); ok {
+			cause, found = ev.Cause, true
+		}
+	}
+	return cause, found
+}
+
+func TestFailures(t *testing.T) {
+	t.Run("session fails to start", func(t *testing.T) {
+		a, status := newStateTestApp(&fakeTranscriber{startErr: errors.New("no model")}, &fakeInjector{})
+
+		a.OnHotkey(true)
+		if a.State() != StateError {
+			t.Fatalf("expected error state, got %s", a.State())
+		}
+		if got := fmt.Sprint(status.history()); got != "[recording error]" {
+			t.Fatalf("unexpected status updates %s", got)
+		}
+		if cause, ok := errorCause(status); !ok || cause != events.CauseSession {
+			t.Fatalf("expected a session error published, got %v", cause)
+		}
+	})
+
+	t.Run("transcription fails", func(t *testing.T) {
+		session := sessionWith("")
+		session.err = errors.New("decoder exploded")
+		close(session.release)
+		a, status := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{session}}, &fakeInjector{})
+
+		a.OnHotkey(true)
+		a.OnHotkey(false)
+		waitForState(t, a, StateError)
+		if cause, ok := errorCause(status); !ok || cause != events.CauseTranscription {
+			t.Fatalf("expected a transcription error published, got %v", cause)
+		}
+
+		// The next press starts over
+		a.OnHotkey(true)
+		waitForState(t, a, StateRecording)
+	})
+
+	t.Run("injection fails", func(t *testing.T) {
+		session := sessionWith("text")
+		close(session.release)
+		a, status := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{session}}, &fakeInjector{err: errors.New("no focus")})
+
+		a.OnHotkey(true)
+		a.OnHotkey(false)
+		waitForState(t, a, StateError)
+
+		var failed *events.InjectionFailed
+		for _, ev := range status.published() {
+			if ev, ok := ev.(events.InjectionFailed); ok {
+				failed = &ev
+			}
+		}
+		if failed == nil || failed.Text != "Text" || failed.Err == nil {
+			t.Fatalf("expected the failed injection published, got %+v", failed)
+		}
+	})
+
+	t.Run("no speech", func(t *testing.T) {
+		session := sessionWith("")
+		close(session.release)
+		inj := &fakeInjector{}
+		a, _ := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{session}}, inj)
+
+		a.OnHotkey(true)
+		a.OnHotkey(false)
+		waitForState(t, a, StateIdle)
+		if got := inj.texts(); len(got) != 0 {
+			t.Fatalf("expected nothing injected, got %q", got)
+		}
+	})
+}
+
+func TestToggleMode(t *testing.T) {
+	session := sessionWith("toggled")
+	close(session.release)
+	inj := &fakeInjector{}
+	a, _ := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{session}}, inj)
+	a.cfg.Mode = "Toggle"
+
+	a.OnHotkey(true)
+	a.OnHotkey(false)
+	if a.State() != StateRecording {
+		t.Fatalf("expected release to be ignored in toggle mode, got %s", a.State())
+	}
+
+	a.OnHotkey(true)
+	waitForState(t, a, StateIdle)
+	if got := inj.texts(); len(got) != 1 {
+		t.Fatalf("expected one injection, got %q", got)
+	}
+}
+
+func TestShutdownWaitsForPendingDictations(t *testing.T) {
+	session := sessionWith("last words")
+	inj := &fakeInjector{}
+	a, _ := newStateTestApp(&fakeTranscriber{sessions: []*fakeSession{session}}, inj)
+
+	a.OnHotkey(true)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(session.release)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := a.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+	if got := inj.texts(); len(got) != 1 || got[0] != "Last words" {
+		t.Fatalf("expected the recording finished on shutdown, got %q", got)
+	}
+}
@@ -0,0 +1,281 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/events"
+	"github.com/petems/whisper-tray/internal/supervise"
+	"github.com/petems/whisper-tray/internal/vad"
+)
+
+// While the app is idle with wake.enabled set, it captures quietly and
+// decodes each short burst of speech with a small model. A burst that
+// starts with the wake phrase starts a dictation seeded with that audio,
+// exactly as if the hotkey had been pressed and toggled on, and silence
+// ends it. The phrase is stripped from the transcript.
+
+const (
+	// wakePoll is how often the wake loop checks whether the app is idle
+	wakePoll = 250 * time.Millisecond
+	// wakeRetry is how long the wake loop waits after an audio error
+	wakeRetry = 5 * time.Second
+	// wakePause ends a burst of speech to check for the phrase
+	wakePause = 500 * time.Millisecond
+	// wakeMax cuts bursts so the phrase is checked even while people talk
+	wakeMax = 5 * time.Second
+)
+
+// waker is the wake loop. pause, when set, ends its current capture.
+type waker struct {
+	stop  context.CancelFunc
+	done  chan struct{}
+	pause context.CancelFunc
+}
+
+// SetWakeWord turns listening for the wake phrase on or off and saves the
+// choice
+func (a *App) SetWakeWord(on bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.cfg.Wake.Enabled = on
+	a.cfg.Save()
+	if on {
+		a.startWakeLocked()
+	} else {
+		a.stopWakeLocked()
+	}
+}
+
+func (a *App) startWakeLocked() {
+	if a.waker != nil {
+		return
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	w := &waker{stop: stop, done: make(chan struct{})}
+	a.waker = w
+	prev, model := a.wakeDone, a.wakeModelLocked()
+	go func() {
+		defer close(w.done)
+		// The model stays loaded while listening. A loop stopped just
+		// before frees its model first, or it could free this one.
+		if prev != nil {
+			<-prev
+		}
+		if !a.loadWakeModel(model) {
+			return
+		}
+		defer a.stt.LoadWakeModel("", nil)
+		supervise.Loop(a.log, "wake loop", func() { a.wakeLoop(ctx, w) }, a.ReportPanic)
+	}()
+}
+
+func (a *App) stopWakeLocked() {
+	if a.waker == nil {
+		return
+	}
+	a.waker.stop()
+	a.wakeDone = a.waker.done
+	a.waker = nil
+}
+
+// loadWakeModel loads the model that listens for the wake phrase. Without
+// it the phrase can't be heard, so a failure is shown as an error.
+func (a *App) loadWakeModel(model string) bool {
+	a.log.Info().Str("model", model).Msg("Loading wake model in background")
+	if err := a.stt.LoadWakeModel(model, a.loadProgress(model)); err != nil {
+		a.log.Error().Err(err).Str("model", model).Msg("Failed to load wake model; not listening for the wake phrase")
+		a.events.Publish(events.Error{Cause: events.CauseModel, Err: err})
+		return false
+	}
+	a.events.Publish(events.ModelReady{Model: model})
+
+	a.mu.Lock()
+	if a.state == StateIdle && !a.loading {
+		a.reportStateLocked()
+	}
+	a.mu.Unlock()
+	return true
+}
+
+// pauseWakeLocked frees the microphone for a dictation or listening; the
+// wake loop resumes once the app is idle again
+func (a *App) pauseWakeLocked() {
+	if a.waker != nil && a.waker.pause != nil {
+		a.waker.pause()
+		a.waker.pause = nil
+	}
+}
+
+// wakeReadyLocked reports whether nothing else is using the microphone or
+// the model
+func (a *App) wakeReadyLocked() bool {
+	return !a.loading && !a.redoing && a.listener == nil && len(a.pending) == 0 &&
+		(a.state == StateIdle || a.state == StateError)
+}
+
+func (a *App) wakeLoop(ctx context.Context, w *waker) {
+	ticker := time.NewTicker(wakePoll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := a.wakeOnce(ctx, w); err != nil {
+			a.log.Warn().Err(err).Msg("Wake word listening failed")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wakeRetry):
+			}
+		}
+	}
+}
+
+// wakeOnce listens for the phrase if the app is idle, until it's heard or
+// something else wants the microphone
+func (a *App) wakeOnce(ctx context.Context, w *waker) error {
+	a.mu.Lock()
+	if a.waker != w || !a.wakeReadyLocked() {
+		a.mu.Unlock()
+		return nil
+	}
+	runCtx, pause := context.WithCancel(ctx)
+	defer pause()
+	w.pause = pause
+	phrase, model := a.cfg.Wake.Phrase, a.wakeModelLocked()
+	opts, device := a.sessionOpts(), a.cfg.Audio.DeviceID
+	seg := vad.NewSegmenter(16000, vad.SegmenterOptions{
+		Threshold: a.cfg.AutoStop.SilenceThreshold,
+		Pause:     wakePause,
+		PreRoll:   listenPreRoll,
+		MinSpeech: time.Duration(a.cfg.Gate.MinSpeechMs) * time.Millisecond,
+		Max:       wakeMax,
+	})
+	a.mu.Unlock()
+
+	seed, err := a.listenForWake(runCtx, device, seg, func(samples []float32) bool {
+		segments, err := a.stt.Transcribe(model, samples, opts, nil)
+		if err != nil {
+			a.log.Debug().Err(err).Msg("Wake decode failed")
+			return false
+		}
+		_, ok := stripPhrase(a.segmentsText(segments), phrase)
+		return ok
+	})
+	pause()
+
+	if seed != nil {
+		a.onWake(seed, phrase)
+	}
+	return err
+}
+
+// wakeModelLocked is the model that listens for the phrase
+func (a *App) wakeModelLocked() string {
+	if a.cfg.Wake.Model != "" {
+		return a.cfg.Wake.Model
+	}
+	return config.DefaultWakeModel
+}
+
+// listenForWake captures until ctx ends or heard reports a burst of speech
+// holds the phrase, returning that burst. Bursts arriving while one is
+// being decoded are dropped.
+func (a *App) listenForWake(ctx context.Context, device string, seg *vad.Segmenter, heard func([]float32) bool) ([]float32, error) {
+	// Capture and decoding each report one failure at most, a panic included
+	audioChan := make(chan []float32, 8)
+	failed := make(chan error, 2)
+	crashed := func(p *supervise.Panic) { failed <- p }
+	go supervise.Run(a.log, "wake capture", func() {
+		if err := a.audio.Start(ctx, device, 16000, audioChan); err != nil {
+			failed <- err
+		}
+	}, crashed)
+
+	bursts := make(chan []float32, 1)
+	found := make(chan []float32, 1)
+	defer close(bursts)
+	go supervise.Run(a.log, "wake decoder", func() {
+		for b := range bursts {
+			if ctx.Err() == nil && heard(b) {
+				found <- b
+				return
+			}
+		}
+	}, crashed)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case err := <-failed:
+			return nil, err
+		case b := <-found:
+			return b, nil
+		case samples, ok := <-audioChan:
+			if !ok {
+				return nil, nil
+			}
+			for _, b := range seg.Feed(samples) {
+				select {
+				case bursts <- b:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// onWake starts a hands-free dictation with the burst that held the phrase
+func (a *App) onWake(seed []float32, phrase string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.waker == nil || !a.wakeReadyLocked() {
+		return
+	}
+	a.log.Info().Str("phrase", phrase).Msg("Wake phrase heard")
+	if d := a.startDictationLocked(seed); d != nil {
+		d.handsFree = true
+		d.wakePhrase = phrase
+		d.audio.phrase = phrase
+	}
+}
+
+// stripPhrase removes phrase from the start of text, ignoring case and
+// punctuation, and reports whether it was there
+func stripPhrase(text, phrase string) (string, bool) {
+	want := strings.FieldsFunc(phrase, notWordRune)
+	if len(want) == 0 {
+		return text, false
+	}
+
+	rest := text
+	for _, w := range want {
+		rest = strings.TrimLeftFunc(rest, notWordRune)
+		end := strings.IndexFunc(rest, notWordRune)
+		if end < 0 {
+			end = len(rest)
+		}
+		if !strings.EqualFold(rest[:end], w) {
+			return text, false
+		}
+		rest = rest[end:]
+	}
+	return strings.TrimLeftFunc(rest, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}), true
+}
+
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+}
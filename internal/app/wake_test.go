@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/petems/whisper-tray/internal/config"
+)
+
+func TestStripPhrase(t *testing.T) {
+	tests := []struct {
+		text, phrase string
+		want         string
+		ok           bool
+	}{
+		{"Hey whisper, buy milk.", "hey whisper", "buy milk.", true},
+		{"Hey, Whisper! Buy milk.", "hey whisper", "Buy milk.", true},
+		{"hey whisper", "Hey Whisper", "", true},
+		{"Hey whispers are quiet", "hey whisper", "Hey whispers are quiet", false},
+		{"I said hey whisper", "hey whisper", "I said hey whisper", false},
+		{"Computer's on", "computer's", "on", true},
+		{"anything", "", "anything", false},
+	}
+	for _, tt := range tests {
+		got, ok := stripPhrase(tt.text, tt.phrase)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("stripPhrase(%q, %q) = %q, %v; want %q, %v", tt.text, tt.phrase, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func newWakeTestApp(heard string, sessions ...*fakeSession) (*App, *fakeTranscriber, *fakeInjector) {
+	stt := &fakeTranscriber{transcript: heard, sessions: sessions}
+	inj := &fakeInjector{}
+	a, _ := newStateTestApp(stt, inj)
+	a.audio = newScriptedCapture(append(speech(510*time.Millisecond), quiet(1500*time.Millisecond)...))
+	a.cfg.Whisper.Model = "base.en"
+	a.cfg.Wake.Enabled = true
+	a.cfg.Wake.Phrase = "hey whisper"
+	a.cfg.AutoStop.SilenceSeconds = 1
+
+	a.mu.Lock()
+	a.startWakeLocked()
+	a.mu.Unlock()
+	return a, stt, inj
+}
+
+func shutdown(t *testing.T, a *App) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := a.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
+
+func TestWakePhraseStartsDictation(t *testing.T) {
+	// Push-to-talk, yet silence still ends a dictation nobody is holding
+	// the hotkey for
+	a, stt, inj := newWakeTestApp("Hey whisper.", released("Hey whisper, buy milk."))
+	defer shutdown(t, a)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(inj.texts()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the dictation, state %s", a.State())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := inj.texts()[0]; got != "Buy milk." {
+		t.Fatalf("expected the phrase stripped, got %q", got)
+	}
+
+	stt.mu.Lock()
+	defer stt.mu.Unlock()
+	if len(stt.transcribed) == 0 || stt.transcribed[0] != config.DefaultWakeModel {
+		t.Fatalf("expected the phrase listened for with the wake model, got %q", stt.transcribed)
+	}
+}
+
+func TestRedoStripsWakePhrase(t *testing.T) {
+	a, stt, inj := newWakeTestApp("Hey whisper.", released("Hey whisper, buy milk."))
+	defer shutdown(t, a)
+	a.cfg.Redo.Replace = true
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(inj.texts()) == 0 || a.State() != StateIdle {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the dictation, state %s", a.State())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	a.mu.Lock()
+	a.stopWakeLocked()
+	a.mu.Unlock()
+
+	// The redo hears the phrase again at the start of the same audio
+	stt.mu.Lock()
+	stt.transcript = "Hey whisper, buy oat milk."
+	stt.mu.Unlock()
+	text, err := a.Redo("")
+	if err != nil {
+		t.Fatalf("Redo returned error: %v", err)
+	}
+	if text != "Buy oat milk." {
+		t.Fatalf("expected the phrase stripped from the redo, got %q", text)
+	}
+	inj.mu.Lock()
+	defer inj.mu.Unlock()
+	if len(inj.erased) != 1 || inj.erased[0] != len("Buy milk.") {
+		t.Fatalf("expected only the injected text erased, got %v", inj.erased)
+	}
+}
+
+func TestWakeModelLoadedWhileListening(t *testing.T) {
+	a, stt, _ := newWakeTestApp("Hello there.")
+	a.mu.Lock()
+	a.cfg.Wake.Model = "tiny"
+	a.stopWakeLocked()
+	a.startWakeLocked()
+	a.mu.Unlock()
+	shutdown(t, a)
+
+	// The restarted loop waits for the first to free its model
+	stt.mu.Lock()
+	defer stt.mu.Unlock()
+	want := []string{config.DefaultWakeModel, "", "tiny", ""}
+	if fmt.Sprint(stt.wake) != fmt.Sprint(want) {
+		t.Fatalf("expected the wake model loaded once per loop and freed on stop, got %q", stt.wake)
+	}
+}
+
+func TestWakeIgnoresOtherSpeech(t *testing.T) {
+	session := released("never")
+	a, stt, inj := newWakeTestApp("Hello there.", session)
+	defer shutdown(t, a)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stt.mu.Lock()
+		heard := len(stt.transcribed)
+		stt.mu.Unlock()
+		if heard > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for speech to be checked")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	stt.mu.Lock()
+	unused := len(stt.sessions)
+	stt.mu.Unlock()
+	if a.State() != StateIdle || len(inj.texts()) != 0 || unused != 1 {
+		t.Fatalf("expected no dictation, state %s injected %q", a.State(), inj.texts())
+	}
+}
@@ -0,0 +1,88 @@
+// Package audiofile loads recordings from disk as the 16 kHz mono samples
+// whisper expects. WAV is read natively; anything else goes through ffmpeg
+// when it is installed.
+package audiofile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/petems/whisper-tray/internal/wav"
+)
+
+// SampleRate is the rate Load returns samples at
+const SampleRate = 16000
+
+// ErrNoFFmpeg is returned for non-WAV files when ffmpeg isn't on PATH
+var ErrNoFFmpeg = errors.New("ffmpeg not found")
+
+// Extensions lists the file types worth handing to Load
+var Extensions = []string{".wav", ".mp3", ".m4a", ".aac", ".ogg", ".opus", ".flac", ".webm", ".mp4", ".amr", ".3gp"}
+
+// IsAudio reports whether path has one of Extensions
+func IsAudio(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range Extensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Load decodes the file at path to 16 kHz mono samples
+func Load(path string) ([]float32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	samples, rate, err := wav.Read(f)
+	switch {
+	case err == nil:
+		return wav.Resample(samples, rate, SampleRate), nil
+	case !errors.Is(err, wav.ErrNotWAV):
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return convert(path)
+}
+
+// convert has ffmpeg decode path to a 16 kHz mono WAV on stdout
+func convert(path string) ([]float32, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a WAV file and %w; install ffmpeg to transcribe other formats", path, ErrNoFFmpeg)
+	}
+
+	// ffmpeg reads a name like "http:memo.m4a" or "concat:a|b" as a protocol,
+	// so spell out that it's a local file and allow nothing else
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(ffmpeg, "-nostdin", "-v", "error", "-protocol_whitelist", "file", "-i", "file:"+abs,
+		"-f", "wav", "-ac", "1", "-ar", fmt.Sprint(SampleRate), "-acodec", "pcm_s16le", "-")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.LastIndexByte(msg, '\n'); i >= 0 {
+			msg = msg[i+1:]
+		}
+		return nil, fmt.Errorf("ffmpeg failed to decode %s: %v: %s", path, err, msg)
+	}
+
+	samples, rate, err := wav.Read(&stdout)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected ffmpeg output for %s: %w", path, err)
+	}
+	return wav.Resample(samples, rate, SampleRate), nil
+}
@@ -0,0 +1,85 @@
+package audiofile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/petems/whisper-tray/internal/wav"
+)
+
+func writeWAV(t *testing.T, path string, n, rate int) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := wav.Write(f, make([]float32, n), rate); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadWAVResamples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memo.wav")
+	writeWAV(t, path, 48000, 48000)
+
+	samples, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(samples) != SampleRate {
+		t.Fatalf("expected %d samples, got %d", SampleRate, len(samples))
+	}
+}
+
+func TestLoadConvertsWithFFmpeg(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg is a shell script")
+	}
+	dir := t.TempDir()
+	writeWAV(t, filepath.Join(dir, "out.wav"), 8000, 16000)
+	script := "#!/bin/sh\necho \"$@\" > \"$(dirname \"$0\")/args\"\ncat \"$(dirname \"$0\")/out.wav\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	memo := filepath.Join(t.TempDir(), "http:memo.m4a")
+	os.WriteFile(memo, []byte("not a wav"), 0644)
+
+	samples, err := Load(memo)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(samples) != 8000 {
+		t.Fatalf("expected ffmpeg's 8000 samples, got %d", len(samples))
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	// The name must not be read as a network protocol
+	if !strings.Contains(string(args), "-protocol_whitelist file -i file:"+memo) || !strings.Contains(string(args), "-ar 16000") {
+		t.Fatalf("unexpected ffmpeg arguments %q", args)
+	}
+}
+
+func TestLoadWithoutFFmpeg(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	memo := filepath.Join(t.TempDir(), "memo.mp3")
+	os.WriteFile(memo, []byte("ID3 not a wav"), 0644)
+
+	if _, err := Load(memo); !errors.Is(err, ErrNoFFmpeg) {
+		t.Fatalf("expected ErrNoFFmpeg, got %v", err)
+	}
+}
+
+func TestIsAudio(t *testing.T) {
+	for path, want := range map[string]bool{"a.WAV": true, "b.m4a": true, "c.txt": false, "d.srt": false} {
+		if got := IsAudio(path); got != want {
+			t.Errorf("IsAudio(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
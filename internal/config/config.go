@@ -8,17 +8,27 @@ import (
 )
 
 type Config struct {
-	Hotkey         string        `json:"hotkey"`
-	HotkeyDarwin   string        `json:"hotkey_darwin"`
-	Mode           string        `json:"mode"` // "PushToTalk" or "Toggle"
-	Audio          AudioConfig   `json:"audio"`
-	Whisper        WhisperConfig `json:"whisper"`
-	Inject         InjectConfig  `json:"inject"`
-	AppendSpace    bool          `json:"append_space"`
-	StreamPartials bool          `json:"stream_partials"`
-	EnterOnFinal   bool          `json:"enter_on_final"`
-	RunAtLogin     bool          `json:"run_at_login"`
-	LogLevel       string        `json:"log_level"` // "info" or "debug"
+	Hotkey         string         `json:"hotkey"`
+	HotkeyDarwin   string         `json:"hotkey_darwin"`
+	CancelHotkey   string         `json:"cancel_hotkey"` // grabbed only during a dictation; "" disables it
+	Mode           string         `json:"mode"`          // "PushToTalk", "Toggle" or "Hybrid"
+	Gestures       GestureConfig  `json:"gestures"`
+	AutoStop       AutoStopConfig `json:"auto_stop"`
+	Gate           GateConfig     `json:"gate"`
+	Listen         ListenConfig   `json:"listen"`
+	Wake           WakeConfig     `json:"wake"`
+	Append         AppendConfig   `json:"append"`
+	Audio          AudioConfig    `json:"audio"`
+	Whisper        WhisperConfig  `json:"whisper"`
+	Inject         InjectConfig   `json:"inject"`
+	Filter         FilterConfig   `json:"filter"`
+	Redo           RedoConfig     `json:"redo"`
+	Serve          ServeConfig    `json:"serve"`
+	AppendSpace    bool           `json:"append_space"`
+	StreamPartials bool           `json:"stream_partials"`
+	EnterOnFinal   bool           `json:"enter_on_final"`
+	RunAtLogin     bool           `json:"run_at_login"`
+	LogLevel       string         `json:"log_level"` // "info" or "debug"
 }
 
 type AudioConfig struct {
@@ -26,17 +36,124 @@ type AudioConfig struct {
 }
 
 type WhisperConfig struct {
-	Model       string  `json:"model"`        // "base.en", "small", etc.
-	Language    string  `json:"language"`     // "auto", "en", etc.
-	Temperature float32 `json:"temperature"`
-	Threads     int     `json:"threads"`
-	GPU         string  `json:"gpu"`          // "auto", "cpu", "cuda", "metal"
+	Backend      string   `json:"backend"`       // "bindings" (built in), "cli" (an installed whisper.cpp CLI) or "http" (a transcription server)
+	Model        string   `json:"model"`         // "base.en", "small", etc.
+	PartialModel string   `json:"partial_model"` // fast model for live partials; Model then decodes the utterance on release
+	Language     string   `json:"language"`      // "auto", "en", etc.
+	Temperature  float32  `json:"temperature"`
+	Threads      int      `json:"threads"`
+	GPU          string   `json:"gpu"`     // "auto", "cpu", "cuda", "metal"
+	Mirrors      []string `json:"mirrors"` // base URLs tried before Hugging Face when downloading models
+	Offline      bool     `json:"offline"` // never touch the network; models must already be on disk
+
+	IdleUnloadMinutes int  `json:"idle_unload_minutes"` // free the model after this long without dictation; 0 keeps it loaded
+	Warmup            bool `json:"warmup"`              // decode a second of silence after loading so the first dictation is fast
+
+	CLI  CLIConfig  `json:"cli"`
+	HTTP HTTPConfig `json:"http"`
+}
+
+// CLIConfig configures the "cli" backend, which runs whisper.cpp's CLI once
+// per utterance
+type CLIConfig struct {
+	Path string   `json:"path"` // whisper-cli binary; looked up on PATH when empty
+	Args []string `json:"args"` // extra flags, e.g. ["-fa"] for flash attention
+}
+
+// HTTPConfig configures the "http" backend, which posts each utterance to an
+// OpenAI-compatible /audio/transcriptions endpoint
+type HTTPConfig struct {
+	BaseURL        string `json:"base_url"`        // e.g. "http://gpu-box:8000/v1"
+	Model          string `json:"model"`           // model name the server expects
+	TokenFile      string `json:"token_file"`      // file holding the API token; takes precedence over token_env
+	TokenEnv       string `json:"token_env"`       // environment variable holding the API token
+	TimeoutSeconds int    `json:"timeout_seconds"` // per request
+	Fallback       bool   `json:"fallback"`        // decode locally with whisper.model when the server fails
 }
 
 type InjectConfig struct {
 	PreferPaste bool `json:"prefer_paste"`
 }
 
+// FilterConfig controls how hallucinated and non-speech output is dropped
+// before text reaches the focused window.
+type FilterConfig struct {
+	DropNonSpeech     bool     `json:"drop_non_speech"`     // strip "[BLANK_AUDIO]", "(music)", etc.
+	MaxRepeats        int      `json:"max_repeats"`         // collapse phrases repeated more often; 0 disables
+	NoSpeechThreshold float64  `json:"no_speech_threshold"` // segments above this no-speech probability are silence; 0 disables; http backend only
+	LogProbThreshold  float64  `json:"logprob_threshold"`   // unless their average log-prob is at least this; 0 disables
+	Blocklist         []string `json:"blocklist"`           // segments matching these phrases are dropped
+}
+
+// AutoStopConfig ends dictations nobody remembered to stop
+type AutoStopConfig struct {
+	SilenceSeconds   float64 `json:"silence_seconds"`   // stop a toggled or latched recording after this much silence; 0 disables
+	MaxSeconds       int     `json:"max_seconds"`       // stop any dictation after this long; 0 disables
+	SilenceThreshold float64 `json:"silence_threshold"` // RMS level below which audio is silence; 0 uses the default
+}
+
+// GateConfig drops dictations too short or quiet to hold speech before
+// whisper sees them, since it tends to hallucinate words from a keypress
+type GateConfig struct {
+	MinMs       int `json:"min_ms"`        // dictations shorter than this are dropped; 0 disables
+	MinSpeechMs int `json:"min_speech_ms"` // as are ones with less audio above auto_stop.silence_threshold; 0 disables
+}
+
+// ListenConfig controls hands-free listening, where speech is transcribed
+// at each pause without the hotkey being touched. What counts as speech is
+// shared with dictation: auto_stop.silence_threshold is the level below
+// which a pause is heard, and gate.min_speech_ms the speech an utterance
+// needs before it's transcribed.
+type ListenConfig struct {
+	Hotkey     string `json:"hotkey"`      // toggles listening; "" leaves the tray item and "ctl listen"
+	PauseMs    int    `json:"pause_ms"`    // silence that ends an utterance
+	MaxSeconds int    `json:"max_seconds"` // longer utterances are cut so text keeps arriving
+	OutputFile string `json:"output_file"` // append utterances to this file instead of injecting them
+}
+
+// WakeConfig controls starting a dictation by saying a phrase
+type WakeConfig struct {
+	Enabled bool   `json:"enabled"`
+	Phrase  string `json:"phrase"` // said before dictating; stripped from the text
+	Model   string `json:"model"`  // listens for the phrase, kept loaded while this is on; "" uses DefaultWakeModel
+}
+
+// DefaultWakeModel listens for the wake phrase unless wake.model says
+// otherwise. It decodes every burst of speech while idle, so it's the
+// smallest there is.
+const DefaultWakeModel = "tiny.en"
+
+// AppendConfig controls append mode, where dictations collect into a draft
+// that's injected in one go
+type AppendConfig struct {
+	Enabled       bool    `json:"enabled"`
+	CommitHotkey  string  `json:"commit_hotkey"`  // injects the draft; "" leaves the tray item and "ctl commit"
+	CommitSeconds float64 `json:"commit_seconds"` // commit after this long without a new dictation; 0 waits to be told
+}
+
+// GestureConfig tunes how Hybrid mode reads the hotkey
+type GestureConfig struct {
+	TapMs       int    `json:"tap_ms"`        // presses shorter than this latch recording on; longer ones are push-to-talk
+	DoubleTapMs int    `json:"double_tap_ms"` // a press this soon after a latching tap is a double tap
+	DoubleTap   string `json:"double_tap"`    // "redo", "cancel", or "" to treat it as an ordinary press
+}
+
+// RedoConfig controls re-transcribing the last dictation with another model
+type RedoConfig struct {
+	Hotkey  string `json:"hotkey"`  // "" disables the hotkey; the tray item and "ctl redo" still work
+	Model   string `json:"model"`   // model the last recording is re-run through
+	Replace bool   `json:"replace"` // erase the earlier text first; otherwise the new text is injected after it
+}
+
+// ServeConfig controls serving the app's model over an OpenAI-compatible
+// HTTP API, so other tools share it instead of loading their own
+type ServeConfig struct {
+	Enabled       bool   `json:"enabled"`        // also set by --serve
+	Addr          string `json:"addr"`           // listen address; anything but localhost needs a token
+	TokenFile     string `json:"token_file"`     // file holding the bearer token clients must send; "" disables auth
+	MaxConcurrent int    `json:"max_concurrent"` // requests queued for the model, which decodes one at a time; more are refused
+}
+
 // Load reads the config from disk or returns defaults
 func Load() (*Config, error) {
 	path := configPath()
@@ -45,20 +162,71 @@ func Load() (*Config, error) {
 	cfg := &Config{
 		Hotkey:       "Alt+Space",
 		HotkeyDarwin: "Alt+Space", // Option+Space
+		CancelHotkey: "Escape",
 		Mode:         "PushToTalk",
+		AutoStop: AutoStopConfig{
+			SilenceSeconds: 3,
+			MaxSeconds:     120,
+		},
+		Gate: GateConfig{
+			MinMs:       300,
+			MinSpeechMs: 100,
+		},
+		Listen: ListenConfig{
+			PauseMs:    800,
+			MaxSeconds: 30,
+		},
+		Wake: WakeConfig{
+			Phrase: "hey whisper",
+			Model:  DefaultWakeModel,
+		},
+		Append: AppendConfig{
+			CommitHotkey:  "Alt+Shift+Return",
+			CommitSeconds: 60,
+		},
+		Gestures: GestureConfig{
+			TapMs:       300,
+			DoubleTapMs: 400,
+		},
 		Audio: AudioConfig{
 			DeviceID: "",
 		},
 		Whisper: WhisperConfig{
+			Backend:     "bindings",
 			Model:       "base.en",
 			Language:    "auto",
 			Temperature: 0.0,
 			Threads:     0, // Auto-detect
 			GPU:         "auto",
+			Warmup:      true,
+			HTTP: HTTPConfig{
+				Model:          "whisper-1",
+				TokenEnv:       "WHISPER_TRAY_HTTP_TOKEN",
+				TimeoutSeconds: 30,
+				Fallback:       true,
+			},
 		},
 		Inject: InjectConfig{
 			PreferPaste: true,
 		},
+		Filter: FilterConfig{
+			DropNonSpeech:    true,
+			MaxRepeats:       2,
+			LogProbThreshold: -1.0,
+			Blocklist: []string{
+				"Thank you for watching.",
+				"Thanks for watching!",
+				"Please subscribe to my channel.",
+				"Subtitles by the Amara.org community",
+			},
+		},
+		Redo: RedoConfig{
+			Model: "large-v3",
+		},
+		Serve: ServeConfig{
+			Addr:          "127.0.0.1:8178",
+			MaxConcurrent: 2,
+		},
 		AppendSpace:    true,
 		StreamPartials: false,
 		EnterOnFinal:   false,
@@ -121,6 +289,18 @@ func configPath() string {
 	return filepath.Join(base, "whisper-tray", "config.json")
 }
 
+// RegistryPath returns the path of the user model registry, which adds or
+// overrides models alongside the built-in list
+func RegistryPath() string {
+	return filepath.Join(filepath.Dir(configPath()), "models.json")
+}
+
+// ControlSocketPath returns the unix socket the running app accepts control
+// commands on
+func ControlSocketPath() string {
+	return filepath.Join(filepath.Dir(configPath()), "control.sock")
+}
+
 // ModelsPath returns the platform-specific models directory path
 func ModelsPath() string {
 	var base string
@@ -139,4 +319,4 @@ func ModelsPath() string {
 	}
 
 	return filepath.Join(base, "whisper-tray", "models")
-}
\ No newline at end of file
+}
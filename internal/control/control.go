@@ -0,0 +1,169 @@
+// Package control lets other processes drive the running app over a local
+// unix socket, one command per connection.
+//
+// A request is a single line of space-separated words, the first naming the
+// command. The reply is a single line starting with "ok" or "error".
+package control
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Handler runs a command with its arguments and returns a short reply
+type Handler func(args []string) (string, error)
+
+// Server accepts control commands for the running app
+type Server struct {
+	ln  net.Listener
+	log zerolog.Logger
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+}
+
+// readTimeout bounds how long a client may take to send its command.
+// Replies have no deadline since commands like redo can take a while.
+const readTimeout = 5 * time.Second
+
+// Listen opens the control socket at path. A socket left behind by a crash
+// is replaced, but one another instance still answers on is not.
+func Listen(path string, log zerolog.Logger) (*Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another instance is already listening on %s", path)
+	}
+	os.Remove(path)
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	// Only the owner may drive the app
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	s := &Server{
+		ln:       ln,
+		log:      log,
+		handlers: make(map[string]Handler),
+	}
+	s.Handle("help", s.help)
+	return s, nil
+}
+
+// Handle registers the handler for a command name
+func (s *Server) Handle(name string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[name] = h
+}
+
+// Serve accepts connections until Close is called
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting commands and removes the socket
+func (s *Server) Close() error {
+	return s.ln.Close()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	fmt.Fprintln(conn, s.dispatch(strings.Fields(line)))
+}
+
+func (s *Server) dispatch(args []string) string {
+	if len(args) == 0 {
+		return "error empty command"
+	}
+
+	s.mu.Lock()
+	h, ok := s.handlers[args[0]]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Sprintf("error unknown command %q (try help)", args[0])
+	}
+
+	s.log.Info().Strs("command", args).Msg("Control command")
+	reply, err := h(args[1:])
+	if err != nil {
+		s.log.Warn().Err(err).Str("command", args[0]).Msg("Control command failed")
+		return "error " + oneLine(err.Error())
+	}
+	return strings.TrimSpace("ok " + oneLine(reply))
+}
+
+func (s *Server) help([]string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.handlers))
+	for name := range s.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "commands: " + strings.Join(names, ", "), nil
+}
+
+// oneLine keeps a reply from breaking the line-based protocol
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Send runs one command against the app listening on path and returns its reply
+func Send(path string, args ...string) (string, error) {
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("whisper-tray doesn't seem to be running: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintln(conn, strings.Join(args, " ")); err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("no reply from whisper-tray: %w", err)
+	}
+
+	status, msg, _ := strings.Cut(strings.TrimSpace(reply), " ")
+	if status != "ok" {
+		return "", errors.New(msg)
+	}
+	return msg, nil
+}
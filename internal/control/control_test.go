@@ -0,0 +1,71 @@
+package control
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func startServer(t *testing.T, path string) *Server {
+	t.Helper()
+	s, err := Listen(path, zerolog.New(io.Discard))
+	if err != nil {
+		t.Fatalf("Listen returned error: %v", err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSendRunsHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "control.sock")
+	s := startServer(t, path)
+
+	s.Handle("redo", func(args []string) (string, error) {
+		return "redid with " + strings.Join(args, ","), nil
+	})
+	s.Handle("fail", func([]string) (string, error) {
+		return "", errors.New("nothing to redo\nyet")
+	})
+
+	reply, err := Send(path, "redo", "large-v3")
+	if err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+	if reply != "redid with large-v3" {
+		t.Fatalf("unexpected reply %q", reply)
+	}
+
+	if _, err := Send(path, "fail"); err == nil || err.Error() != "nothing to redo yet" {
+		t.Fatalf("expected handler error, got %v", err)
+	}
+	if _, err := Send(path, "bogus"); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Fatalf("expected unknown command error, got %v", err)
+	}
+
+	reply, err = Send(path, "help")
+	if err != nil || !strings.Contains(reply, "fail, help, redo") {
+		t.Fatalf("expected command list, got %q (err=%v)", reply, err)
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "control.sock")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	startServer(t, path)
+
+	if _, err := Listen(path, zerolog.New(io.Discard)); err == nil {
+		t.Fatal("expected a second instance to be refused")
+	}
+	if _, err := Send(path, "help"); err != nil {
+		t.Fatalf("expected the first instance to keep serving: %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+// Package events carries what the app is doing to whoever wants to follow
+// along: the tray, logs, a history or another program. The app publishes
+// without knowing who is subscribed, and a slow subscriber never holds it up.
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuffer is how far a subscriber may fall behind before it starts
+// missing events
+const DefaultBuffer = 64
+
+// Event is something the app reports. The types in this package are the
+// whole set; subscribers switch on them and skip the ones they don't need.
+type Event interface {
+	event()
+}
+
+// Status is what the app shows it's doing
+type Status int
+
+const (
+	StatusIdle       Status = iota
+	StatusRecording         // capturing a dictation
+	StatusProcessing        // transcribing, injecting or redoing
+	StatusListening         // hands-free listening
+	StatusError             // the last dictation failed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusIdle:
+		return "idle"
+	case StatusRecording:
+		return "recording"
+	case StatusProcessing:
+		return "processing"
+	case StatusListening:
+		return "listening"
+	case StatusError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// Cause says what went wrong in an Error
+type Cause int
+
+const (
+	CauseAudio         Cause = iota // the microphone couldn't be captured
+	CauseSession                    // a transcription session couldn't start
+	CauseTranscription              // decoding a dictation failed
+	CauseModel                      // a model couldn't be downloaded or loaded
+	CauseRedo                       // re-transcribing the last dictation failed
+	CausePanic                      // a goroutine crashed and was recovered
+)
+
+func (c Cause) String() string {
+	switch c {
+	case CauseAudio:
+		return "audio"
+	case CauseSession:
+		return "session"
+	case CauseTranscription:
+		return "transcription"
+	case CauseModel:
+		return "model"
+	case CauseRedo:
+		return "redo"
+	case CausePanic:
+		return "panic"
+	}
+	return "unknown"
+}
+
+// Events name the dictation they belong to by ID. Text that doesn't come
+// from a single dictation, such as a committed draft, a redo or an utterance
+// heard while listening hands-free, has ID 0.
+
+// StateChanged reports the app's status
+type StateChanged struct {
+	Status Status
+}
+
+// DictationStarted reports a dictation began recording
+type DictationStarted struct {
+	ID int
+}
+
+// DictationStopped reports a dictation stopped recording. Reason is empty
+// when the hotkey stopped it, otherwise why it stopped on its own.
+type DictationStopped struct {
+	ID     int
+	Reason string
+}
+
+// AudioLevel is the RMS level of a chunk of audio being recorded
+type AudioLevel struct {
+	ID    int
+	Level float64
+}
+
+// Partial is a live guess at what's being said
+type Partial struct {
+	ID   int
+	Text string
+}
+
+// Final is the filtered transcript of a dictation, about to be injected or
+// added to the draft
+type Final struct {
+	ID   int
+	Text string
+}
+
+// Injected reports text was typed or pasted
+type Injected struct {
+	ID   int
+	Text string
+}
+
+// InjectionFailed reports text couldn't be typed or pasted
+type InjectionFailed struct {
+	ID   int
+	Text string
+	Err  error
+}
+
+// DraftChanged reports the append-mode draft; Text is empty once there's
+// none
+type DraftChanged struct {
+	Text string
+}
+
+// ModelLoading reports a model being downloaded or loaded. Total is 0 when
+// the download size is unknown or nothing is being downloaded.
+type ModelLoading struct {
+	Model      string
+	Downloaded int64
+	Total      int64
+}
+
+// ModelReady reports a model finished loading
+type ModelReady struct {
+	Model string
+}
+
+// Error reports something failed outside the normal flow of a dictation
+type Error struct {
+	Cause Cause
+	Err   error
+}
+
+func (StateChanged) event()     {}
+func (DictationStarted) event() {}
+func (DictationStopped) event() {}
+func (AudioLevel) event()       {}
+func (Partial) event()          {}
+func (Final) event()            {}
+func (Injected) event()         {}
+func (InjectionFailed) event()  {}
+func (DraftChanged) event()     {}
+func (ModelLoading) event()     {}
+func (ModelReady) event()       {}
+func (Error) event()            {}
+
+// Bus delivers each published event to every subscriber. A nil Bus drops
+// everything, so code that publishes works without one.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// NewBus returns a bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives the events published after it was made
+type Subscription struct {
+	bus     *Bus
+	c       chan Event
+	want    func(Event) bool
+	dropped atomic.Uint64
+}
+
+// Subscribe starts receiving events. Up to buffer events are queued for the
+// subscriber; a buffer of 0 or less uses DefaultBuffer.
+func (b *Bus) Subscribe(buffer int) *Subscription {
+	return b.SubscribeFiltered(buffer, nil)
+}
+
+// SubscribeFiltered is Subscribe for only the events want accepts, so a
+// subscriber that ignores frequent ones like AudioLevel doesn't fill its
+// queue with them. A nil want accepts everything.
+func (b *Bus) SubscribeFiltered(buffer int, want func(Event) bool) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	s := &Subscription{bus: b, c: make(chan Event, buffer), want: want}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Publish queues ev for every subscriber without blocking. A subscriber
+// whose queue is full misses ev, and its Dropped count goes up.
+func (b *Bus) Publish(ev Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		if s.want != nil && !s.want(ev) {
+			continue
+		}
+		select {
+		case s.c <- ev:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Events returns the channel events arrive on. It's closed by Close.
+func (s *Subscription) Events() <-chan Event {
+	return s.c
+}
+
+// Dropped reports how many events were missed because the queue was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops delivery and closes the Events channel
+func (s *Subscription) Close() {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	close(s.c)
+}
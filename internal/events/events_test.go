@@ -0,0 +1,80 @@
+package events
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPublishReachesEverySubscriber(t *testing.T) {
+	b := NewBus()
+	first, second := b.Subscribe(4), b.Subscribe(4)
+
+	b.Publish(DictationStarted{ID: 1})
+	b.Publish(StateChanged{Status: StatusRecording})
+
+	for _, s := range []*Subscription{first, second} {
+		if ev := <-s.Events(); ev != (DictationStarted{ID: 1}) {
+			t.Fatalf("expected the dictation start first, got %#v", ev)
+		}
+		if ev := <-s.Events(); ev != (StateChanged{Status: StatusRecording}) {
+			t.Fatalf("expected the state change second, got %#v", ev)
+		}
+	}
+}
+
+func TestPublishDoesNotBlockOnFullSubscriber(t *testing.T) {
+	b := NewBus()
+	slow, fast := b.Subscribe(1), b.Subscribe(8)
+
+	for i := 1; i <= 3; i++ {
+		b.Publish(AudioLevel{ID: i})
+	}
+
+	if n := slow.Dropped(); n != 2 {
+		t.Fatalf("expected the slow subscriber to miss 2 events, missed %d", n)
+	}
+	if ev := <-slow.Events(); ev != (AudioLevel{ID: 1}) {
+		t.Fatalf("expected the slow subscriber to keep the first event, got %#v", ev)
+	}
+	if n := fast.Dropped(); n != 0 || len(fast.Events()) != 3 {
+		t.Fatalf("expected the fast subscriber to get all 3 events, missed %d", n)
+	}
+}
+
+func TestSubscribeFiltered(t *testing.T) {
+	b := NewBus()
+	s := b.SubscribeFiltered(1, func(ev Event) bool {
+		_, level := ev.(AudioLevel)
+		return !level
+	})
+
+	for i := 1; i <= 3; i++ {
+		b.Publish(AudioLevel{ID: i})
+	}
+	b.Publish(StateChanged{Status: StatusIdle})
+
+	if n := s.Dropped(); n != 0 {
+		t.Fatalf("expected filtered events not to count as dropped, got %d", n)
+	}
+	if ev := <-s.Events(); ev != (StateChanged{Status: StatusIdle}) {
+		t.Fatalf("expected only the state change, got %#v", ev)
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := NewBus()
+	s := b.Subscribe(0)
+
+	s.Close()
+	s.Close()
+	b.Publish(Error{Cause: CauseAudio, Err: errors.New("unplugged")})
+
+	if _, ok := <-s.Events(); ok {
+		t.Fatal("expected the channel closed with nothing delivered")
+	}
+}
+
+func TestNilBusDropsEvents(t *testing.T) {
+	var b *Bus
+	b.Publish(StateChanged{Status: StatusIdle})
+}
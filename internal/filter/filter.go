@@ -0,0 +1,193 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/whisper"
+)
+
+// nonSpeechSounds are the sounds whisper annotates in parentheses or
+// asterisks, as in "(music)" or "*laughs*". Dictated text uses both for
+// ordinary words, so only these are taken to be annotations.
+var nonSpeechSounds = []string{
+	"applause", "background noise", "beep", "blank_audio", "breathing", "chuckles",
+	"clapping", "coughing", "coughs", "crying", "gasps", "inaudible", "laughing",
+	"laughs", "laughter", "music", "no speech", "noise", "sighs", "silence",
+	"sniffs", "static", "wind",
+}
+
+// nonSpeechPattern matches the annotations whisper emits for silence, music
+// and background noise, e.g. "[BLANK_AUDIO]", "(upbeat music)", "*laughs*"
+// or "♪". Square brackets never come from dictation, so anything in them is
+// an annotation; a parenthesized or starred one must name a known sound,
+// optionally with a word before it.
+var nonSpeechPattern = func() *regexp.Regexp {
+	sound := `(?i:(?:[a-z]+ )?(?:` + strings.Join(nonSpeechSounds, "|") + `)(?: playing)?)`
+	return regexp.MustCompile(`\[[^\]]*\]|\(` + sound + `\)|\*` + sound + `\*|[♪♫]+`)
+}()
+
+var spacePattern = regexp.MustCompile(`\s+`)
+
+// Hallucination drops output whisper is known to invent on silent or noisy
+// input before it is injected into the focused window.
+type Hallucination struct {
+	cfg       config.FilterConfig
+	blocklist map[string]bool
+}
+
+// New creates a hallucination filter from config
+func New(cfg config.FilterConfig) *Hallucination {
+	blocklist := make(map[string]bool, len(cfg.Blocklist))
+	for _, phrase := range cfg.Blocklist {
+		if key := normalize(phrase); key != "" {
+			blocklist[key] = true
+		}
+	}
+	return &Hallucination{
+		cfg:       cfg,
+		blocklist: blocklist,
+	}
+}
+
+// ForBackend returns cfg with the settings the whisper backend can't honour
+// turned off, warning about each one that was set
+func ForBackend(cfg config.FilterConfig, backend config.WhisperConfig) config.FilterConfig {
+	if cfg.NoSpeechThreshold > 0 && !whisper.ReportsNoSpeechProb(backend) {
+		log.Warn().
+			Float64("no_speech_threshold", cfg.NoSpeechThreshold).
+			Msg("Only the http backend reports no-speech probabilities; ignoring filter.no_speech_threshold")
+		cfg.NoSpeechThreshold = 0
+	}
+	return cfg
+}
+
+// Keep reports whether a segment should be kept. Segments are dropped when
+// they match the blocklist, or when the decoder thought there was no speech
+// and wasn't confident in the text. As in whisper's own decoder a low
+// average log-prob never drops a segment on its own: short dictations from
+// the smaller models often score low.
+func (h *Hallucination) Keep(seg whisper.Segment) bool {
+	if h.cfg.NoSpeechThreshold > 0 && seg.NoSpeechProb > h.cfg.NoSpeechThreshold {
+		confident := h.cfg.LogProbThreshold < 0 && seg.AvgLogProb != 0 && seg.AvgLogProb >= h.cfg.LogProbThreshold
+		if !confident {
+			return false
+		}
+	}
+
+	text := seg.Text
+	if h.cfg.DropNonSpeech {
+		text = StripNonSpeech(text)
+	}
+	key := normalize(text)
+	if key == "" {
+		return false
+	}
+	return !h.blocklist[key]
+}
+
+// Clean strips non-speech annotations and collapses repetition loops in
+// text that has already passed Keep.
+func (h *Hallucination) Clean(text string) string {
+	if h.cfg.DropNonSpeech {
+		text = StripNonSpeech(text)
+	}
+	if h.cfg.MaxRepeats > 0 {
+		text = CollapseRepeats(text, h.cfg.MaxRepeats)
+	}
+	return text
+}
+
+// Segments applies Keep and Clean to a whole transcript, for callers that
+// write files rather than inject text. A nil filter keeps everything.
+func (h *Hallucination) Segments(segments []whisper.Segment) []whisper.Segment {
+	if h == nil {
+		return segments
+	}
+	kept := make([]whisper.Segment, 0, len(segments))
+	for _, seg := range segments {
+		if !h.Keep(seg) {
+			continue
+		}
+		seg.Text = h.Clean(seg.Text)
+		kept = append(kept, seg)
+	}
+	return kept
+}
+
+// StripNonSpeech removes bracketed non-speech tokens and tidies whitespace
+func StripNonSpeech(text string) string {
+	text = nonSpeechPattern.ReplaceAllString(text, " ")
+	return strings.TrimSpace(spacePattern.ReplaceAllString(text, " "))
+}
+
+// CollapseRepeats shortens any run of a word sequence repeated back-to-back
+// more than max times down to max occurrences. Whisper falls into such loops
+// ("I'm going to go. I'm going to go. I'm going to go.") on noisy input.
+func CollapseRepeats(text string, max int) string {
+	words := strings.Fields(text)
+	if max < 1 || len(words) < 2 {
+		return text
+	}
+
+	changed := false
+	for size := 1; size <= len(words)/2; size++ {
+		out := make([]string, 0, len(words))
+		for i := 0; i < len(words); {
+			// Count consecutive repeats of the sequence starting at i
+			runs := 1
+			for i+(runs+1)*size <= len(words) && sameWords(words[i:i+size], words[i+runs*size:i+(runs+1)*size]) {
+				runs++
+			}
+			if runs > max {
+				for r := 0; r < max; r++ {
+					out = append(out, words[i:i+size]...)
+				}
+				i += runs * size
+				changed = true
+				continue
+			}
+			out = append(out, words[i])
+			i++
+		}
+		words = out
+	}
+
+	if !changed {
+		return text
+	}
+	return strings.Join(words, " ")
+}
+
+func sameWords(a, b []string) bool {
+	for i := range a {
+		if normalize(a[i]) != normalize(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize lowercases text and drops punctuation so that "Thanks for
+// watching!" and "thanks for watching" compare equal.
+func normalize(text string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			space = true
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,146 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/whisper"
+)
+
+func TestKeep(t *testing.T) {
+	h := New(config.FilterConfig{
+		DropNonSpeech:     true,
+		NoSpeechThreshold: 0.6,
+		LogProbThreshold:  -1.0,
+		Blocklist:         []string{"Thank you for watching."},
+	})
+
+	tests := []struct {
+		name string
+		seg  whisper.Segment
+		want bool
+	}{
+		{"plain speech", whisper.Segment{Text: "Hello world."}, true},
+		{"blank audio", whisper.Segment{Text: "[BLANK_AUDIO]"}, false},
+		{"music", whisper.Segment{Text: " (music) ♪"}, false},
+		{"blocklisted", whisper.Segment{Text: "Thank you for watching!"}, false},
+		{"blocklisted with annotation", whisper.Segment{Text: "[Music] thank you for watching"}, false},
+		{"blocklist phrase inside speech", whisper.Segment{Text: "Thank you for watching the kids."}, true},
+		{"high no-speech prob", whisper.Segment{Text: "Hello.", NoSpeechProb: 0.8}, false},
+		{"low no-speech prob", whisper.Segment{Text: "Hello.", NoSpeechProb: 0.2}, true},
+		{"high no-speech prob, low confidence", whisper.Segment{Text: "Hello.", NoSpeechProb: 0.8, AvgLogProb: -1.7}, false},
+		{"high no-speech prob, good confidence", whisper.Segment{Text: "Hello.", NoSpeechProb: 0.8, AvgLogProb: -0.3}, true},
+		{"low confidence alone", whisper.Segment{Text: "Hello.", AvgLogProb: -1.7}, true},
+		{"good confidence", whisper.Segment{Text: "Hello.", AvgLogProb: -0.3}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.Keep(tt.seg); got != tt.want {
+				t.Fatalf("Keep(%q) = %v, want %v", tt.seg.Text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeepLowConfidenceWithoutNoSpeechProb(t *testing.T) {
+	// The defaults on a backend that doesn't report no-speech probabilities
+	cfg := config.FilterConfig{NoSpeechThreshold: 0.6, LogProbThreshold: -1.0}
+	h := New(ForBackend(cfg, config.WhisperConfig{Backend: "bindings"}))
+
+	if !h.Keep(whisper.Segment{Text: "Ship it.", AvgLogProb: -1.4}) {
+		t.Fatal("expected a low-confidence dictation kept when nothing says it was silence")
+	}
+}
+
+func TestKeepThresholdsDisabled(t *testing.T) {
+	h := New(config.FilterConfig{})
+
+	seg := whisper.Segment{Text: "[BLANK_AUDIO]", AvgLogProb: -5, NoSpeechProb: 0.99}
+	if !h.Keep(seg) {
+		t.Fatal("expected segment to be kept with all filters disabled")
+	}
+}
+
+func TestForBackendKeepsNoSpeechThresholdForHTTPOnly(t *testing.T) {
+	tests := []struct {
+		backend config.WhisperConfig
+		want    float64
+	}{
+		{config.WhisperConfig{Backend: ""}, 0},
+		{config.WhisperConfig{Backend: "bindings"}, 0},
+		{config.WhisperConfig{Backend: "cli"}, 0},
+		{config.WhisperConfig{Backend: "http"}, 0.6},
+		{config.WhisperConfig{Backend: "http", Offline: true}, 0},
+	}
+	for _, tt := range tests {
+		got := ForBackend(config.FilterConfig{NoSpeechThreshold: 0.6, MaxRepeats: 2}, tt.backend)
+		if got.NoSpeechThreshold != tt.want || got.MaxRepeats != 2 {
+			t.Errorf("backend %q offline=%v: got threshold %v, want %v", tt.backend.Backend, tt.backend.Offline, got.NoSpeechThreshold, tt.want)
+		}
+	}
+}
+
+func TestSegments(t *testing.T) {
+	h := New(config.FilterConfig{DropNonSpeech: true, MaxRepeats: 1})
+
+	got := h.Segments([]whisper.Segment{
+		{Text: " Go. Go. [BLANK_AUDIO]", End: 1},
+		{Text: " [BLANK_AUDIO]", End: 2},
+		{Text: " Done.", End: 3},
+	})
+	if len(got) != 2 || got[0].Text != "Go." || got[1].Text != "Done." || got[1].End != 3 {
+		t.Fatalf("unexpected segments %+v", got)
+	}
+
+	var none *Hallucination
+	if got := none.Segments([]whisper.Segment{{Text: "[BLANK_AUDIO]"}}); len(got) != 1 {
+		t.Fatal("expected a nil filter to keep everything")
+	}
+}
+
+func TestStripNonSpeech(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"[BLANK_AUDIO]", ""},
+		{"Hello [inaudible] world", "Hello world"},
+		{"*laughs* that's funny", "that's funny"},
+		{"(upbeat music) Welcome back.", "Welcome back."},
+		{"No annotations here.", "No annotations here."},
+		{"(Music playing) *coughs* Hi", "Hi"},
+		{"call me (after lunch) please", "call me (after lunch) please"},
+		{"that was *really* good", "that was *really* good"},
+		{"(music)", ""},
+	}
+
+	for _, tt := range tests {
+		if got := StripNonSpeech(tt.in); got != tt.want {
+			t.Errorf("StripNonSpeech(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCollapseRepeats(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		max  int
+		want string
+	}{
+		{"no repeats", "the quick brown fox", 2, "the quick brown fox"},
+		{"word loop", "no no no no no", 2, "no no"},
+		{"phrase loop", "I'm going to go. I'm going to go. I'm going to go. I'm going to go.", 1, "I'm going to go."},
+		{"within limit", "very very good", 2, "very very good"},
+		{"loop after speech", "Send it. Okay. Okay. Okay. Okay.", 1, "Send it. Okay."},
+		{"disabled", "no no no", 0, "no no no"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CollapseRepeats(tt.in, tt.max); got != tt.want {
+				t.Fatalf("CollapseRepeats(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+			}
+		})
+	}
+}
@@ -7,7 +7,7 @@ package hotkey
 #include <Carbon/Carbon.h>
 
 // Forward declaration for Go callback
-extern void goHotkeyCallback(int pressed);
+extern void goHotkeyCallback(int id, int pressed);
 
 // Event handler for hotkeys
 static OSStatus hotkeyHandler(EventHandlerCallRef nextHandler, EventRef theEvent, void* userData) {
@@ -17,38 +17,21 @@ static OSStatus hotkeyHandler(EventHandlerCallRef nextHandler, EventRef theEvent
     UInt32 eventKind = GetEventKind(theEvent);
     int pressed = (eventKind == kEventHotKeyPressed) ? 1 : 0;
 
-    goHotkeyCallback(pressed);
+    goHotkeyCallback((int)hkRef.id, pressed);
 
     return noErr;
 }
 
-// Hotkey registration state (stored for cleanup)
-typedef struct {
-    EventHandlerRef handlerRef;
-    EventHandlerUPP handlerUPP;
-    EventHotKeyRef hotKeyRef;
-    int registered;
-} HotkeyState;
-
-static HotkeyState gHotkeyState = {NULL, NULL, NULL, 0};
-
-// Register hotkey with Carbon
-static int registerHotkey(UInt32 keyCode, UInt32 modifiers) {
-    // Clean up existing registration if any
-    if (gHotkeyState.registered) {
-        if (gHotkeyState.hotKeyRef) {
-            UnregisterEventHotKey(gHotkeyState.hotKeyRef);
-            gHotkeyState.hotKeyRef = NULL;
-        }
-        if (gHotkeyState.handlerRef) {
-            RemoveEventHandler(gHotkeyState.handlerRef);
-            gHotkeyState.handlerRef = NULL;
-        }
-        if (gHotkeyState.handlerUPP) {
-            DisposeEventHandlerUPP(gHotkeyState.handlerUPP);
-            gHotkeyState.handlerUPP = NULL;
-        }
-        gHotkeyState.registered = 0;
+#define MAX_HOTKEYS 16
+
+// One application event handler dispatches every registered hotkey by id
+static EventHandlerRef gHandlerRef = NULL;
+static EventHandlerUPP gHandlerUPP = NULL;
+static EventHotKeyRef gHotKeyRefs[MAX_HOTKEYS];
+
+static int installHandler() {
+    if (gHandlerRef != NULL) {
+        return 1;
     }
 
     EventTypeSpec eventTypes[2];
@@ -57,69 +40,78 @@ static int registerHotkey(UInt32 keyCode, UInt32 modifiers) {
     eventTypes[1].eventClass = kEventClassKeyboard;
     eventTypes[1].eventKind = kEventHotKeyReleased;
 
-    gHotkeyState.handlerUPP = NewEventHandlerUPP(hotkeyHandler);
+    gHandlerUPP = NewEventHandlerUPP(hotkeyHandler);
     OSStatus status = InstallApplicationEventHandler(
-        gHotkeyState.handlerUPP,
+        gHandlerUPP,
         2,
         eventTypes,
         NULL,
-        &gHotkeyState.handlerRef
+        &gHandlerRef
     );
 
     if (status != noErr) {
-        DisposeEventHandlerUPP(gHotkeyState.handlerUPP);
-        gHotkeyState.handlerUPP = NULL;
+        DisposeEventHandlerUPP(gHandlerUPP);
+        gHandlerUPP = NULL;
+        gHandlerRef = NULL;
+        return 0;
+    }
+    return 1;
+}
+
+// Unregister the hotkey with the given id, if any
+static void unregisterHotkey(int id) {
+    if (id <= 0 || id >= MAX_HOTKEYS || gHotKeyRefs[id] == NULL) {
+        return;
+    }
+    UnregisterEventHotKey(gHotKeyRefs[id]);
+    gHotKeyRefs[id] = NULL;
+}
+
+// Register hotkey with Carbon under id (1..MAX_HOTKEYS-1)
+static int registerHotkey(int id, UInt32 keyCode, UInt32 modifiers) {
+    if (id <= 0 || id >= MAX_HOTKEYS) {
+        return 0;
+    }
+    if (!installHandler()) {
         return 0;
     }
+    unregisterHotkey(id);
 
     EventHotKeyID hotKeyID;
     hotKeyID.signature = 'htk1';
-    hotKeyID.id = 1;
+    hotKeyID.id = id;
 
-    status = RegisterEventHotKey(
+    OSStatus status = RegisterEventHotKey(
         keyCode,
         modifiers,
         hotKeyID,
         GetApplicationEventTarget(),
         0,
-        &gHotkeyState.hotKeyRef
+        &gHotKeyRefs[id]
     );
 
     if (status != noErr) {
-        RemoveEventHandler(gHotkeyState.handlerRef);
-        DisposeEventHandlerUPP(gHotkeyState.handlerUPP);
-        gHotkeyState.handlerRef = NULL;
-        gHotkeyState.handlerUPP = NULL;
-        gHotkeyState.hotKeyRef = NULL;
+        gHotKeyRefs[id] = NULL;
         return 0;
     }
-
-    gHotkeyState.registered = 1;
     return 1;
 }
 
-// Unregister and cleanup hotkey resources
-static void unregisterHotkey() {
-    if (!gHotkeyState.registered) {
-        return;
-    }
-
-    if (gHotkeyState.hotKeyRef) {
-        UnregisterEventHotKey(gHotkeyState.hotKeyRef);
-        gHotkeyState.hotKeyRef = NULL;
+// Unregister every hotkey and remove the event handler
+static void unregisterAll() {
+    for (int i = 1; i < MAX_HOTKEYS; i++) {
+        unregisterHotkey(i);
     }
 
-    if (gHotkeyState.handlerRef) {
-        RemoveEventHandler(gHotkeyState.handlerRef);
-        gHotkeyState.handlerRef = NULL;
+    if (gHandlerRef) {
+        RemoveEventHandler(gHandlerRef);
+        gHandlerRef = NULL;
     }
 
-    if (gHotkeyState.handlerUPP) {
-        DisposeEventHandlerUPP(gHotkeyState.handlerUPP);
-        gHotkeyState.handlerUPP = NULL;
+    if (gHandlerUPP) {
+        DisposeEventHandlerUPP(gHandlerUPP);
+        gHandlerUPP = NULL;
     }
-
-    gHotkeyState.registered = 0;
 }
 */
 import "C"
@@ -127,6 +119,11 @@ import "C"
 import (
 	"fmt"
 	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/petems/whisper-tray/internal/supervise"
 )
 
 const (
@@ -269,51 +266,100 @@ func parseAccelerator(accel string) (C.UInt32, C.UInt32, error) {
 	return C.UInt32(keyCode), C.UInt32(modifiers), nil
 }
 
+// maxHotkeys mirrors MAX_HOTKEYS; ids start at 1
+const maxHotkeys = 16
+
 type darwinManager struct {
-	callback func(bool)
+	mu        sync.Mutex
+	ids       map[string]int // accelerator -> hotkey id
+	callbacks map[int]func(bool)
 }
 
 var globalManager *darwinManager
 
 // New creates a new macOS hotkey manager using Carbon
 func New() (Manager, error) {
-	mgr := &darwinManager{}
+	mgr := &darwinManager{
+		ids:       make(map[string]int),
+		callbacks: make(map[int]func(bool)),
+	}
+	globalManager = mgr
 	return mgr, nil
 }
 
 //export goHotkeyCallback
-func goHotkeyCallback(pressed C.int) {
-	if globalManager != nil && globalManager.callback != nil {
-		globalManager.callback(pressed == 1)
+func goHotkeyCallback(id C.int, pressed C.int) {
+	m := globalManager
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	callback := m.callbacks[int(id)]
+	m.mu.Unlock()
+
+	// A panic can't unwind through the Carbon event handler that called us
+	if callback != nil {
+		supervise.Run(log.Logger, "hotkey callback", func() { callback(pressed == 1) }, nil)
 	}
 }
 
 func (m *darwinManager) Register(accel string, callback func(pressed bool)) error {
-	m.callback = callback
-	globalManager = m
-
 	keyCode, modifiers, err := parseAccelerator(accel)
 	if err != nil {
 		return fmt.Errorf("failed to parse accelerator %q: %w", accel, err)
 	}
 
-	ret := C.registerHotkey(keyCode, modifiers)
-	if ret == 0 {
-		return fmt.Errorf("failed to register hotkey")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.ids[accel]
+	if !ok {
+		id = m.freeIDLocked()
+		if id == 0 {
+			return fmt.Errorf("too many hotkeys registered")
+		}
 	}
 
+	if C.registerHotkey(C.int(id), keyCode, modifiers) == 0 {
+		return fmt.Errorf("failed to register hotkey %q", accel)
+	}
+
+	m.ids[accel] = id
+	m.callbacks[id] = callback
 	return nil
 }
 
+func (m *darwinManager) freeIDLocked() int {
+	for id := 1; id < maxHotkeys; id++ {
+		if _, used := m.callbacks[id]; !used {
+			return id
+		}
+	}
+	return 0
+}
+
 func (m *darwinManager) Unregister(accel string) error {
-	C.unregisterHotkey()
-	m.callback = nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.ids[accel]
+	if !ok {
+		return nil
+	}
+	C.unregisterHotkey(C.int(id))
+	delete(m.ids, accel)
+	delete(m.callbacks, id)
 	return nil
 }
 
 func (m *darwinManager) Close() error {
-	C.unregisterHotkey()
-	m.callback = nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	C.unregisterAll()
+	m.ids = make(map[string]int)
+	m.callbacks = make(map[int]func(bool))
 	globalManager = nil
 	return nil
 }
@@ -5,27 +5,63 @@ package hotkey
 /*
 #cgo pkg-config: x11 xtst
 #include <X11/Xlib.h>
+#include <X11/XKBlib.h>
 #include <X11/keysym.h>
 #include <X11/extensions/XTest.h>
 #include <stdlib.h>
 
 Display* displayPtr = NULL;
 
-int grabKey(int keycode, int modifiers) {
+static int openDisplay() {
     if (displayPtr == NULL) {
+        // Register/Unregister and the event loop run on different threads
+        XInitThreads();
         displayPtr = XOpenDisplay(NULL);
+        // Without this a held key repeats as release/press pairs, which
+        // Hybrid mode would read as the hotkey being let go and tapped
+        if (displayPtr != NULL) {
+            XkbSetDetectableAutoRepeat(displayPtr, True, NULL);
+        }
     }
-    if (displayPtr == NULL) return 0;
+    return displayPtr != NULL;
+}
+
+// keycodeFor resolves a keysym name such as "space" or "F5"; 0 if unknown
+int keycodeFor(const char* name) {
+    if (!openDisplay()) return 0;
+
+    KeySym sym = XStringToKeysym(name);
+    if (sym == NoSymbol) return 0;
+    return XKeysymToKeycode(displayPtr, sym);
+}
+
+// Lock modifiers that must not stop a hotkey from firing
+static const unsigned int ignoredMasks[] = {0, LockMask, Mod2Mask, LockMask | Mod2Mask};
+
+int grabKey(int keycode, int modifiers) {
+    if (!openDisplay()) return 0;
 
     Window root = DefaultRootWindow(displayPtr);
-    XGrabKey(displayPtr, keycode, modifiers, root, False, GrabModeAsync, GrabModeAsync);
+    for (int i = 0; i < 4; i++) {
+        XGrabKey(displayPtr, keycode, modifiers | ignoredMasks[i], root, False, GrabModeAsync, GrabModeAsync);
+    }
     XSelectInput(displayPtr, root, KeyPressMask | KeyReleaseMask);
     XSync(displayPtr, False);
 
     return 1;
 }
 
-int checkEvent(int* keycode, int* pressed) {
+void ungrabKey(int keycode, int modifiers) {
+    if (displayPtr == NULL) return;
+
+    Window root = DefaultRootWindow(displayPtr);
+    for (int i = 0; i < 4; i++) {
+        XUngrabKey(displayPtr, keycode, modifiers | ignoredMasks[i], root);
+    }
+    XSync(displayPtr, False);
+}
+
+int checkEvent(int* keycode, int* state, int* pressed) {
     if (displayPtr == NULL) return 0;
 
     XEvent event;
@@ -33,6 +69,7 @@ int checkEvent(int* keycode, int* pressed) {
         XNextEvent(displayPtr, &event);
         if (event.type == KeyPress || event.type == KeyRelease) {
             *keycode = event.xkey.keycode;
+            *state = event.xkey.state;
             *pressed = (event.type == KeyPress) ? 1 : 0;
             return 1;
         }
@@ -44,38 +81,140 @@ import "C"
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 	"time"
+	"unsafe"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/petems/whisper-tray/internal/supervise"
+)
+
+// X11 modifier masks
+const (
+	shiftMask   = 1 << 0
+	controlMask = 1 << 2
+	mod1Mask    = 1 << 3 // Alt
+	mod4Mask    = 1 << 6 // Super
+
+	modifierMasks = shiftMask | controlMask | mod1Mask | mod4Mask
 )
 
+var modifierLookup = map[string]int{
+	"shift":   shiftMask,
+	"ctrl":    controlMask,
+	"control": controlMask,
+	"alt":     mod1Mask,
+	"option":  mod1Mask,
+	"opt":     mod1Mask,
+	"super":   mod4Mask,
+	"meta":    mod4Mask,
+	"cmd":     mod4Mask,
+	"command": mod4Mask,
+}
+
+// keysymNames maps accelerator key names to X keysym names where they differ
+var keysymNames = map[string]string{
+	"SPACE":     "space",
+	"TAB":       "Tab",
+	"ESC":       "Escape",
+	"ESCAPE":    "Escape",
+	"RETURN":    "Return",
+	"ENTER":     "Return",
+	"DELETE":    "Delete",
+	"BACKSPACE": "BackSpace",
+	"GRAVE":     "grave",
+	"BACKQUOTE": "grave",
+}
+
+// binding is a grabbed key combination
+type binding struct {
+	keycode   int
+	modifiers int
+}
+
+// parseAccelerator turns "Alt+Space" into a keysym name and modifier mask
+func parseAccelerator(accel string) (string, int, error) {
+	if accel == "" {
+		return "", 0, fmt.Errorf("accelerator string is empty")
+	}
+
+	var modifiers int
+	var keyToken string
+	for _, token := range strings.Split(accel, "+") {
+		t := strings.TrimSpace(token)
+		if t == "" {
+			continue
+		}
+		if mask, ok := modifierLookup[strings.ToLower(t)]; ok {
+			modifiers |= mask
+			continue
+		}
+		keyToken = strings.ToUpper(t)
+	}
+
+	if keyToken == "" {
+		return "", 0, fmt.Errorf("missing base key in accelerator %q", accel)
+	}
+
+	switch {
+	case keysymNames[keyToken] != "":
+		return keysymNames[keyToken], modifiers, nil
+	case len(keyToken) == 1:
+		// Letter keysyms are lower case; digits are themselves
+		return strings.ToLower(keyToken), modifiers, nil
+	case keyToken[0] == 'F':
+		return keyToken, modifiers, nil
+	}
+	return "", 0, fmt.Errorf("unsupported key %q", keyToken)
+}
+
 type linuxManager struct {
-	callbacks map[int]func(bool)
+	mu        sync.Mutex
+	bindings  map[string]binding // accelerator -> grab
+	callbacks map[binding]func(bool)
+	held      map[int]binding // keycode -> binding it was pressed as
 	stop      chan struct{}
 }
 
 // New creates a new Linux hotkey manager using X11
 func New() (Manager, error) {
 	mgr := &linuxManager{
-		callbacks: make(map[int]func(bool)),
+		bindings:  make(map[string]binding),
+		callbacks: make(map[binding]func(bool)),
+		held:      make(map[int]binding),
 		stop:      make(chan struct{}),
 	}
 
-	go mgr.eventLoop()
+	go supervise.Loop(log.Logger, "hotkey event loop", mgr.eventLoop, nil)
 
 	return mgr, nil
 }
 
 func (m *linuxManager) Register(accel string, callback func(pressed bool)) error {
-	// TODO: Parse "Alt+Space" -> keycode and modifiers
-	// For now, hardcoded to Space (keycode 65) + Alt (Mod1Mask = 8)
-	keycode := 65      // Space
-	modifiers := 8     // Mod1Mask (Alt)
+	name, modifiers, err := parseAccelerator(accel)
+	if err != nil {
+		return fmt.Errorf("failed to parse accelerator %q: %w", accel, err)
+	}
+
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	keycode := int(C.keycodeFor(cname))
+	if keycode == 0 {
+		return fmt.Errorf("no keycode for %q (is an X display available?)", accel)
+	}
 
-	ret := C.grabKey(C.int(keycode), C.int(modifiers))
-	if ret == 0 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := binding{keycode: keycode, modifiers: modifiers}
+	if C.grabKey(C.int(keycode), C.int(modifiers)) == 0 {
 		return fmt.Errorf("failed to grab key")
 	}
 
-	m.callbacks[keycode] = callback
+	m.bindings[accel] = b
+	m.callbacks[b] = callback
 	return nil
 }
 
@@ -88,22 +227,64 @@ func (m *linuxManager) eventLoop() {
 		case <-m.stop:
 			return
 		case <-ticker.C:
-			var keycode, pressed C.int
-			if C.checkEvent(&keycode, &pressed) != 0 {
-				if cb, ok := m.callbacks[int(keycode)]; ok {
-					cb(pressed == 1)
+			var keycode, state, pressed C.int
+			if C.checkEvent(&keycode, &state, &pressed) != 0 {
+				if cb := m.callbackFor(int(keycode), int(state), pressed == 1); cb != nil {
+					// A panicking callback mustn't take the other hotkeys with it
+					supervise.Run(log.Logger, "hotkey callback", func() { cb(pressed == 1) }, nil)
 				}
 			}
 		}
 	}
 }
 
+// callbackFor finds the callback for a key event. A release goes to whatever
+// the key was pressed as, since the modifiers may already be up by then.
+func (m *linuxManager) callbackFor(keycode, state int, pressed bool) func(bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !pressed {
+		b, ok := m.held[keycode]
+		if !ok {
+			return nil
+		}
+		delete(m.held, keycode)
+		return m.callbacks[b]
+	}
+
+	b := binding{keycode: keycode, modifiers: state & modifierMasks}
+	cb, ok := m.callbacks[b]
+	if !ok {
+		return nil
+	}
+	m.held[keycode] = b
+	return cb
+}
+
 func (m *linuxManager) Unregister(accel string) error {
-	// TODO: XUngrabKey implementation
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.bindings[accel]
+	if !ok {
+		return nil
+	}
+	C.ungrabKey(C.int(b.keycode), C.int(b.modifiers))
+	delete(m.bindings, accel)
+	delete(m.callbacks, b)
 	return nil
 }
 
 func (m *linuxManager) Close() error {
+	m.mu.Lock()
+	for accel, b := range m.bindings {
+		C.ungrabKey(C.int(b.keycode), C.int(b.modifiers))
+		delete(m.bindings, accel)
+		delete(m.callbacks, b)
+	}
+	m.mu.Unlock()
+
 	close(m.stop)
 	return nil
-}
\ No newline at end of file
+}
@@ -7,4 +7,7 @@ type Injector interface {
 	Paste(ctx context.Context, text string) error
 	Type(ctx context.Context, text string) error
 	PasteOrType(ctx context.Context, text string) error
+	// Erase deletes the n characters before the cursor, used to replace
+	// text injected earlier
+	Erase(ctx context.Context, n int) error
 }
\ No newline at end of file
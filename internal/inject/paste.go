@@ -45,4 +45,12 @@ func (p *pasteInjector) PasteOrType(ctx context.Context, text string) error {
 		return p.Paste(ctx, text)
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// Erase sends n backspaces to the focused window
+func (p *pasteInjector) Erase(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	return platformErase(ctx, n)
+}
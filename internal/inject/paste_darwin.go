@@ -60,6 +60,32 @@ int sendPasteShortcut() {
 
     return 1;
 }
+
+// Send a single Delete (backspace) key press. Returns 1 on success, 0 on failure.
+int sendBackspace() {
+    CGEventSourceRef source = CGEventSourceCreate(kCGEventSourceStateHIDSystemState);
+    if (source == NULL) {
+        return 0;
+    }
+
+    CGEventRef down = CGEventCreateKeyboardEvent(source, (CGKeyCode)51, true); // Delete key
+    CGEventRef up = CGEventCreateKeyboardEvent(source, (CGKeyCode)51, false);
+    if (down == NULL || up == NULL) {
+        if (down != NULL) CFRelease(down);
+        if (up != NULL) CFRelease(up);
+        CFRelease(source);
+        return 0;
+    }
+
+    CGEventPost(kCGHIDEventTap, down);
+    CGEventPost(kCGHIDEventTap, up);
+
+    CFRelease(down);
+    CFRelease(up);
+    CFRelease(source);
+
+    return 1;
+}
 */
 import "C"
 
@@ -173,3 +199,20 @@ func platformType(ctx context.Context, text string) error {
 
 	return nil
 }
+
+// platformErase sends n backspaces using CGEvent
+func platformErase(ctx context.Context, n int) error {
+	for i := 0; i < n; i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if C.sendBackspace() == 0 {
+			return fmt.Errorf("failed to send backspace; ensure accessibility permission is granted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nil
+}
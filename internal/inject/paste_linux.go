@@ -17,4 +17,10 @@ func platformPaste(ctx context.Context, text string) error {
 // TODO: Implement using XTest (X11) or appropriate Wayland method
 func platformType(ctx context.Context, text string) error {
 	return fmt.Errorf("type not yet implemented on Linux")
-}
\ No newline at end of file
+}
+
+// platformErase sends backspaces on Linux
+// TODO: Implement alongside platformType
+func platformErase(ctx context.Context, n int) error {
+	return fmt.Errorf("erase not yet implemented on Linux")
+}
@@ -0,0 +1,231 @@
+// Package server exposes a whisper.Transcriber over an OpenAI-compatible
+// /v1/audio/transcriptions endpoint so other local tools can share the
+// loaded model.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/petems/whisper-tray/internal/audiofile"
+	"github.com/petems/whisper-tray/internal/filter"
+	"github.com/petems/whisper-tray/internal/transcript"
+	"github.com/petems/whisper-tray/internal/wav"
+	"github.com/petems/whisper-tray/internal/whisper"
+)
+
+// maxUploadBytes bounds an uploaded audio file
+const maxUploadBytes = 100 << 20
+
+// Options configures a Server
+type Options struct {
+	Token         string // bearer token clients must send; "" disables auth
+	MaxConcurrent int    // requests queued for the model, which decodes one at a time; more get a 429
+	Defaults      whisper.SessionOpts
+	Filter        *filter.Hallucination // may be nil
+	Logger        zerolog.Logger
+}
+
+// Server handles transcription requests
+type Server struct {
+	transcriber whisper.Transcriber
+	opts        Options
+	slots       chan struct{}
+	log         zerolog.Logger
+}
+
+// New creates a server that transcribes with t
+func New(t whisper.Transcriber, opts Options) *Server {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 1
+	}
+	return &Server{
+		transcriber: t,
+		opts:        opts,
+		slots:       make(chan struct{}, opts.MaxConcurrent),
+		log:         opts.Logger,
+	}
+}
+
+// Handler returns the HTTP routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/audio/transcriptions", s.authorized(s.handleTranscription))
+	return mux
+}
+
+// authorized rejects requests without the configured bearer token
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.opts.Token != "" {
+			got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(s.opts.Token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "invalid_api_key", "missing or invalid bearer token")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleTranscription(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "use POST")
+		return
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, "rate_limit_exceeded", "too many concurrent transcriptions")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("expected a multipart form: %v", err))
+		return
+	}
+
+	format := r.FormValue("response_format")
+	if format == "" {
+		format = "json"
+	}
+	if !transcript.Valid(format) {
+		writeError(w, http.StatusBadRequest, "invalid_request_error",
+			fmt.Sprintf("response_format must be one of %s", strings.Join(transcript.Formats, ", ")))
+		return
+	}
+
+	opts := s.opts.Defaults
+	if lang := r.FormValue("language"); lang != "" {
+		opts.Language = lang
+	}
+	if temp := r.FormValue("temperature"); temp != "" {
+		v, err := strconv.ParseFloat(temp, 32)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request_error", "temperature must be a number")
+			return
+		}
+		opts.Temperature = float32(v)
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "missing audio file")
+		return
+	}
+	defer file.Close()
+
+	samples, err := s.decodeUpload(file, header.Filename)
+	if errors.Is(err, audiofile.ErrNoFFmpeg) {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "only WAV audio is supported: ffmpeg isn't installed on the server")
+		return
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	start := time.Now()
+	segments, err := s.transcribe(samples, opts)
+	if err != nil {
+		s.log.Error().Err(err).Msg("Transcription request failed")
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	duration := time.Duration(len(samples)) * time.Second / 16000
+	s.log.Info().
+		Dur("audio", duration).
+		Dur("process_time", time.Since(start)).
+		Str("format", format).
+		Msg("Served transcription")
+
+	w.Header().Set("Content-Type", transcript.ContentType(format))
+	transcript.Write(w, format, segments, duration)
+}
+
+// decodeUpload returns an uploaded file as 16 kHz samples. WAV is read
+// directly; other formats such as mp3, m4a or webm are written to a
+// temporary file for ffmpeg to decode.
+func (s *Server) decodeUpload(file multipart.File, name string) ([]float32, error) {
+	samples, rate, err := wav.Read(file)
+	if err == nil {
+		return wav.Resample(samples, rate, audiofile.SampleRate), nil
+	} else if !errors.Is(err, wav.ErrNotWAV) {
+		return nil, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp("", "whisper-tray-upload-*"+filepath.Ext(name))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, file)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	samples, err = audiofile.Load(tmp.Name())
+	if err != nil && !errors.Is(err, audiofile.ErrNoFFmpeg) {
+		// The error names the temporary file, so the client only gets the gist
+		s.log.Warn().Err(err).Str("file", name).Msg("Failed to decode upload")
+		return nil, fmt.Errorf("failed to decode %s as audio", name)
+	}
+	return samples, err
+}
+
+// transcribe decodes samples with whatever model the transcriber has loaded
+// and drops hallucinated segments
+func (s *Server) transcribe(samples []float32, opts whisper.SessionOpts) ([]whisper.Segment, error) {
+	session, err := s.transcriber.StartSession(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan []whisper.Segment, 1)
+	go func() {
+		var segments []whisper.Segment
+		for seg := range session.Finals() {
+			segments = append(segments, seg)
+		}
+		done <- s.opts.Filter.Segments(segments)
+	}()
+
+	feedErr := session.Feed(samples)
+	err = session.Close()
+	segments := <-done
+	if feedErr != nil {
+		return nil, feedErr
+	}
+	return segments, err
+}
+
+// writeError replies in the OpenAI API's error shape
+func writeError(w http.ResponseWriter, status int, kind, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]string{"message": message, "type": kind},
+	})
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/filter"
+	"github.com/petems/whisper-tray/internal/wav"
+	"github.com/petems/whisper-tray/internal/whisper"
+)
+
+// fakeTranscriber returns canned segments from every session and records
+// what it was asked to decode
+type fakeTranscriber struct {
+	segments []whisper.Segment
+	// block, if set, holds every session's Close until it is closed
+	block chan struct{}
+
+	mu      sync.Mutex
+	opts    []whisper.SessionOpts
+	samples []int
+}
+
+func (f *fakeTranscriber) StartSession(opts whisper.SessionOpts) (whisper.Session, error) {
+	f.mu.Lock()
+	f.opts = append(f.opts, opts)
+	f.mu.Unlock()
+	return &fakeSession{t: f, finals: make(chan whisper.Segment, len(f.segments))}, nil
+}
+
+func (f *fakeTranscriber) LoadModel(string, whisper.ProgressFunc) error        { return nil }
+func (f *fakeTranscriber) LoadPartialModel(string, whisper.ProgressFunc) error { return nil }
+func (f *fakeTranscriber) LoadWakeModel(string, whisper.ProgressFunc) error    { return nil }
+func (f *fakeTranscriber) Close() error                                        { return nil }
+
+func (f *fakeTranscriber) Transcribe(string, []float32, whisper.SessionOpts, whisper.ProgressFunc) ([]whisper.Segment, error) {
+	return f.segments, nil
+}
+
+type fakeSession struct {
+	t      *fakeTranscriber
+	n      int
+	finals chan whisper.Segment
+}
+
+func (s *fakeSession) Feed(samples []float32) error {
+	s.n += len(samples)
+	return nil
+}
+
+func (s *fakeSession) Partials() <-chan string        { return nil }
+func (s *fakeSession) Finals() <-chan whisper.Segment { return s.finals }
+
+func (s *fakeSession) Close() error {
+	if s.t.block != nil {
+		<-s.t.block
+	}
+	s.t.mu.Lock()
+	s.t.samples = append(s.t.samples, s.n)
+	s.t.mu.Unlock()
+	for _, seg := range s.t.segments {
+		s.finals <- seg
+	}
+	close(s.finals)
+	return nil
+}
+
+// upload builds a transcription request for a second of silence at rate
+func upload(t *testing.T, rate int, fields map[string]string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", "audio.wav")
+	if err := wav.Write(file, make([]float32, rate), rate); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range fields {
+		form.WriteField(k, v)
+	}
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/audio/transcriptions", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+// uploadMP3 builds a transcription request for an mp3 file
+func uploadMP3() *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", "audio.mp3")
+	file.Write([]byte("ID3\x04 mp3 data"))
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/v1/audio/transcriptions", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func newTestServer(t *fakeTranscriber, opts Options) http.Handler {
+	opts.Logger = zerolog.Nop()
+	return New(t, opts).Handler()
+}
+
+func TestTranscriptionJSON(t *testing.T) {
+	ft := &fakeTranscriber{segments: []whisper.Segment{
+		{Text: " Hello.", End: time.Second},
+		{Text: " Thanks for watching!", Start: time.Second, End: 2 * time.Second},
+	}}
+	h := newTestServer(ft, Options{
+		Defaults: whisper.SessionOpts{Language: "en", Threads: 4},
+		Filter:   filter.New(config.FilterConfig{Blocklist: []string{"Thanks for watching!"}}),
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, upload(t, 44100, map[string]string{"model": "whisper-1", "language": "fr"}))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var out struct{ Text string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || out.Text != "Hello." {
+		t.Fatalf("expected filtered text %q, got %q (%v)", "Hello.", rec.Body, err)
+	}
+	if got := ft.opts[0]; got.Language != "fr" || got.Threads != 4 {
+		t.Fatalf("expected request language over defaults, got %+v", got)
+	}
+	if ft.samples[0] != 16000 {
+		t.Fatalf("expected 44.1kHz upload resampled to 16000 samples, got %d", ft.samples[0])
+	}
+}
+
+func TestTranscriptionSRT(t *testing.T) {
+	ft := &fakeTranscriber{segments: []whisper.Segment{{Text: " Hello.", End: 1500 * time.Millisecond}}}
+	h := newTestServer(ft, Options{})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, upload(t, 16000, map[string]string{"response_format": "srt"}))
+
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("expected 200 text/plain, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if want := "1\n00:00:00,000 --> 00:00:01,500\nHello.\n\n"; rec.Body.String() != want {
+		t.Fatalf("expected %q, got %q", want, rec.Body)
+	}
+}
+
+func TestTranscriptionRequiresToken(t *testing.T) {
+	ft := &fakeTranscriber{}
+	h := newTestServer(ft, Options{Token: "secret"})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, upload(t, 16000, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rec.Code)
+	}
+
+	req := upload(t, 16000, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with the token, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestTranscriptionRejectsBadInput(t *testing.T) {
+	h := newTestServer(&fakeTranscriber{}, Options{})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, upload(t, 16000, map[string]string{"response_format": "docx"}))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "response_format") {
+		t.Fatalf("expected 400 for an unknown format, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Without ffmpeg only WAV can be decoded
+	t.Setenv("PATH", t.TempDir())
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, uploadMP3())
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "WAV") {
+		t.Fatalf("expected 400 for non-WAV audio, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/audio/transcriptions", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET, got %d", rec.Code)
+	}
+}
+
+func TestTranscriptionConvertsWithFFmpeg(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg is a shell script")
+	}
+	// A fake ffmpeg that checks it was handed an mp3 and outputs half a second
+	dir := t.TempDir()
+	out, err := os.Create(filepath.Join(dir, "out.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wav.Write(out, make([]float32, 8000), 16000)
+	out.Close()
+	script := "#!/bin/sh\ncase \"$*\" in *.mp3*) cat \"$(dirname \"$0\")/out.wav\" ;; *) exit 1 ;; esac\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ft := &fakeTranscriber{segments: []whisper.Segment{{Text: " Hello."}}}
+	rec := httptest.NewRecorder()
+	newTestServer(ft, Options{}).ServeHTTP(rec, uploadMP3())
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if ft.samples[0] != 8000 {
+		t.Fatalf("expected ffmpeg's 8000 samples transcribed, got %d", ft.samples[0])
+	}
+}
+
+func TestTranscriptionConcurrencyLimit(t *testing.T) {
+	ft := &fakeTranscriber{block: make(chan struct{})}
+	srv := httptest.NewServer(newTestServer(ft, Options{MaxConcurrent: 1}))
+	defer srv.Close()
+
+	first := make(chan int, 1)
+	go func() {
+		req := upload(t, 16000, nil)
+		resp, err := http.Post(srv.URL+req.URL.Path, req.Header.Get("Content-Type"), req.Body)
+		if err != nil {
+			first <- 0
+			return
+		}
+		resp.Body.Close()
+		first <- resp.StatusCode
+	}()
+
+	// Wait for the first request to hold the only slot
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		ft.mu.Lock()
+		started := len(ft.opts)
+		ft.mu.Unlock()
+		if started == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the first request")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	req := upload(t, 16000, nil)
+	resp, err := http.Post(srv.URL+req.URL.Path, req.Header.Get("Content-Type"), req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while the slot is taken, got %d", resp.StatusCode)
+	}
+
+	close(ft.block)
+	if code := <-first; code != http.StatusOK {
+		t.Fatalf("expected the first request to succeed, got %d", code)
+	}
+}
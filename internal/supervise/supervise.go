@@ -0,0 +1,76 @@
+// Package supervise keeps a panic in one goroutine from taking the whole app
+// down. Much of the work happens next to cgo (capture, decoding, hotkeys),
+// where a bad buffer or a nil handle would otherwise kill the process
+// without a word in the log.
+package supervise
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Restarts wait minRestartDelay, doubling each time a loop panics again
+// soon after, up to maxRestartDelay
+var (
+	minRestartDelay = 100 * time.Millisecond
+	maxRestartDelay = 30 * time.Second
+)
+
+// stableRun is how long a loop must run before its restart delay resets
+const stableRun = time.Minute
+
+// Panic is a recovered panic and where it happened
+type Panic struct {
+	Name  string // the goroutine that panicked
+	Value any
+	Stack []byte
+}
+
+func (p *Panic) Error() string {
+	return fmt.Sprintf("%s crashed: %v", p.Name, p.Value)
+}
+
+// Run calls fn, recovering if it panics. The panic is logged with its stack
+// and passed to onPanic, if set. Run reports whether fn returned normally.
+func Run(log zerolog.Logger, name string, fn func(), onPanic func(*Panic)) (ok bool) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		p := &Panic{Name: name, Value: v, Stack: debug.Stack()}
+		log.Error().
+			Str("goroutine", name).
+			Interface("panic", v).
+			Str("stack", string(p.Stack)).
+			Msg("Recovered from panic")
+		if onPanic != nil {
+			onPanic(p)
+		}
+	}()
+
+	fn()
+	return true
+}
+
+// Loop calls fn until it returns normally, starting it again after each
+// panic. A loop that keeps panicking is restarted less and less often.
+func Loop(log zerolog.Logger, name string, fn func(), onPanic func(*Panic)) {
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		if Run(log, name, fn, onPanic) {
+			return
+		}
+		if time.Since(started) >= stableRun {
+			delay = minRestartDelay
+		}
+
+		log.Warn().Str("goroutine", name).Dur("delay", delay).Msg("Restarting after panic")
+		time.Sleep(delay)
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
@@ -0,0 +1,61 @@
+package supervise
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRunRecovers(t *testing.T) {
+	var got *Panic
+	ok := Run(zerolog.New(io.Discard), "feed", func() {
+		var samples []float32
+		_ = samples[3]
+	}, func(p *Panic) { got = p })
+
+	if ok {
+		t.Fatal("expected Run to report the panic")
+	}
+	if got == nil || got.Name != "feed" || len(got.Stack) == 0 {
+		t.Fatalf("expected the panic passed on with its stack, got %+v", got)
+	}
+	if msg := got.Error(); !strings.HasPrefix(msg, "feed crashed: runtime error: index out of range") {
+		t.Fatalf("unexpected error text %q", msg)
+	}
+}
+
+func TestRunReturnsNormally(t *testing.T) {
+	ran := false
+	if !Run(zerolog.New(io.Discard), "collector", func() { ran = true }, nil) || !ran {
+		t.Fatal("expected fn to run and Run to report success")
+	}
+}
+
+func TestLoopRestartsAfterPanic(t *testing.T) {
+	defer func(d time.Duration) { minRestartDelay = d }(minRestartDelay)
+	minRestartDelay = time.Millisecond
+
+	runs, panics := 0, 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Loop(zerolog.New(io.Discard), "event loop", func() {
+			runs++
+			if runs < 3 {
+				panic("bad event")
+			}
+		}, func(*Panic) { panics++ })
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the loop to return")
+	}
+	if runs != 3 || panics != 2 {
+		t.Fatalf("expected 3 runs and 2 panics, got %d and %d", runs, panics)
+	}
+}
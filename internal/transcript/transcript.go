@@ -0,0 +1,132 @@
+// Package transcript renders whisper segments in the response formats of
+// OpenAI's transcription API: json, text, srt, vtt and verbose_json.
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/petems/whisper-tray/internal/whisper"
+)
+
+// Formats lists the supported format names
+var Formats = []string{"json", "text", "srt", "vtt", "verbose_json"}
+
+// Valid reports whether format is one of Formats
+func Valid(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentType returns the MIME type a format is served as
+func ContentType(format string) string {
+	switch format {
+	case "text", "srt":
+		return "text/plain; charset=utf-8"
+	case "vtt":
+		return "text/vtt; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// Text joins segment texts into a single line
+func Text(segments []whisper.Segment) string {
+	parts := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		if t := strings.TrimSpace(seg.Text); t != "" {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Write renders segments in the named format. duration is the length of the
+// audio, reported by verbose_json.
+func Write(w io.Writer, format string, segments []whisper.Segment, duration time.Duration) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(struct {
+			Text string `json:"text"`
+		}{Text(segments)})
+	case "text":
+		_, err := fmt.Fprintln(w, Text(segments))
+		return err
+	case "srt":
+		return writeCues(w, segments, "", ',', true)
+	case "vtt":
+		return writeCues(w, segments, "WEBVTT\n\n", '.', false)
+	case "verbose_json":
+		return writeVerbose(w, segments, duration)
+	default:
+		return fmt.Errorf("unknown format %q (want one of %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+// writeCues writes SRT or WebVTT, which differ only in header, millisecond
+// separator and SRT's cue numbers
+func writeCues(w io.Writer, segments []whisper.Segment, header string, sep byte, numbered bool) error {
+	var b strings.Builder
+	b.WriteString(header)
+	n := 0
+	for _, seg := range segments {
+		text := strings.TrimSpace(seg.Text)
+		if text == "" {
+			continue
+		}
+		n++
+		if numbered {
+			fmt.Fprintf(&b, "%d\n", n)
+		}
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n", timestamp(seg.Start, sep), timestamp(seg.End, sep), text)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// timestamp formats d as HH:MM:SS followed by sep and milliseconds
+func timestamp(d time.Duration, sep byte) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+type verboseSegment struct {
+	ID           int     `json:"id"`
+	Start        float64 `json:"start"`
+	End          float64 `json:"end"`
+	Text         string  `json:"text"`
+	AvgLogProb   float64 `json:"avg_logprob"`
+	NoSpeechProb float64 `json:"no_speech_prob"`
+}
+
+func writeVerbose(w io.Writer, segments []whisper.Segment, duration time.Duration) error {
+	out := struct {
+		Task     string           `json:"task"`
+		Duration float64          `json:"duration"`
+		Text     string           `json:"text"`
+		Segments []verboseSegment `json:"segments"`
+	}{
+		Task:     "transcribe",
+		Duration: duration.Seconds(),
+		Text:     Text(segments),
+		Segments: make([]verboseSegment, 0, len(segments)),
+	}
+	for i, seg := range segments {
+		out.Segments = append(out.Segments, verboseSegment{
+			ID:           i,
+			Start:        seg.Start.Seconds(),
+			End:          seg.End.Seconds(),
+			Text:         seg.Text,
+			AvgLogProb:   seg.AvgLogProb,
+			NoSpeechProb: seg.NoSpeechProb,
+		})
+	}
+	return json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,78 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/petems/whisper-tray/internal/whisper"
+)
+
+var testSegments = []whisper.Segment{
+	{Text: " Hello there.", Start: 0, End: 1500 * time.Millisecond, AvgLogProb: -0.2},
+	{Text: " ", Start: 1500 * time.Millisecond, End: 2 * time.Second},
+	{Text: " General Kenobi.", Start: 2 * time.Second, End: 3723*time.Second + 45*time.Millisecond},
+}
+
+func render(t *testing.T, format string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Write(&buf, format, testSegments, 4*time.Second); err != nil {
+		t.Fatalf("Write(%s) returned error: %v", format, err)
+	}
+	return buf.String()
+}
+
+func TestWriteTextFormats(t *testing.T) {
+	if got, want := render(t, "text"), "Hello there. General Kenobi.\n"; got != want {
+		t.Fatalf("text: expected %q, got %q", want, got)
+	}
+	if got, want := render(t, "json"), `{"text":"Hello there. General Kenobi."}`+"\n"; got != want {
+		t.Fatalf("json: expected %q, got %q", want, got)
+	}
+}
+
+func TestWriteSubtitles(t *testing.T) {
+	srt := "1\n00:00:00,000 --> 00:00:01,500\nHello there.\n\n" +
+		"2\n00:00:02,000 --> 01:02:03,045\nGeneral Kenobi.\n\n"
+	if got := render(t, "srt"); got != srt {
+		t.Fatalf("srt: expected\n%s\ngot\n%s", srt, got)
+	}
+
+	vtt := "WEBVTT\n\n00:00:00.000 --> 00:00:01.500\nHello there.\n\n" +
+		"00:00:02.000 --> 01:02:03.045\nGeneral Kenobi.\n\n"
+	if got := render(t, "vtt"); got != vtt {
+		t.Fatalf("vtt: expected\n%s\ngot\n%s", vtt, got)
+	}
+}
+
+func TestWriteVerboseJSON(t *testing.T) {
+	var out struct {
+		Duration float64 `json:"duration"`
+		Text     string  `json:"text"`
+		Segments []struct {
+			ID         int     `json:"id"`
+			End        float64 `json:"end"`
+			AvgLogProb float64 `json:"avg_logprob"`
+		} `json:"segments"`
+	}
+	if err := json.Unmarshal([]byte(render(t, "verbose_json")), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Duration != 4 || out.Text != "Hello there. General Kenobi." || len(out.Segments) != 3 {
+		t.Fatalf("unexpected verbose_json %+v", out)
+	}
+	if out.Segments[0].End != 1.5 || out.Segments[0].AvgLogProb != -0.2 || out.Segments[2].ID != 2 {
+		t.Fatalf("unexpected segment fields %+v", out.Segments)
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	if Valid("docx") {
+		t.Fatal("expected docx to be invalid")
+	}
+	if err := Write(&bytes.Buffer{}, "docx", testSegments, 0); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
@@ -3,12 +3,14 @@ package tray
 import (
 	"context"
 	"fmt"
-	"os"
 	"path/filepath"
 
 	"github.com/petems/whisper-tray/internal/app"
 	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/events"
 	"github.com/petems/whisper-tray/internal/logging"
+	"github.com/petems/whisper-tray/internal/supervise"
+	"github.com/petems/whisper-tray/internal/whisper"
 	"github.com/getlantern/systray"
 	"github.com/rs/zerolog"
 )
@@ -22,29 +24,126 @@ type UI struct {
 
 	// Menu items
 	mStartStop   *systray.MenuItem
+	mRedo        *systray.MenuItem
+	mCancel      *systray.MenuItem
+	mListen      *systray.MenuItem
+	mWake        *systray.MenuItem
+	mAppend      *systray.MenuItem
+	mCommit      *systray.MenuItem
 	mMode        *systray.MenuItem
 	mDevices     *systray.MenuItem
 	mModels      *systray.MenuItem
 	mPastePrefer *systray.MenuItem
 	mRunAtLogin  *systray.MenuItem
 	mDebugLog    *systray.MenuItem
+
+	// status is the last status shown; draft is the append-mode text
+	// waiting to be committed. Once the menu is up only watchApp uses them.
+	status string
+	draft  string
+}
+
+// watchApp shows what the app reports until the subscription is closed
+func (u *UI) watchApp(sub *events.Subscription) {
+	var dropped uint64
+	for ev := range sub.Events() {
+		u.showEvent(ev)
+
+		// A missed StateChanged would leave the icon stuck, so once the
+		// queue has drained after a drop, catch up from the app itself
+		if n := sub.Dropped(); n != dropped && len(sub.Events()) == 0 {
+			dropped = n
+			u.log.Warn().Uint64("dropped", n).Msg("Tray fell behind on app events")
+			u.showStatus(u.app.Status())
+			u.showDraft(u.app.Draft())
+		}
+	}
 }
 
-// Status update methods for the app to call
-func (u *UI) SetIdle() {
-	u.updateStatus("idle")
+// showEvent updates the tray for one event from the app
+func (u *UI) showEvent(ev events.Event) {
+	switch ev := ev.(type) {
+	case events.StateChanged:
+		u.showStatus(ev.Status)
+	case events.DictationStopped:
+		if ev.Reason != "" {
+			systray.SetTooltip(fmt.Sprintf("Stopped automatically (%s)", ev.Reason))
+		}
+	case events.DraftChanged:
+		u.showDraft(ev.Text)
+	case events.ModelLoading:
+		u.showLoading(ev.Model, ev.Downloaded, ev.Total)
+	case events.InjectionFailed:
+		systray.SetTooltip(fmt.Sprintf("Couldn't insert text: %v", ev.Err))
+	case events.Error:
+		u.updateStatus("error")
+		systray.SetTooltip(fmt.Sprintf("Error (%s): %v", ev.Cause, ev.Err))
+	}
 }
 
-func (u *UI) SetRecording() {
-	u.updateStatus("recording")
+func (u *UI) showStatus(status events.Status) {
+	u.updateStatus(status.String())
+	u.setCancelable(status == events.StatusRecording || status == events.StatusProcessing)
+	u.setListening(status == events.StatusListening)
+	if status == events.StatusListening {
+		systray.SetTooltip("Listening hands-free")
+	}
 }
 
-func (u *UI) SetProcessing() {
-	u.updateStatus("processing")
+func (u *UI) showDraft(text string) {
+	u.draft = text
+	if u.mCommit != nil {
+		if text != "" {
+			u.mCommit.Enable()
+		} else {
+			u.mCommit.Disable()
+		}
+	}
+	u.updateStatus(u.status)
+}
+
+// setListening checks "Hands-Free Listening" while it's on
+func (u *UI) setListening(on bool) {
+	if u.mListen == nil {
+		return
+	}
+	if on {
+		u.mListen.Check()
+	} else {
+		u.mListen.Uncheck()
+	}
+}
+
+// setCancelable enables "Cancel Dictation" while there is something to cancel
+func (u *UI) setCancelable(on bool) {
+	if u.mCancel == nil {
+		return
+	}
+	if on {
+		u.mCancel.Enable()
+	} else {
+		u.mCancel.Disable()
+	}
 }
 
-func (u *UI) SetError() {
-	u.updateStatus("error")
+// showLoading shows model loading progress unless a dictation on the
+// previous model owns the indicator
+func (u *UI) showLoading(model string, downloaded, total int64) {
+	if u.status == "recording" || u.status == "processing" {
+		return
+	}
+	switch {
+	case total > 0:
+		percent := downloaded * 100 / total
+		systray.SetTitle(fmt.Sprintf("🎤 %s %d%%", emojiForStatus("loading"), percent))
+		systray.SetTooltip(fmt.Sprintf("Downloading %s: %d%%", model, percent))
+	case downloaded > 0:
+		systray.SetTitle(fmt.Sprintf("🎤 %s %dMB", emojiForStatus("loading"), downloaded>>20))
+		systray.SetTooltip(fmt.Sprintf("Downloading %s: %d MB", model, downloaded>>20))
+	default:
+		u.updateStatus("loading")
+		systray.SetTooltip(fmt.Sprintf("Loading %s…", model))
+	}
 }
 
 func New(application *app.App, cfg *config.Config, version, commit string) *UI {
@@ -58,26 +157,29 @@ func New(application *app.App, cfg *config.Config, version, commit string) *UI {
 	}
 }
 
-// SetApp sets the app reference (for circular dependency resolution)
-func (u *UI) SetApp(application *app.App) {
-	u.app = application
-}
-
 func (u *UI) Run(ctx context.Context) error {
 	systray.Run(u.onReady, u.onExit)
 	return nil
 }
 
 func (u *UI) onReady() {
-	// Use emoji instead of icon - microphone with initial status
-	u.updateStatus("idle")
-	systray.SetTooltip("Local voice dictation")
+	// Use emoji instead of icon - microphone with initial status. The app
+	// reports loading progress until the model is ready.
+	u.updateStatus("loading")
+	systray.SetTooltip(fmt.Sprintf("Loading %s…", u.cfg.Whisper.Model))
 
 	// Build menu
 	u.mStartStop = systray.AddMenuItem("Start Dictation", "Press hotkey to dictate")
+	u.mRedo = systray.AddMenuItem("Redo Last Dictation", fmt.Sprintf("Re-transcribe the last dictation with %s", u.cfg.Redo.Model))
+	u.mCancel = systray.AddMenuItem("Cancel Dictation", "Stop recording and discard the transcript")
+	u.mCancel.Disable()
+	u.mListen = systray.AddMenuItemCheckbox("Hands-Free Listening", "Transcribe each pause without the hotkey", false)
+	u.mCommit = systray.AddMenuItem("Commit Draft", "Inject the text collected in append mode")
+	u.mCommit.Disable()
+	u.mWake = systray.AddMenuItemCheckbox(fmt.Sprintf("Wake Word (%q)", u.cfg.Wake.Phrase), "Start dictating by saying the wake phrase", u.cfg.Wake.Enabled)
 	systray.AddSeparator()
 
-	u.mMode = systray.AddMenuItem("Mode: Push-to-Talk", "Toggle between modes")
+	u.mMode = systray.AddMenuItem(modeTitle(u.cfg.Mode), "Cycle through Push-to-Talk, Toggle and Hybrid")
 	systray.AddSeparator()
 
 	u.mDevices = systray.AddMenuItem("Microphone", "Select audio device")
@@ -87,6 +189,7 @@ func (u *UI) onReady() {
 	u.buildModelMenu()
 
 	systray.AddSeparator()
+	u.mAppend = systray.AddMenuItemCheckbox("Append Mode", "Collect dictations into a draft and inject them together", u.cfg.Append.Enabled)
 	u.mPastePrefer = systray.AddMenuItemCheckbox("Prefer Paste", "Use clipboard paste", u.cfg.Inject.PreferPaste)
 	u.mRunAtLogin = systray.AddMenuItemCheckbox("Run at Login", "Start on system boot", u.cfg.RunAtLogin)
 	u.mDebugLog = systray.AddMenuItemCheckbox("Debug Logging", "Enable detailed debug logs", u.cfg.LogLevel == "debug")
@@ -97,12 +200,33 @@ func (u *UI) onReady() {
 	mQuit := systray.AddMenuItem("Quit", "Exit application")
 
 	// Event loop
-	go u.handleEvents(mLogs, mAbout, mQuit)
+	u.loop("menu", func() { u.handleEvents(mLogs, mAbout, mQuit) })
+	sub := u.app.Subscribe(events.DefaultBuffer, func(ev events.Event) bool {
+		// Levels arrive with every chunk of audio and the tray doesn't show them
+		_, level := ev.(events.AudioLevel)
+		return !level
+	})
+	u.loop("status", func() { u.watchApp(sub) })
+
+	// Load the model only once the tray is up to show its progress
+	u.app.Start()
 }
 
 func (u *UI) handleEvents(mLogs, mAbout, mQuit *systray.MenuItem) {
 	for {
 		select {
+		case <-u.mRedo.ClickedCh:
+			u.spawn("redo", u.redo)
+		case <-u.mCancel.ClickedCh:
+			u.spawn("cancel", func() { u.app.Cancel() })
+		case <-u.mListen.ClickedCh:
+			u.spawn("listen", func() { u.app.OnListenHotkey(true) })
+		case <-u.mWake.ClickedCh:
+			u.toggleWakeWord()
+		case <-u.mCommit.ClickedCh:
+			u.spawn("commit", u.commitDraft)
+		case <-u.mAppend.ClickedCh:
+			u.toggleAppendMode()
 		case <-u.mMode.ClickedCh:
 			u.toggleMode()
 		case <-u.mPastePrefer.ClickedCh:
@@ -122,6 +246,17 @@ func (u *UI) handleEvents(mLogs, mAbout, mQuit *systray.MenuItem) {
 	}
 }
 
+// loop runs a long-lived menu goroutine, starting it again if it panics
+func (u *UI) loop(name string, fn func()) {
+	go supervise.Loop(u.log, name, fn, u.app.ReportPanic)
+}
+
+// spawn runs a menu action off the menu loop so a slow one doesn't hold up
+// the menu, and a panic in it doesn't take the app down
+func (u *UI) spawn(name string, fn func()) {
+	go supervise.Run(u.log, name, fn, u.app.ReportPanic)
+}
+
 func (u *UI) buildDeviceMenu() {
 	// Get devices from app
 	devices, err := u.app.ListDevices()
@@ -139,7 +274,8 @@ func (u *UI) buildDeviceMenu() {
 		}
 		deviceItems[dev.ID] = item
 
-		go func(deviceID, deviceName string, menuItem *systray.MenuItem) {
+		deviceID, deviceName, menuItem := dev.ID, dev.Name, item
+		u.loop("device menu", func() {
 			for {
 				<-menuItem.ClickedCh
 				// Uncheck all other items
@@ -155,18 +291,38 @@ func (u *UI) buildDeviceMenu() {
 				u.log.Info().Str("device", deviceName).Msg("Changed audio device")
 				u.app.SetDevice(deviceID)
 			}
-		}(dev.ID, dev.Name, item)
+		})
 	}
 }
 
 func (u *UI) buildModelMenu() {
-	models := []string{"base.en", "small.en", "medium.en", "large-v3", "large-v3-turbo"}
+	registry, err := whisper.LoadRegistry(u.cfg.Whisper)
+	if err != nil {
+		u.log.Error().Err(err).Msg("Failed to load model registry")
+		return
+	}
 	modelItems := make(map[string]*systray.MenuItem)
 
-	for _, model := range models {
+	// Models imported with "models import" and a current model given as a
+	// path to a .bin file are choices too
+	models := append(registry.Models(), registry.Imported()...)
+	if !listsModel(models, u.cfg.Whisper.Model) {
+		if info, ok := registry.Lookup(u.cfg.Whisper.Model); ok {
+			models = append(models, info)
+		}
+	}
+
+	for _, info := range models {
+		model := info.Name
+
 		// Check if model is downloaded
 		modelTitle := model
-		if u.isModelDownloaded(model) {
+		switch {
+		case info.IsLocal() && filepath.Dir(info.Path) == filepath.Clean(config.ModelsPath()):
+			modelTitle += " (imported)"
+		case info.IsLocal():
+			modelTitle += " (local)"
+		case registry.IsDownloaded(info):
 			modelTitle += " (downloaded)"
 		}
 
@@ -174,9 +330,14 @@ func (u *UI) buildModelMenu() {
 		if model == u.cfg.Whisper.Model {
 			item.Check()
 		}
+		// Offline mode can't fetch anything, so only offer models on disk
+		if u.cfg.Whisper.Offline && !registry.IsDownloaded(info) {
+			item.Disable()
+		}
 		modelItems[model] = item
 
-		go func(m string, menuItem *systray.MenuItem) {
+		m, menuItem := model, item
+		u.loop("model menu", func() {
 			for {
 				<-menuItem.ClickedCh
 				// Uncheck all other items
@@ -187,31 +348,83 @@ func (u *UI) buildModelMenu() {
 				}
 				// Check this item
 				menuItem.Check()
-				oldModel := u.cfg.Whisper.Model
-				u.cfg.Whisper.Model = m
-				u.cfg.Save()
-				u.log.Info().Str("from", oldModel).Str("to", m).Msg("Changed Whisper model")
-				u.app.SetModel(m)
+				u.log.Info().Str("from", u.cfg.Whisper.Model).Str("to", m).Msg("Changed Whisper model")
+				// App persists the choice and swaps the model in the background
+				if err := u.app.SetModel(m); err != nil {
+					u.log.Error().Err(err).Msg("Failed to save model selection")
+				}
 			}
-		}(model, item)
+		})
+	}
+}
+
+func listsModel(models []whisper.ModelInfo, name string) bool {
+	for _, m := range models {
+		if m.Name == name {
+			return true
+		}
 	}
+	return false
+}
+
+// nextMode is the mode after each in the Mode menu's cycle
+var nextMode = map[string]string{
+	"PushToTalk": "Toggle",
+	"Toggle":     "Hybrid",
+	"Hybrid":     "PushToTalk",
+}
+
+func modeTitle(mode string) string {
+	switch mode {
+	case "Toggle":
+		return "Mode: Toggle"
+	case "Hybrid":
+		return "Mode: Hybrid (tap or hold)"
+	}
+	return "Mode: Push-to-Talk"
 }
 
 func (u *UI) toggleMode() {
 	oldMode := u.cfg.Mode
-	if u.cfg.Mode == "PushToTalk" {
-		u.cfg.Mode = "Toggle"
-		u.mMode.SetTitle("Mode: Toggle")
-		u.app.SetMode("Toggle")
-	} else {
-		u.cfg.Mode = "PushToTalk"
-		u.mMode.SetTitle("Mode: Push-to-Talk")
-		u.app.SetMode("PushToTalk")
+	mode, ok := nextMode[oldMode]
+	if !ok {
+		mode = "PushToTalk"
 	}
+	u.cfg.Mode = mode
+	u.mMode.SetTitle(modeTitle(mode))
+	u.app.SetMode(mode)
 	u.cfg.Save()
 	u.log.Info().Str("from", oldMode).Str("to", u.cfg.Mode).Msg("Changed mode")
 }
 
+func (u *UI) toggleWakeWord() {
+	on := !u.mWake.Checked()
+	if on {
+		u.mWake.Check()
+	} else {
+		u.mWake.Uncheck()
+	}
+	u.app.SetWakeWord(on)
+	u.log.Info().Bool("enabled", on).Str("phrase", u.cfg.Wake.Phrase).Msg("Changed wake word")
+}
+
+func (u *UI) toggleAppendMode() {
+	on := !u.mAppend.Checked()
+	if on {
+		u.mAppend.Check()
+	} else {
+		u.mAppend.Uncheck()
+	}
+	u.app.SetAppendMode(on)
+	u.log.Info().Bool("enabled", on).Msg("Changed append mode")
+}
+
+func (u *UI) commitDraft() {
+	if _, err := u.app.Commit(); err != nil {
+		u.log.Warn().Err(err).Msg("Commit failed")
+	}
+}
+
 func (u *UI) togglePastePrefer() {
 	u.cfg.Inject.PreferPaste = !u.cfg.Inject.PreferPaste
 	if u.cfg.Inject.PreferPaste {
@@ -255,6 +468,12 @@ func (u *UI) openLogs() {
 	fmt.Println("Open logs...")
 }
 
+func (u *UI) redo() {
+	if _, err := u.app.Redo(""); err != nil {
+		u.log.Warn().Err(err).Msg("Redo failed")
+	}
+}
+
 func (u *UI) showAbout() {
 	// TODO: Show about dialog with native UI
 	fmt.Printf("WhisperTray %s (%s)\nLocal voice dictation\n", u.version, u.commit)
@@ -264,17 +483,32 @@ func (u *UI) onExit() {
 	// Cleanup
 }
 
-// isModelDownloaded checks if a Whisper model file exists
-func (u *UI) isModelDownloaded(model string) bool {
-	modelPath := filepath.Join(config.ModelsPath(), model+".bin")
-	_, err := os.Stat(modelPath)
-	return err == nil
-}
-
 // updateStatus sets the tray title with microphone emoji and status indicator
 func (u *UI) updateStatus(status string) {
+	u.status = status
 	emoji := emojiForStatus(status)
-	systray.SetTitle(fmt.Sprintf("🎤 %s", emoji))
+	if u.draft == "" {
+		systray.SetTitle(fmt.Sprintf("🎤 %s", emoji))
+	} else {
+		systray.SetTitle(fmt.Sprintf("🎤 %s 📝", emoji))
+	}
+
+	switch {
+	case status == "loading":
+	case u.draft != "":
+		systray.SetTooltip("Draft: " + truncate(u.draft, 80))
+	default:
+		systray.SetTooltip("Local voice dictation")
+	}
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
 }
 
 // emojiForStatus returns the appropriate status emoji
@@ -286,6 +520,10 @@ func emojiForStatus(status string) string {
 		return "🟡" // Yellow - processing transcription
 	case "idle":
 		return "🟢" // Green - ready/idle
+	case "loading":
+		return "⏳" // Hourglass - model downloading or loading
+	case "listening":
+		return "👂" // Ear - hands-free listening
 	case "error":
 		return "⚪️" // White - error
 	default:
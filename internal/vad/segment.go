@@ -0,0 +1,118 @@
+package vad
+
+import "time"
+
+// SegmenterOptions tunes how a Segmenter splits audio into utterances
+type SegmenterOptions struct {
+	Threshold float64       // RMS level of speech; 0 uses DefaultThreshold
+	Pause     time.Duration // silence that ends an utterance
+	PreRoll   time.Duration // audio kept from before speech starts so the first syllable isn't clipped
+	MinSpeech time.Duration // utterances with less speech than this are dropped
+	Max       time.Duration // utterances are cut at this length; 0 for no limit
+}
+
+// Segmenter splits a continuous stream of audio into utterances separated
+// by pauses. It's not safe for concurrent use.
+type Segmenter struct {
+	threshold float64
+	frameLen  int
+	frame     []float32 // partial frame carried between Feed calls
+
+	// Limits in samples
+	pause, preRoll, minSpeech, max int
+
+	preroll   []float32 // latest silence while waiting for speech
+	utterance []float32 // nil while waiting for speech
+	voiced    int       // samples of speech in the utterance
+	silent    int       // samples in its current run of silence
+}
+
+// NewSegmenter returns a segmenter for audio at rate Hz
+func NewSegmenter(rate int, opts SegmenterOptions) *Segmenter {
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultThreshold
+	}
+	samples := func(d time.Duration) int {
+		return int(int64(rate) * int64(d) / int64(time.Second))
+	}
+	frameLen := samples(frameDuration)
+	return &Segmenter{
+		threshold: opts.Threshold,
+		frameLen:  frameLen,
+		frame:     make([]float32, 0, frameLen),
+		pause:     samples(opts.Pause),
+		preRoll:   samples(opts.PreRoll),
+		minSpeech: samples(opts.MinSpeech),
+		max:       samples(opts.Max),
+	}
+}
+
+// Feed adds samples and returns any utterances they completed
+func (s *Segmenter) Feed(samples []float32) [][]float32 {
+	var out [][]float32
+	for len(samples) > 0 {
+		n := min(s.frameLen-len(s.frame), len(samples))
+		s.frame = append(s.frame, samples[:n]...)
+		samples = samples[n:]
+		if len(s.frame) < s.frameLen {
+			break
+		}
+		if u := s.addFrame(s.frame); u != nil {
+			out = append(out, u)
+		}
+		s.frame = s.frame[:0]
+	}
+	return out
+}
+
+// Flush ends the utterance in progress, returning it unless it held too
+// little speech
+func (s *Segmenter) Flush() []float32 {
+	if s.utterance != nil {
+		s.utterance = append(s.utterance, s.frame...)
+	}
+	s.frame = s.frame[:0]
+	return s.end()
+}
+
+// InUtterance reports whether speech has started and not yet paused
+func (s *Segmenter) InUtterance() bool { return s.utterance != nil }
+
+func (s *Segmenter) addFrame(frame []float32) []float32 {
+	speech := RMS(frame) >= s.threshold
+
+	if s.utterance == nil {
+		if !speech {
+			s.preroll = append(s.preroll, frame...)
+			if excess := len(s.preroll) - s.preRoll; excess > 0 {
+				s.preroll = append(s.preroll[:0], s.preroll[excess:]...)
+			}
+			return nil
+		}
+		s.utterance = append([]float32(nil), s.preroll...)
+		s.preroll = s.preroll[:0]
+		s.voiced, s.silent = 0, 0
+	}
+
+	s.utterance = append(s.utterance, frame...)
+	if speech {
+		s.voiced += len(frame)
+		s.silent = 0
+	} else {
+		s.silent += len(frame)
+	}
+
+	if s.silent >= s.pause || (s.max > 0 && len(s.utterance) >= s.max) {
+		return s.end()
+	}
+	return nil
+}
+
+func (s *Segmenter) end() []float32 {
+	u := s.utterance
+	s.utterance = nil
+	if u == nil || s.voiced < s.minSpeech {
+		return nil
+	}
+	return u
+}
@@ -0,0 +1,82 @@
+package vad
+
+import (
+	"testing"
+	"time"
+)
+
+func feedAll(s *Segmenter, chunks ...[]float32) [][]float32 {
+	var out [][]float32
+	for _, c := range chunks {
+		out = append(out, s.Feed(c)...)
+	}
+	return out
+}
+
+func samplesFor(d time.Duration) int { return int(d * rate / time.Second) }
+
+// Durations below are whole 30ms frames so utterances end exactly on them
+
+func TestSegmenterSplitsOnPauses(t *testing.T) {
+	s := NewSegmenter(rate, SegmenterOptions{
+		Pause:   600 * time.Millisecond,
+		PreRoll: 300 * time.Millisecond,
+	})
+
+	got := feedAll(s,
+		silence(990*time.Millisecond),
+		tone(990*time.Millisecond, 0.2),
+		silence(300*time.Millisecond), // too short to end the utterance
+		tone(510*time.Millisecond, 0.2),
+		silence(990*time.Millisecond),
+		tone(390*time.Millisecond, 0.2),
+		silence(990*time.Millisecond),
+	)
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 utterances, got %d", len(got))
+	}
+	// Pre-roll, speech, the short pause, more speech and the ending pause
+	want := samplesFor(300*time.Millisecond + 990*time.Millisecond + 300*time.Millisecond + 510*time.Millisecond + 600*time.Millisecond)
+	if len(got[0]) != want {
+		t.Fatalf("first utterance has %d samples, want %d", len(got[0]), want)
+	}
+	if want := samplesFor(300*time.Millisecond + 390*time.Millisecond + 600*time.Millisecond); len(got[1]) != want {
+		t.Fatalf("second utterance has %d samples, want %d", len(got[1]), want)
+	}
+	if s.InUtterance() {
+		t.Fatal("expected to be waiting for speech")
+	}
+}
+
+func TestSegmenterDropsBlips(t *testing.T) {
+	s := NewSegmenter(rate, SegmenterOptions{
+		Pause:     600 * time.Millisecond,
+		MinSpeech: 200 * time.Millisecond,
+	})
+
+	if got := feedAll(s, tone(60*time.Millisecond, 0.2), silence(time.Second)); len(got) != 0 {
+		t.Fatalf("expected a click to be dropped, got %d utterances", len(got))
+	}
+}
+
+func TestSegmenterCutsLongUtterances(t *testing.T) {
+	s := NewSegmenter(rate, SegmenterOptions{
+		Pause: 600 * time.Millisecond,
+		Max:   900 * time.Millisecond,
+	})
+
+	got := feedAll(s, tone(2100*time.Millisecond, 0.2))
+	if len(got) != 2 || len(got[0]) != samplesFor(900*time.Millisecond) || len(got[1]) != samplesFor(900*time.Millisecond) {
+		t.Fatalf("expected two 900ms utterances, got %d", len(got))
+	}
+	if !s.InUtterance() {
+		t.Fatal("expected the rest of the speech to start another utterance")
+	}
+	if u := s.Flush(); len(u) != samplesFor(300*time.Millisecond) {
+		t.Fatalf("expected Flush to return the last 300ms, got %d samples", len(u))
+	}
+	if s.Flush() != nil {
+		t.Fatal("expected nothing left after Flush")
+	}
+}
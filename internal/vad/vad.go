@@ -0,0 +1,94 @@
+// Package vad is a small energy-based voice activity detector. It's crude
+// next to a trained model but needs no dependencies, and telling a quiet
+// room from someone speaking into a headset mic is all the app asks of it.
+package vad
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultThreshold is the RMS level, about -40 dBFS, above which a frame
+// counts as speech
+const DefaultThreshold = 0.01
+
+// frameDuration is the length of audio classified at a time
+const frameDuration = 30 * time.Millisecond
+
+// Detector classifies audio frame by frame as speech or silence and keeps
+// running totals. It's not safe for concurrent use.
+type Detector struct {
+	rate      int
+	threshold float64
+	frameLen  int
+	frame     []float32 // partial frame carried between Feed calls
+
+	total  int // samples in whole frames seen
+	voiced int // samples in frames above the threshold
+	silent int // samples in the current run of silent frames
+}
+
+// New returns a detector for audio at rate Hz. A threshold of 0 uses
+// DefaultThreshold.
+func New(rate int, threshold float64) *Detector {
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	frameLen := int(int64(rate) * int64(frameDuration) / int64(time.Second))
+	return &Detector{
+		rate:      rate,
+		threshold: threshold,
+		frameLen:  frameLen,
+		frame:     make([]float32, 0, frameLen),
+	}
+}
+
+// Feed classifies samples, holding back any partial frame until the next call
+func (d *Detector) Feed(samples []float32) {
+	for len(samples) > 0 {
+		n := min(d.frameLen-len(d.frame), len(samples))
+		d.frame = append(d.frame, samples[:n]...)
+		samples = samples[n:]
+		if len(d.frame) < d.frameLen {
+			return
+		}
+
+		d.total += len(d.frame)
+		if RMS(d.frame) >= d.threshold {
+			d.voiced += len(d.frame)
+			d.silent = 0
+		} else {
+			d.silent += len(d.frame)
+		}
+		d.frame = d.frame[:0]
+	}
+}
+
+// Duration is how much audio has been classified
+func (d *Detector) Duration() time.Duration { return d.duration(d.total) }
+
+// Voiced is how much of the audio was speech
+func (d *Detector) Voiced() time.Duration { return d.duration(d.voiced) }
+
+// Silence is how long the audio has been silent, counting back from the
+// latest frame
+func (d *Detector) Silence() time.Duration { return d.duration(d.silent) }
+
+// Speaking reports whether the latest frame was speech
+func (d *Detector) Speaking() bool { return d.total > 0 && d.silent == 0 }
+
+func (d *Detector) duration(samples int) time.Duration {
+	return time.Duration(samples) * time.Second / time.Duration(d.rate)
+}
+
+// RMS is the root mean square level of samples
+func RMS(samples []float32) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
@@ -0,0 +1,74 @@
+package vad
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+const rate = 16000
+
+func tone(d time.Duration, amplitude float64) []float32 {
+	n := int(d * rate / time.Second)
+	samples := make([]float32, n)
+	for i := range samples {
+		samples[i] = float32(amplitude * math.Sin(2*math.Pi*440*float64(i)/rate))
+	}
+	return samples
+}
+
+func silence(d time.Duration) []float32 {
+	return make([]float32, int(d*rate/time.Second))
+}
+
+func TestRMS(t *testing.T) {
+	if got := RMS(nil); got != 0 {
+		t.Fatalf("RMS of nothing = %v, want 0", got)
+	}
+	// A sine's RMS is its amplitude over √2
+	if got, want := RMS(tone(time.Second, 0.5)), 0.5/math.Sqrt2; math.Abs(got-want) > 0.001 {
+		t.Fatalf("RMS = %v, want %v", got, want)
+	}
+}
+
+func TestDetectorTracksSpeechAndSilence(t *testing.T) {
+	d := New(rate, 0)
+
+	d.Feed(silence(300 * time.Millisecond))
+	if d.Speaking() || d.Silence() != 300*time.Millisecond {
+		t.Fatalf("after silence: speaking=%v silence=%v", d.Speaking(), d.Silence())
+	}
+
+	d.Feed(tone(600*time.Millisecond, 0.2))
+	if !d.Speaking() || d.Silence() != 0 || d.Voiced() != 600*time.Millisecond {
+		t.Fatalf("after speech: speaking=%v silence=%v voiced=%v", d.Speaking(), d.Silence(), d.Voiced())
+	}
+
+	d.Feed(silence(900 * time.Millisecond))
+	if d.Silence() != 900*time.Millisecond || d.Duration() != 1800*time.Millisecond {
+		t.Fatalf("after trailing silence: silence=%v duration=%v", d.Silence(), d.Duration())
+	}
+}
+
+func TestDetectorIgnoresQuietNoise(t *testing.T) {
+	d := New(rate, 0)
+	d.Feed(tone(time.Second, 0.005))
+	if d.Voiced() != 0 {
+		t.Fatalf("expected noise below the threshold to be silence, got %v voiced", d.Voiced())
+	}
+}
+
+func TestDetectorCarriesPartialFrames(t *testing.T) {
+	d := New(rate, 0)
+	samples := tone(90*time.Millisecond, 0.2)
+
+	// Odd-sized chunks straddle the 30ms frames
+	for len(samples) > 0 {
+		n := min(100, len(samples))
+		d.Feed(samples[:n])
+		samples = samples[n:]
+	}
+	if d.Voiced() != 90*time.Millisecond {
+		t.Fatalf("expected every frame classified, got %v voiced", d.Voiced())
+	}
+}
@@ -0,0 +1,88 @@
+//go:build linux
+
+package watch
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyNotifier reports files closed after writing or moved into the
+// directory, which covers both direct saves and sync clients that download
+// to a temporary name and rename
+type inotifyNotifier struct {
+	file   *os.File
+	events chan string
+	stop   chan struct{}
+	err    error
+}
+
+func newNotifier(dir string) (notifier, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	// A non-blocking fd goes through the runtime poller, so Close unblocks Read
+	n := &inotifyNotifier{
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan string, 64),
+		stop:   make(chan struct{}),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotifyNotifier) read() {
+	defer close(n.events)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				n.err = err
+			}
+			return
+		}
+
+		for off := 0; off+unix.SizeofInotifyEvent <= count; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameStart := off + unix.SizeofInotifyEvent
+			off = nameStart + int(event.Len)
+
+			var name string
+			switch {
+			case event.Mask&unix.IN_Q_OVERFLOW != 0:
+				// name stays empty to ask for a rescan
+			case event.Mask&unix.IN_ISDIR != 0 || event.Len == 0:
+				continue
+			default:
+				name = string(bytes.TrimRight(buf[nameStart:off], "\x00"))
+			}
+
+			select {
+			case n.events <- name:
+			case <-n.stop:
+				return
+			}
+		}
+	}
+}
+
+func (n *inotifyNotifier) Events() <-chan string { return n.events }
+
+func (n *inotifyNotifier) Err() error { return n.err }
+
+func (n *inotifyNotifier) Close() error {
+	close(n.stop)
+	return n.file.Close()
+}
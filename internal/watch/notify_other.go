@@ -0,0 +1,89 @@
+//go:build !linux
+
+package watch
+
+import (
+	"os"
+	"time"
+)
+
+// pollInterval is how often the directory is rescanned where inotify isn't
+// available
+var pollInterval = 2 * time.Second
+
+// pollNotifier reports files whose size or mtime changed between scans
+type pollNotifier struct {
+	dir    string
+	events chan string
+	stop   chan struct{}
+	err    error
+}
+
+func newNotifier(dir string) (notifier, error) {
+	if _, err := os.ReadDir(dir); err != nil {
+		return nil, err
+	}
+	n := &pollNotifier{
+		dir:    dir,
+		events: make(chan string, 64),
+		stop:   make(chan struct{}),
+	}
+	go n.poll()
+	return n, nil
+}
+
+type fileVersion struct {
+	size    int64
+	modTime time.Time
+}
+
+func (n *pollNotifier) poll() {
+	defer close(n.events)
+
+	seen := n.scan()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := n.scan()
+		for name, v := range current {
+			if seen[name] != v {
+				select {
+				case n.events <- name:
+				case <-n.stop:
+					return
+				}
+			}
+		}
+		seen = current
+	}
+}
+
+func (n *pollNotifier) scan() map[string]fileVersion {
+	files := make(map[string]fileVersion)
+	entries, err := os.ReadDir(n.dir)
+	if err != nil {
+		return files
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && info.Mode().IsRegular() {
+			files[e.Name()] = fileVersion{size: info.Size(), modTime: info.ModTime()}
+		}
+	}
+	return files
+}
+
+func (n *pollNotifier) Events() <-chan string { return n.events }
+
+func (n *pollNotifier) Err() error { return n.err }
+
+func (n *pollNotifier) Close() error {
+	close(n.stop)
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package watch
+
+import "time"
+
+func init() {
+	pollInterval = 20 * time.Millisecond
+}
@@ -0,0 +1,70 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// state remembers which version of each file was processed. A file that is
+// replaced under the same name has a new size or mtime and is done again.
+type state struct {
+	path  string
+	Files map[string]processed `json:"files"`
+}
+
+type processed struct {
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+func loadState(path string) (*state, error) {
+	st := &state{path: path, Files: make(map[string]processed)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("corrupt watch state %s: %w", path, err)
+	}
+	if st.Files == nil {
+		st.Files = make(map[string]processed)
+	}
+	return st, nil
+}
+
+func (s *state) done(info fs.FileInfo) bool {
+	p, ok := s.Files[info.Name()]
+	return ok && p.Size == info.Size() && p.ModTime.Equal(info.ModTime())
+}
+
+func (s *state) record(info fs.FileInfo) {
+	s.Files[info.Name()] = processed{
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		ProcessedAt: time.Now(),
+	}
+}
+
+// save writes the state atomically so a crash can't leave it truncated
+func (s *state) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,141 @@
+// Package watch transcribes audio files as they appear in a directory, such
+// as a synced folder phones drop voice notes into.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/petems/whisper-tray/internal/audiofile"
+)
+
+// Processor transcribes one file
+type Processor func(path string) error
+
+// Options configures Run
+type Options struct {
+	Dir       string
+	StatePath string // records processed files so restarts skip them
+	// Settle is how long a file must go unchanged before it is processed,
+	// so files still being written or synced aren't picked up half done
+	Settle time.Duration
+	Logger zerolog.Logger
+}
+
+// notifier reports names of files in the watched directory that were
+// written or moved in. An empty name means events were lost and the
+// directory should be rescanned.
+type notifier interface {
+	Events() <-chan string
+	Err() error
+	Close() error
+}
+
+// Run processes audio files already in opts.Dir that haven't been processed
+// yet, then each new one as it settles, until ctx is cancelled
+func Run(ctx context.Context, opts Options, process Processor) error {
+	if opts.Settle <= 0 {
+		opts.Settle = 2 * time.Second
+	}
+	log := opts.Logger
+
+	st, err := loadState(opts.StatePath)
+	if err != nil {
+		return err
+	}
+
+	// Watch before scanning so files arriving in between aren't missed
+	n, err := newNotifier(opts.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", opts.Dir, err)
+	}
+	defer n.Close()
+
+	pending := make(map[string]time.Time)
+	scan := func() {
+		entries, err := os.ReadDir(opts.Dir)
+		if err != nil {
+			log.Error().Err(err).Str("dir", opts.Dir).Msg("Failed to scan watched directory")
+			return
+		}
+		for _, e := range entries {
+			if !e.IsDir() && candidate(e.Name()) {
+				pending[e.Name()] = time.Now()
+			}
+		}
+	}
+	scan()
+	log.Info().Str("dir", opts.Dir).Int("files", len(pending)).Msg("Watching for audio files")
+
+	ticker := time.NewTicker(opts.Settle / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case name, ok := <-n.Events():
+			if !ok {
+				return n.Err()
+			}
+			if name == "" {
+				log.Warn().Msg("Missed file events; rescanning")
+				scan()
+			} else if candidate(name) {
+				pending[name] = time.Now()
+			}
+
+		case <-ticker.C:
+			for name, changed := range pending {
+				if time.Since(changed) < opts.Settle {
+					continue
+				}
+				delete(pending, name)
+				handle(st, filepath.Join(opts.Dir, name), process, log)
+				if ctx.Err() != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// handle processes a settled file unless this version of it is already done
+func handle(st *state, path string, process Processor, log zerolog.Logger) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return // deleted or replaced while settling
+	}
+	if st.done(info) {
+		return
+	}
+
+	start := time.Now()
+	if err := process(path); err != nil {
+		// Not recorded, so the next start tries again
+		log.Error().Err(err).Str("file", path).Msg("Failed to transcribe")
+		return
+	}
+	log.Info().Str("file", path).Dur("took", time.Since(start)).Msg("Transcribed")
+
+	st.record(info)
+	if err := st.save(); err != nil {
+		log.Error().Err(err).Msg("Failed to save watch state")
+	}
+}
+
+// candidate reports whether a file name looks like finished audio. Hidden
+// files cover the temporary names sync clients download into.
+func candidate(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") {
+		return false
+	}
+	return audiofile.IsAudio(name)
+}
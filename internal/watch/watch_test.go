@@ -0,0 +1,132 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// startWatch runs Run in the background, sending each processed file name
+// to the returned channel. The returned func stops it.
+func startWatch(t *testing.T, dir, statePath string, fail bool) (<-chan string, func()) {
+	t.Helper()
+
+	processed := make(chan string, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, Options{
+			Dir:       dir,
+			StatePath: statePath,
+			Settle:    40 * time.Millisecond,
+			Logger:    zerolog.Nop(),
+		}, func(path string) error {
+			processed <- filepath.Base(path)
+			if fail {
+				return errors.New("decoder exploded")
+			}
+			return nil
+		})
+	}()
+
+	return processed, func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+	}
+}
+
+func expectFile(t *testing.T, processed <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-processed:
+		if got != want {
+			t.Fatalf("expected %s to be processed, got %s", want, got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out waiting for %s", want)
+	}
+}
+
+func expectNothing(t *testing.T, processed <-chan string) {
+	t.Helper()
+	select {
+	case got := <-processed:
+		t.Fatalf("expected nothing to be processed, got %s", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunProcessesExistingAndNewFiles(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	writeFile(t, filepath.Join(dir, "before.wav"), "audio")
+
+	processed, stop := startWatch(t, dir, statePath, false)
+	expectFile(t, processed, "before.wav")
+
+	writeFile(t, filepath.Join(dir, "notes.txt"), "not audio")
+	writeFile(t, filepath.Join(dir, ".partial.m4a"), "still syncing")
+	writeFile(t, filepath.Join(dir, "memo.m4a"), "audio")
+	expectFile(t, processed, "memo.m4a")
+
+	// Sync clients download to a temporary name and rename into place
+	writeFile(t, filepath.Join(dir, ".tmp-voice"), "audio")
+	if err := os.Rename(filepath.Join(dir, ".tmp-voice"), filepath.Join(dir, "voice.ogg")); err != nil {
+		t.Fatal(err)
+	}
+	expectFile(t, processed, "voice.ogg")
+	expectNothing(t, processed)
+	stop()
+
+	// A restart skips what was done, but not a file replaced since
+	processed, stop = startWatch(t, dir, statePath, false)
+	defer stop()
+	expectNothing(t, processed)
+
+	writeFile(t, filepath.Join(dir, "before.wav"), "re-recorded audio")
+	expectFile(t, processed, "before.wav")
+}
+
+func TestRunRetriesFailuresAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	writeFile(t, filepath.Join(dir, "memo.wav"), "audio")
+
+	processed, stop := startWatch(t, dir, statePath, true)
+	expectFile(t, processed, "memo.wav")
+	expectNothing(t, processed)
+	stop()
+
+	processed, stop = startWatch(t, dir, statePath, false)
+	defer stop()
+	expectFile(t, processed, "memo.wav")
+}
+
+func TestRunDebouncesWrites(t *testing.T) {
+	dir := t.TempDir()
+	processed, stop := startWatch(t, dir, filepath.Join(t.TempDir(), "state.json"), false)
+	defer stop()
+
+	// Several writes inside the settle window are one file
+	path := filepath.Join(dir, "memo.wav")
+	for i := 0; i < 5; i++ {
+		writeFile(t, path, "chunk")
+		time.Sleep(5 * time.Millisecond)
+	}
+	expectFile(t, processed, "memo.wav")
+	expectNothing(t, processed)
+}
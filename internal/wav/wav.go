@@ -0,0 +1,198 @@
+// Package wav writes the 16-bit PCM WAV files external transcription
+// backends expect, and reads uploaded WAV files back into whisper's input
+// format.
+package wav
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// maxFmtSize bounds the fmt chunk, which is at most 40 bytes in practice,
+// so a forged size can't make Read allocate gigabytes
+const maxFmtSize = 64
+
+// ErrNotWAV is returned by Read when the input isn't a RIFF/WAVE file
+var ErrNotWAV = errors.New("not a WAV file")
+
+// Write encodes mono float32 samples in [-1, 1] as a 16-bit PCM WAV file.
+// Samples outside that range are clipped.
+func Write(w io.Writer, samples []float32, sampleRate int) error {
+	const (
+		channels      = 1
+		bitsPerSample = 16
+		blockAlign    = channels * bitsPerSample / 8
+	)
+	dataSize := uint32(len(samples) * blockAlign)
+
+	header := struct {
+		RIFF          [4]byte
+		ChunkSize     uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		AudioFormat   uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     36 + dataSize,
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		AudioFormat:   1, // PCM
+		Channels:      channels,
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * blockAlign),
+		BlockAlign:    blockAlign,
+		BitsPerSample: bitsPerSample,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      dataSize,
+	}
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	pcm := make([]byte, dataSize)
+	for i, s := range samples {
+		v := math.Max(-1, math.Min(1, float64(s)))
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(int16(math.Round(v*math.MaxInt16))))
+	}
+	_, err := w.Write(pcm)
+	return err
+}
+
+// Read decodes a PCM or float WAV file into mono float32 samples, averaging
+// channels, and returns them with the file's sample rate.
+func Read(r io.Reader) ([]float32, int, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, 0, ErrNotWAV
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, 0, ErrNotWAV
+	}
+
+	var (
+		format        uint16
+		channels      int
+		sampleRate    int
+		bitsPerSample int
+		haveFmt       bool
+	)
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, 0, fmt.Errorf("WAV file has no data chunk")
+		}
+		id, size := string(chunk[0:4]), int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, fmt.Errorf("WAV fmt chunk too short")
+			}
+			if size > maxFmtSize {
+				return nil, 0, fmt.Errorf("WAV fmt chunk too long (%d bytes)", size)
+			}
+			body := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, 0, fmt.Errorf("truncated WAV fmt chunk: %w", err)
+			}
+			format = binary.LittleEndian.Uint16(body[0:2])
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+			if format == 0xFFFE && size >= 26 {
+				// WAVE_FORMAT_EXTENSIBLE keeps the real format in its sub-format GUID
+				format = binary.LittleEndian.Uint16(body[24:26])
+			}
+			haveFmt = true
+
+		case "data":
+			if !haveFmt {
+				return nil, 0, fmt.Errorf("WAV data chunk precedes fmt chunk")
+			}
+			if channels == 0 || sampleRate == 0 {
+				return nil, 0, fmt.Errorf("WAV file has %d channels at %d Hz", channels, sampleRate)
+			}
+			data, err := io.ReadAll(io.LimitReader(r, size))
+			if err != nil {
+				return nil, 0, err
+			}
+			samples, err := decode(data, format, channels, bitsPerSample)
+			return samples, sampleRate, err
+
+		default:
+			// Skip LIST, fact and other metadata; chunks are word aligned
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, 0, fmt.Errorf("WAV file has no data chunk")
+			}
+		}
+	}
+}
+
+// decode converts interleaved frames to mono float32
+func decode(data []byte, format uint16, channels, bitsPerSample int) ([]float32, error) {
+	width := bitsPerSample / 8
+	var sample func(b []byte) float64
+	switch {
+	case format == 1 && width == 1:
+		sample = func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	case format == 1 && width == 2:
+		sample = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / 32768 }
+	case format == 1 && width == 3:
+		sample = func(b []byte) float64 {
+			return float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / (1 << 23)
+		}
+	case format == 1 && width == 4:
+		sample = func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }
+	case format == 3 && width == 4:
+		sample = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	default:
+		return nil, fmt.Errorf("unsupported WAV encoding (format %d, %d bits)", format, bitsPerSample)
+	}
+
+	frame := width * channels
+	samples := make([]float32, len(data)/frame)
+	for i := range samples {
+		var sum float64
+		for c := 0; c < channels; c++ {
+			off := i*frame + c*width
+			sum += sample(data[off : off+width])
+		}
+		samples[i] = float32(sum / float64(channels))
+	}
+	return samples, nil
+}
+
+// Resample converts samples between rates by linear interpolation, which is
+// plenty for speech headed to whisper.
+func Resample(samples []float32, from, to int) []float32 {
+	if from == to || len(samples) == 0 {
+		return samples
+	}
+
+	n := int(int64(len(samples)) * int64(to) / int64(from))
+	out := make([]float32, n)
+	step := float64(from) / float64(to)
+	for i := range out {
+		pos := float64(i) * step
+		j := int(pos)
+		if j+1 >= len(samples) {
+			out[i] = samples[len(samples)-1]
+			continue
+		}
+		frac := float32(pos - float64(j))
+		out[i] = samples[j]*(1-frac) + samples[j+1]*frac
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestWriteHeaderAndSamples(t *testing.T) {
+	var buf bytes.Buffer
+	samples := []float32{0, 0.5, -0.5, 1, -1, 2, -2}
+	if err := Write(&buf, samples, 16000); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	b := buf.Bytes()
+	if len(b) != 44+len(samples)*2 {
+		t.Fatalf("expected %d bytes, got %d", 44+len(samples)*2, len(b))
+	}
+	if string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" || string(b[36:40]) != "data" {
+		t.Fatalf("bad chunk ids in header %q", b[:44])
+	}
+	if rate := binary.LittleEndian.Uint32(b[24:28]); rate != 16000 {
+		t.Fatalf("expected sample rate 16000, got %d", rate)
+	}
+	if size := binary.LittleEndian.Uint32(b[40:44]); size != uint32(len(samples)*2) {
+		t.Fatalf("expected data size %d, got %d", len(samples)*2, size)
+	}
+
+	want := []int16{0, 16384, -16384, 32767, -32767, 32767, -32767}
+	for i, w := range want {
+		got := int16(binary.LittleEndian.Uint16(b[44+i*2:]))
+		if got != w {
+			t.Fatalf("sample %d: expected %d, got %d", i, w, got)
+		}
+	}
+}
+
+func TestReadRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	samples := []float32{0, 0.5, -0.5, 0.25}
+	if err := Write(&buf, samples, 16000); err != nil {
+		t.Fatal(err)
+	}
+
+	got, rate, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if rate != 16000 || len(got) != len(samples) {
+		t.Fatalf("expected %d samples at 16000 Hz, got %d at %d", len(samples), len(got), rate)
+	}
+	for i := range samples {
+		if d := got[i] - samples[i]; d > 1e-4 || d < -1e-4 {
+			t.Fatalf("sample %d: expected %v, got %v", i, samples[i], got[i])
+		}
+	}
+}
+
+func TestReadStereo24BitWithMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	buf.WriteString("RIFF\x00\x00\x00\x00WAVE")
+	// An odd-sized LIST chunk must be skipped with its pad byte
+	buf.WriteString("LIST")
+	binary.Write(&buf, le, uint32(3))
+	buf.WriteString("abc\x00")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, le, []uint32{16})
+	binary.Write(&buf, le, []uint16{1, 2})
+	binary.Write(&buf, le, []uint32{44100, 44100 * 6})
+	binary.Write(&buf, le, []uint16{6, 24})
+	buf.WriteString("data")
+	binary.Write(&buf, le, uint32(6))
+	// Left at half scale, right silent
+	buf.Write([]byte{0x00, 0x00, 0x40, 0x00, 0x00, 0x00})
+
+	got, rate, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if rate != 44100 || len(got) != 1 || got[0] != 0.25 {
+		t.Fatalf("expected one downmixed sample of 0.25 at 44100 Hz, got %v at %d", got, rate)
+	}
+}
+
+func TestReadOddSizedFmtChunk(t *testing.T) {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+	buf.WriteString("RIFF\x00\x00\x00\x00WAVE")
+	// A 17-byte fmt chunk is followed by a pad byte before the data chunk
+	buf.WriteString("fmt ")
+	binary.Write(&buf, le, uint32(17))
+	binary.Write(&buf, le, []uint16{1, 1})
+	binary.Write(&buf, le, []uint32{16000, 32000})
+	binary.Write(&buf, le, []uint16{2, 16})
+	buf.Write([]byte{0, 0})
+	buf.WriteString("data")
+	binary.Write(&buf, le, uint32(2))
+	binary.Write(&buf, le, int16(16384))
+
+	got, rate, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read returned error: %v", err)
+	}
+	if rate != 16000 || len(got) != 1 || got[0] != 0.5 {
+		t.Fatalf("expected one sample of 0.5 at 16000 Hz, got %v at %d", got, rate)
+	}
+}
+
+func TestReadRejectsOversizedFmtChunk(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF\x00\x00\x00\x00WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(0xFFFFFFF0))
+
+	if _, _, err := Read(&buf); err == nil {
+		t.Fatal("expected an error for a forged fmt chunk size")
+	}
+}
+
+func TestReadRejectsOtherFormats(t *testing.T) {
+	if _, _, err := Read(bytes.NewReader([]byte("ID3\x04 not a wav file"))); err != ErrNotWAV {
+		t.Fatalf("expected ErrNotWAV, got %v", err)
+	}
+}
+
+func TestResample(t *testing.T) {
+	in := make([]float32, 48000)
+	for i := range in {
+		in[i] = float32(i) / 48000
+	}
+
+	out := Resample(in, 48000, 16000)
+	if len(out) != 16000 {
+		t.Fatalf("expected 16000 samples, got %d", len(out))
+	}
+	if d := out[8000] - in[24000]; d > 1e-6 || d < -1e-6 {
+		t.Fatalf("expected sample 8000 to match input 24000, got %v vs %v", out[8000], in[24000])
+	}
+	if got := Resample(in, 16000, 16000); &got[0] != &in[0] {
+		t.Fatal("expected matching rates to return the input unchanged")
+	}
+}
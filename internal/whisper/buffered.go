@@ -0,0 +1,70 @@
+package whisper
+
+import (
+	"fmt"
+	"sync"
+)
+
+// bufferedSession collects a whole utterance and transcribes it once on
+// Close, for backends that can't decode incrementally
+type bufferedSession struct {
+	transcribe func(samples []float32) ([]Segment, error)
+
+	mu       sync.Mutex
+	samples  []float32
+	closed   bool
+	partials chan string
+	finals   chan Segment
+}
+
+func newBufferedSession(transcribe func(samples []float32) ([]Segment, error)) *bufferedSession {
+	return &bufferedSession{
+		transcribe: transcribe,
+		samples:    make([]float32, 0, 16000*30), // 30 second buffer
+		partials:   make(chan string, 10),
+		finals:     make(chan Segment, 10),
+	}
+}
+
+func (s *bufferedSession) Feed(samples []float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("session is closed")
+	}
+	s.samples = append(s.samples, samples...)
+	return nil
+}
+
+func (s *bufferedSession) Partials() <-chan string {
+	return s.partials
+}
+
+func (s *bufferedSession) Finals() <-chan Segment {
+	return s.finals
+}
+
+func (s *bufferedSession) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	samples := s.samples
+	s.mu.Unlock()
+
+	var err error
+	if len(samples) > 0 {
+		var segments []Segment
+		segments, err = s.transcribe(samples)
+		for _, seg := range segments {
+			s.finals <- seg
+		}
+	}
+
+	close(s.partials)
+	close(s.finals)
+	return err
+}
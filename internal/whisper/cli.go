@@ -0,0 +1,258 @@
+package whisper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/wav"
+)
+
+// cliNames are looked up on PATH when whisper.cli.path isn't set. Recent
+// whisper.cpp releases name the binary whisper-cli; Homebrew used whisper-cpp.
+var cliNames = []string{"whisper-cli", "whisper-cpp"}
+
+// cliTimeout bounds a single run of the CLI
+const cliTimeout = 10 * time.Minute
+
+// cliTranscriber shells out to an installed whisper.cpp CLI, so newer builds
+// and acceleration flags can be used without rebuilding against the bindings.
+// Each utterance is written to a temporary WAV and decoded in one run.
+type cliTranscriber struct {
+	registry *Registry
+	binary   string
+	args     []string
+
+	mu        sync.Mutex
+	model     string
+	modelPath string // empty until the model has been fetched
+	closed    bool
+}
+
+func newCLITranscriber(cfg config.WhisperConfig, registry *Registry) (*cliTranscriber, error) {
+	binary, err := findCLI(cfg.CLI.Path)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("binary", binary).Msg("Using whisper.cpp CLI backend")
+
+	return &cliTranscriber{
+		registry: registry,
+		binary:   binary,
+		args:     cfg.CLI.Args,
+		model:    cfg.Model,
+	}, nil
+}
+
+func findCLI(path string) (string, error) {
+	if path != "" {
+		return exec.LookPath(path)
+	}
+	for _, name := range cliNames {
+		if p, err := exec.LookPath(name); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("whisper.cpp CLI not found on PATH (tried %s); set whisper.cli.path", strings.Join(cliNames, ", "))
+}
+
+func (t *cliTranscriber) StartSession(opts SessionOpts) (Session, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, fmt.Errorf("transcriber is closed")
+	}
+	model := t.model
+	return newBufferedSession(func(samples []float32) ([]Segment, error) {
+		path, err := t.pathFor(model)
+		if err != nil {
+			return nil, err
+		}
+		return t.run(path, samples, opts)
+	}), nil
+}
+
+// LoadModel fetches the model so sessions don't wait on a download
+func (t *cliTranscriber) LoadModel(model string, progress ProgressFunc) error {
+	path, err := ensureModel(t.registry, model, progress)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.model, t.modelPath = model, path
+	t.mu.Unlock()
+
+	log.Info().Str("model", model).Str("path", path).Msg("Whisper model ready for CLI")
+	return nil
+}
+
+func (t *cliTranscriber) LoadPartialModel(model string, _ ProgressFunc) error {
+	if model == "" {
+		return nil
+	}
+	return fmt.Errorf("the cli backend doesn't support a partials model")
+}
+
+// LoadWakeModel fetches the wake model up front; the CLI loads it on every
+// run anyway
+func (t *cliTranscriber) LoadWakeModel(model string, progress ProgressFunc) error {
+	if model == "" {
+		return nil
+	}
+	_, err := ensureModel(t.registry, model, progress)
+	return err
+}
+
+func (t *cliTranscriber) Transcribe(model string, samples []float32, opts SessionOpts, progress ProgressFunc) ([]Segment, error) {
+	path, err := ensureModel(t.registry, model, progress)
+	if err != nil {
+		return nil, err
+	}
+	return t.run(path, samples, opts)
+}
+
+func (t *cliTranscriber) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	return nil
+}
+
+// pathFor returns the model file, fetching it if LoadModel hasn't yet
+func (t *cliTranscriber) pathFor(model string) (string, error) {
+	t.mu.Lock()
+	if t.model == model && t.modelPath != "" {
+		defer t.mu.Unlock()
+		return t.modelPath, nil
+	}
+	t.mu.Unlock()
+	return ensureModel(t.registry, model, nil)
+}
+
+// run decodes samples with one invocation of the CLI and parses its JSON output
+func (t *cliTranscriber) run(modelPath string, samples []float32, opts SessionOpts) ([]Segment, error) {
+	dir, err := os.MkdirTemp("", "whisper-tray-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	wavPath := filepath.Join(dir, "audio.wav")
+	f, err := os.Create(wavPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := wav.Write(f, samples, 16000); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write audio: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	outBase := filepath.Join(dir, "out")
+	args := []string{"-m", modelPath, "-f", wavPath, "-oj", "-of", outBase}
+	if opts.Language != "" {
+		args = append(args, "-l", opts.Language)
+	}
+	if opts.Threads > 0 {
+		args = append(args, "-t", strconv.Itoa(opts.Threads))
+	}
+	if opts.BeamSize > 0 {
+		args = append(args, "-bs", strconv.Itoa(opts.BeamSize))
+	}
+	if opts.Temperature > 0 {
+		args = append(args, "-tp", strconv.FormatFloat(float64(opts.Temperature), 'f', -1, 32))
+	}
+	args = append(args, t.args...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+	defer cancel()
+
+	start := time.Now()
+	cmd := exec.CommandContext(ctx, t.binary, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", filepath.Base(t.binary), err, lastLine(stderr.String()))
+	}
+	log.Debug().
+		Dur("process_time", time.Since(start)).
+		Float64("duration_sec", float64(len(samples))/16000).
+		Msg("whisper.cpp CLI finished")
+
+	data, err := os.ReadFile(outBase + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("whisper.cpp CLI wrote no JSON output: %w", err)
+	}
+	return parseCLIOutput(data)
+}
+
+// cliOutput is the subset of whisper.cpp's -oj/-ojf output we use; tokens
+// are only present with -ojf
+type cliOutput struct {
+	Transcription []struct {
+		Offsets struct {
+			From int64 `json:"from"`
+			To   int64 `json:"to"`
+		} `json:"offsets"`
+		Text   string `json:"text"`
+		Tokens []struct {
+			Text string  `json:"text"`
+			P    float64 `json:"p"`
+		} `json:"tokens"`
+	} `json:"transcription"`
+}
+
+func parseCLIOutput(data []byte) ([]Segment, error) {
+	var out cliOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse whisper.cpp output: %w", err)
+	}
+
+	segments := make([]Segment, 0, len(out.Transcription))
+	for _, tr := range out.Transcription {
+		seg := Segment{
+			Text:  tr.Text,
+			Start: time.Duration(tr.Offsets.From) * time.Millisecond,
+			End:   time.Duration(tr.Offsets.To) * time.Millisecond,
+		}
+
+		// Average over text tokens, skipping specials like [_BEG_] and [_TT_42]
+		var sum float64
+		var count int
+		for _, tok := range tr.Tokens {
+			if strings.HasPrefix(tok.Text, "[_") || tok.P <= 0 {
+				continue
+			}
+			sum += math.Log(tok.P)
+			count++
+		}
+		if count > 0 {
+			seg.AvgLogProb = sum / float64(count)
+		}
+
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+// lastLine returns the last non-empty line of s, where CLIs put their error
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,130 @@
+package whisper
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeCLI is a stand-in for whisper-cli: it records its arguments and the
+// size of the WAV it was given, then writes canned -ojf output.
+const fakeCLI = `#!/bin/sh
+dir=$(dirname "$0")
+printf '%s\n' "$@" > "$dir/args"
+out=""
+while [ $# -gt 0 ]; do
+  case "$1" in
+    -of) out="$2"; shift ;;
+    -f) wc -c < "$2" | tr -d ' ' > "$dir/wavsize"; shift ;;
+  esac
+  shift
+done
+if [ -n "$FAKE_CLI_FAIL" ]; then
+  echo "whisper_init_from_file: loading model" >&2
+  echo "error: failed to initialize whisper context" >&2
+  exit 1
+fi
+cat > "$out.json" <<'JSON'
+{
+  "result": {"language": "en"},
+  "transcription": [
+    {
+      "offsets": {"from": 0, "to": 1500},
+      "text": " Hello world.",
+      "tokens": [
+        {"text": "[_BEG_]", "p": 0.9},
+        {"text": " Hello", "p": 0.5},
+        {"text": " world.", "p": 0.5}
+      ]
+    }
+  ]
+}
+JSON
+`
+
+func newFakeCLITranscriber(t *testing.T) (*cliTranscriber, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake CLI is a shell script")
+	}
+
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "whisper-cli")
+	if err := os.WriteFile(binary, []byte(fakeCLI), 0755); err != nil {
+		t.Fatal(err)
+	}
+	modelPath := filepath.Join(dir, "ggml-test.bin")
+	if err := os.WriteFile(modelPath, []byte("weights"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := &cliTranscriber{
+		registry: NewRegistry(nil, t.TempDir()),
+		binary:   binary,
+		args:     []string{"-fa"},
+		model:    modelPath,
+	}
+	return tr, dir
+}
+
+func TestCLITranscriberSession(t *testing.T) {
+	tr, dir := newFakeCLITranscriber(t)
+	if err := tr.LoadModel(tr.model, nil); err != nil {
+		t.Fatalf("LoadModel returned error: %v", err)
+	}
+
+	session, err := tr.StartSession(SessionOpts{Language: "en", Threads: 4})
+	if err != nil {
+		t.Fatalf("StartSession returned error: %v", err)
+	}
+	session.Feed(make([]float32, 8000))
+	session.Feed(make([]float32, 8000))
+
+	finals := make(chan []Segment, 1)
+	go func() {
+		var got []Segment
+		for seg := range session.Finals() {
+			got = append(got, seg)
+		}
+		finals <- got
+	}()
+	if err := session.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	got := <-finals
+	if len(got) != 1 || got[0].Text != " Hello world." {
+		t.Fatalf("unexpected segments %+v", got)
+	}
+	if got[0].End != 1500*time.Millisecond {
+		t.Fatalf("expected segment end 1.5s, got %v", got[0].End)
+	}
+	if want := math.Log(0.5); math.Abs(got[0].AvgLogProb-want) > 1e-9 {
+		t.Fatalf("expected avg logprob %v over text tokens, got %v", want, got[0].AvgLogProb)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	for _, want := range []string{"-m\n" + tr.model, "-l\nen", "-t\n4", "-oj", "-fa"} {
+		if !strings.Contains(string(args), want) {
+			t.Fatalf("expected %q in CLI args, got:\n%s", want, args)
+		}
+	}
+	size, _ := os.ReadFile(filepath.Join(dir, "wavsize"))
+	if strings.TrimSpace(string(size)) != "32044" {
+		t.Fatalf("expected a 16000-sample WAV (32044 bytes), got %q", size)
+	}
+}
+
+func TestCLITranscriberReportsFailure(t *testing.T) {
+	tr, _ := newFakeCLITranscriber(t)
+	t.Setenv("FAKE_CLI_FAIL", "1")
+
+	_, err := tr.Transcribe(tr.model, make([]float32, 16000), SessionOpts{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "failed to initialize whisper context") {
+		t.Fatalf("expected the CLI's error message, got %v", err)
+	}
+}
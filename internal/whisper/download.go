@@ -1,37 +1,37 @@
 package whisper
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
-// Model download URLs (Hugging Face)
-var modelURLs = map[string]string{
-	"base.en":         "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-base.en.bin",
-	"small.en":        "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-small.en.bin",
-	"medium.en":       "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-medium.en.bin",
-	"large-v3":        "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-large-v3.bin",
-	"large-v3-turbo":  "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-large-v3-turbo.bin",
-}
-
 // progressWriter wraps an io.Writer to track download progress
 type progressWriter struct {
 	total      int64
 	downloaded int64
 	lastLog    time.Time
 	model      string
+	onProgress ProgressFunc
 }
 
 func (pw *progressWriter) Write(p []byte) (int, error) {
 	n := len(p)
 	pw.downloaded += int64(n)
 
+	if pw.onProgress != nil {
+		pw.onProgress(pw.downloaded, pw.total)
+	}
+
 	// Log progress every 2 seconds or when complete
 	now := time.Now()
 	if now.Sub(pw.lastLog) >= 2*time.Second || pw.downloaded >= pw.total {
@@ -51,76 +51,305 @@ func (pw *progressWriter) Write(p []byte) (int, error) {
 	return n, nil
 }
 
-// downloadModel downloads a Whisper model if it doesn't exist
-func downloadModel(model string, destPath string) error {
-	url, ok := modelURLs[model]
-	if !ok {
-		return fmt.Errorf("unknown model: %s", model)
+// stallWriter cancels a download when no data has arrived for a while. A
+// whole-request timeout would be wrong for multi-gigabyte files.
+type stallWriter struct {
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (sw *stallWriter) Write(p []byte) (int, error) {
+	sw.timer.Reset(sw.timeout)
+	return len(p), nil
+}
+
+// downloader fetches model files with resume, retries and verification
+type downloader struct {
+	client       *http.Client
+	attempts     int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	stallTimeout time.Duration
+
+	// progress, if set, is called as bytes arrive; total is 0 when unknown
+	progress ProgressFunc
+}
+
+// diskHeadroom is kept free on top of the model size so a download can't
+// fill the disk completely.
+const diskHeadroom = 256 << 20
+
+// httpTransport carries every request the package makes. Tests replace it
+// to prove offline mode never touches the network.
+var httpTransport http.RoundTripper = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	TLSHandshakeTimeout:   30 * time.Second,
+	ResponseHeaderTimeout: 60 * time.Second,
+}
+
+func newDownloader() *downloader {
+	return &downloader{
+		client:       &http.Client{Transport: httpTransport},
+		attempts:     5,
+		backoff:      time.Second,
+		maxBackoff:   30 * time.Second,
+		stallTimeout: 60 * time.Second,
+	}
+}
+
+// ErrOffline is returned instead of touching the network when offline mode is on
+var ErrOffline = errors.New("offline mode is enabled")
+
+// errPermanent marks download failures that retrying cannot fix
+type errPermanent struct{ err error }
+
+func (e errPermanent) Error() string { return e.err.Error() }
+func (e errPermanent) Unwrap() error { return e.err }
+
+// downloadModel downloads a Whisper model, trying each of its URLs in turn
+func downloadModel(ctx context.Context, reg *Registry, info ModelInfo, destPath string, progress ProgressFunc) error {
+	if reg.offline {
+		return fmt.Errorf("%w: model %s is not downloaded; run \"whisper-tray models pull %s\" on a connected machine "+
+			"and copy it over with \"whisper-tray models import\", or turn off whisper.offline", ErrOffline, info.Name, info.Name)
+	}
+
+	urls := reg.DownloadURLs(info)
+	if len(urls) == 0 {
+		return fmt.Errorf("model %s has no download location", info.Name)
 	}
 
+	if info.Hash == "" {
+		log.Warn().Str("model", info.Name).
+			Msg("Model has no pinned checksum; trusting whatever the download delivers")
+	}
+
+	d := newDownloader()
+	d.progress = progress
+	var err error
+	for _, url := range urls {
+		entry := info.entry()
+		entry.URL = url
+		if err = d.fetch(ctx, info.Name, entry, destPath); err == nil {
+			return nil
+		}
+		log.Warn().Err(err).Str("model", info.Name).Str("url", url).Msg("Model download failed")
+		if errors.Is(err, errNoSpace) {
+			break // another mirror won't make the disk bigger
+		}
+	}
+	return err
+}
+
+// fetch downloads entry to destPath, resuming from a previous partial
+// download and retrying transient failures with exponential backoff.
+func (d *downloader) fetch(ctx context.Context, model string, entry manifestEntry, destPath string) error {
 	// Ensure directory exists
 	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
 		return fmt.Errorf("failed to create models directory: %w", err)
 	}
 
-	// Download to temp file first
+	// Download to temp file first; it is kept on failure so the next attempt can resume
 	tmpPath := destPath + ".tmp"
-	defer os.Remove(tmpPath)
 
-	log.Info().Str("model", model).Str("url", url).Msg("Starting model download")
+	log.Info().Str("model", model).Str("url", entry.URL).
+		Float64("size_mb", float64(entry.Size)/1024/1024).
+		Msg("Starting model download")
+
+	backoff := d.backoff
+	var err error
+	for attempt := 1; attempt <= d.attempts; attempt++ {
+		err = d.fetchOnce(ctx, model, entry, tmpPath)
+		if err == nil {
+			break
+		}
+
+		var permanent errPermanent
+		if errors.As(err, &permanent) || attempt == d.attempts {
+			return err
+		}
+
+		log.Warn().
+			Err(err).
+			Str("model", model).
+			Int("attempt", attempt).
+			Dur("retry_in", backoff).
+			Msg("Model download failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > d.maxBackoff {
+			backoff = d.maxBackoff
+		}
+	}
 
-	resp, err := http.Get(url)
+	log.Info().Str("model", model).Msg("Verifying model checksum")
+	algo := "sha256"
+	if entry.Hash != "" {
+		algo, _, _ = strings.Cut(entry.Hash, ":")
+	}
+	sum, err := hashFile(tmpPath, algo)
+	if err != nil {
+		return err
+	}
+	if entry.Hash != "" && !strings.EqualFold(sum, entry.Hash) {
+		// Corrupt data can't be resumed from; the next attempt starts over
+		os.Remove(tmpPath)
+		return fmt.Errorf("downloaded model %s has checksum %s, expected %s", model, sum, entry.Hash)
+	}
+
+	// Move to final location
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return fmt.Errorf("failed to move model file: %w", err)
+	}
+
+	// Record the verified digest so startup checks stay cheap
+	if err := writeRecord(destPath, sum); err != nil {
+		log.Warn().Err(err).Str("model", model).Msg("Failed to record model checksum")
+	}
+
+	info, _ := os.Stat(destPath)
+	log.Info().
+		Str("model", model).
+		Str("path", destPath).
+		Float64("size_mb", float64(info.Size())/1024/1024).
+		Msg("Model downloaded successfully")
+
+	return nil
+}
+
+// fetchOnce makes a single request, appending to tmpPath via an HTTP Range
+// request when a partial download is already present.
+func (d *downloader) fetchOnce(ctx context.Context, model string, entry manifestEntry, tmpPath string) error {
+	var offset int64
+	if info, err := os.Stat(tmpPath); err == nil {
+		offset = info.Size()
+	}
+	if entry.Size > 0 {
+		switch {
+		case offset > entry.Size:
+			// Longer than the model, so it isn't a partial copy of it
+			log.Warn().Str("model", model).Int64("partial", offset).Int64("size", entry.Size).
+				Msg("Partial download is larger than the model, starting over")
+			os.Remove(tmpPath)
+			offset = 0
+		case offset == entry.Size:
+			// Already complete; the checksum decides whether it's right
+			return nil
+		}
+		// With the size pinned the space needed is known before asking
+		if err := checkDiskSpace(filepath.Dir(tmpPath), entry.Size-offset); err != nil {
+			return errPermanent{err}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stall := time.AfterFunc(d.stallTimeout, cancel)
+	defer stall.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, entry.URL, nil)
+	if err != nil {
+		return errPermanent{fmt.Errorf("failed to create request: %w", err)}
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := d.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to download model: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		log.Info().Str("model", model).Int64("offset", offset).Msg("Resuming model download")
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusOK:
+		// Server ignored the range (or there was nothing to resume); start over
+		offset = 0
+		flags |= os.O_TRUNC
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The partial file already holds everything the server has
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
 		return fmt.Errorf("failed to download model: HTTP %d", resp.StatusCode)
+	default:
+		return errPermanent{fmt.Errorf("failed to download model: HTTP %d", resp.StatusCode)}
+	}
+
+	// A server offering a different size is serving a different file;
+	// don't download gigabytes only for the checksum to reject them
+	if entry.Size > 0 && resp.ContentLength >= 0 && offset+resp.ContentLength != entry.Size {
+		return errPermanent{fmt.Errorf("server has %d bytes of model %s from offset %d, expected %d in all",
+			resp.ContentLength, model, offset, entry.Size)}
 	}
 
-	// Get content length for progress tracking
-	totalSize := resp.ContentLength
+	// Get total size for progress tracking and truncation checks
+	totalSize := entry.Size
+	if totalSize <= 0 && resp.ContentLength > 0 {
+		totalSize = offset + resp.ContentLength
+		if err := checkDiskSpace(filepath.Dir(tmpPath), resp.ContentLength); err != nil {
+			return errPermanent{err}
+		}
+	}
 	if totalSize <= 0 {
 		log.Warn().Str("model", model).Msg("Content-Length not provided, progress tracking unavailable")
 	}
 
-	out, err := os.Create(tmpPath)
+	out, err := os.OpenFile(tmpPath, flags, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return errPermanent{fmt.Errorf("failed to create temp file: %w", err)}
 	}
 	defer out.Close()
 
+	writers := []io.Writer{out, &stallWriter{timer: stall, timeout: d.stallTimeout}}
 	// Use progress writer if we know the size
-	var writer io.Writer = out
 	if totalSize > 0 {
-		pw := &progressWriter{
-			total:   totalSize,
-			model:   model,
-			lastLog: time.Now(),
-		}
-		// Use MultiWriter to write to both file and progress tracker
-		writer = io.MultiWriter(out, pw)
+		writers = append(writers, &progressWriter{
+			total:      totalSize,
+			downloaded: offset,
+			model:      model,
+			lastLog:    time.Now(),
+			onProgress: d.progress,
+		})
 	}
 
-	_, err = io.Copy(writer, resp.Body)
+	written, err := io.Copy(io.MultiWriter(writers...), resp.Body)
 	if err != nil {
 		return fmt.Errorf("failed to write model file: %w", err)
 	}
 
-	// Move to final location
-	if err := os.Rename(tmpPath, destPath); err != nil {
-		return fmt.Errorf("failed to move model file: %w", err)
+	if totalSize > 0 && offset+written != totalSize {
+		return fmt.Errorf("model download truncated: got %d of %d bytes", offset+written, totalSize)
 	}
 
-	log.Info().
-		Str("model", model).
-		Str("path", destPath).
-		Float64("size_mb", float64(totalSize)/1024/1024).
-		Msg("Model downloaded successfully")
-
 	return nil
 }
 
-// TODO: Add SHA256 verification
-// TODO: Add resumable downloads
\ No newline at end of file
+// errNoSpace is returned when a model won't fit on disk
+var errNoSpace = errors.New("not enough disk space")
+
+// checkDiskSpace fails if dir's filesystem can't hold need more bytes
+func checkDiskSpace(dir string, need int64) error {
+	free, err := freeSpace(dir)
+	if err != nil {
+		// Not every filesystem reports free space; let the write fail instead
+		log.Debug().Err(err).Str("dir", dir).Msg("Could not determine free disk space")
+		return nil
+	}
+	if uint64(need)+diskHeadroom > free {
+		return fmt.Errorf("%w: need %.1f MB in %s, %.1f MB free", errNoSpace,
+			float64(need)/1024/1024, dir, float64(free)/1024/1024)
+	}
+	return nil
+}
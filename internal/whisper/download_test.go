@@ -0,0 +1,319 @@
+package whisper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeModelServer serves a fake model blob with Range support and can be
+// told to fail the first few requests.
+type fakeModelServer struct {
+	blob []byte
+
+	mu       sync.Mutex
+	failures int
+	requests int
+	ranges   []string
+}
+
+func (s *fakeModelServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	fail := s.failures > 0
+	if fail {
+		s.failures--
+	}
+	s.mu.Unlock()
+
+	if fail {
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+	http.ServeContent(w, r, "model.bin", time.Time{}, bytes.NewReader(s.blob))
+}
+
+func fakeBlob() []byte {
+	return bytes.Repeat([]byte("ggml-fake-weights-"), 4096)
+}
+
+func sha256Of(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func testDownloader() *downloader {
+	d := newDownloader()
+	d.backoff = time.Millisecond
+	d.maxBackoff = time.Millisecond
+	return d
+}
+
+func TestFetchVerifiesAndRecords(t *testing.T) {
+	blob := fakeBlob()
+	srv := httptest.NewServer(&fakeModelServer{blob: blob})
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "base.en.bin")
+	entry := manifestEntry{URL: srv.URL, Size: int64(len(blob)), Hash: sha256Of(blob)}
+
+	if err := testDownloader().fetch(context.Background(), "base.en", entry, dest); err != nil {
+		t.Fatalf("fetch returned error: %v", err)
+	}
+
+	got, err := os.ReadFile(dest)
+	if err != nil || !bytes.Equal(got, blob) {
+		t.Fatalf("downloaded file does not match blob (err=%v)", err)
+	}
+	rec, err := readRecord(dest)
+	if err != nil {
+		t.Fatalf("expected verification record: %v", err)
+	}
+	if rec.Hash != entry.Hash || rec.Size != int64(len(blob)) {
+		t.Fatalf("unexpected record %+v", rec)
+	}
+	if _, err := os.Stat(dest + ".tmp"); !os.IsNotExist(err) {
+		t.Fatal("expected temp file to be gone")
+	}
+}
+
+func TestFetchResumesPartialDownload(t *testing.T) {
+	blob := fakeBlob()
+	server := &fakeModelServer{blob: blob}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "base.en.bin")
+	half := len(blob) / 2
+	if err := os.WriteFile(dest+".tmp", blob[:half], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := manifestEntry{URL: srv.URL, Hash: sha256Of(blob)}
+	if err := testDownloader().fetch(context.Background(), "base.en", entry, dest); err != nil {
+		t.Fatalf("fetch returned error: %v", err)
+	}
+
+	got, _ := os.ReadFile(dest)
+	if !bytes.Equal(got, blob) {
+		t.Fatal("resumed file does not match blob")
+	}
+	if len(server.ranges) != 1 || !strings.HasPrefix(server.ranges[0], "bytes=") {
+		t.Fatalf("expected a single ranged request, got %q", server.ranges)
+	}
+}
+
+func TestFetchRetriesTransientFailures(t *testing.T) {
+	blob := fakeBlob()
+	server := &fakeModelServer{blob: blob, failures: 2}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "base.en.bin")
+	entry := manifestEntry{URL: srv.URL, Hash: sha256Of(blob)}
+
+	if err := testDownloader().fetch(context.Background(), "base.en", entry, dest); err != nil {
+		t.Fatalf("fetch returned error: %v", err)
+	}
+	if server.requests != 3 {
+		t.Fatalf("expected 3 requests, got %d", server.requests)
+	}
+}
+
+func TestFetchDoesNotRetryNotFound(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "base.en.bin")
+	err := testDownloader().fetch(context.Background(), "base.en", manifestEntry{URL: srv.URL}, dest)
+	if err == nil {
+		t.Fatal("expected error for missing model")
+	}
+	if requests != 1 {
+		t.Fatalf("expected a single request, got %d", requests)
+	}
+}
+
+func TestFetchRejectsChecksumMismatch(t *testing.T) {
+	blob := fakeBlob()
+	srv := httptest.NewServer(&fakeModelServer{blob: blob})
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "base.en.bin")
+	entry := manifestEntry{URL: srv.URL, Hash: sha256Of([]byte("something else"))}
+
+	err := testDownloader().fetch(context.Background(), "base.en", entry, dest)
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+	for _, path := range []string{dest, dest + ".tmp"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed", path)
+		}
+	}
+}
+
+func TestFetchRejectsWrongSizeBeforeDownloading(t *testing.T) {
+	blob := fakeBlob()
+	server := &fakeModelServer{blob: blob}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "base.en.bin")
+	entry := manifestEntry{URL: srv.URL, Size: int64(len(blob)) + 1, Hash: sha256Of(blob)}
+
+	err := testDownloader().fetch(context.Background(), "base.en", entry, dest)
+	if err == nil || !strings.Contains(err.Error(), "expected") {
+		t.Fatalf("expected a size mismatch error, got %v", err)
+	}
+	if server.requests != 1 {
+		t.Fatalf("expected no retries, got %d requests", server.requests)
+	}
+	if info, err := os.Stat(dest + ".tmp"); err == nil && info.Size() > 0 {
+		t.Fatalf("expected nothing downloaded, got %d bytes", info.Size())
+	}
+}
+
+func TestFetchRestartsOversizedPartial(t *testing.T) {
+	blob := fakeBlob()
+	server := &fakeModelServer{blob: blob}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "base.en.bin")
+	if err := os.WriteFile(dest+".tmp", append(blob, "trailing junk"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := manifestEntry{URL: srv.URL, Size: int64(len(blob)), Hash: sha256Of(blob)}
+	if err := testDownloader().fetch(context.Background(), "base.en", entry, dest); err != nil {
+		t.Fatalf("fetch returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(dest); !bytes.Equal(got, blob) {
+		t.Fatal("downloaded file does not match blob")
+	}
+	if len(server.ranges) != 1 || server.ranges[0] != "" {
+		t.Fatalf("expected one request from the start, got ranges %q", server.ranges)
+	}
+}
+
+func TestFetchChecksDiskSpaceBeforeRequesting(t *testing.T) {
+	server := &fakeModelServer{blob: fakeBlob()}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "large-v3.bin")
+	entry := manifestEntry{URL: srv.URL, Size: 1 << 60}
+
+	err := testDownloader().fetch(context.Background(), "large-v3", entry, dest)
+	if !errors.Is(err, errNoSpace) {
+		t.Fatalf("expected errNoSpace, got %v", err)
+	}
+	if server.requests != 0 {
+		t.Fatalf("expected no request for a model that can't fit, got %d", server.requests)
+	}
+}
+
+func TestVerifyModelDetectsTruncation(t *testing.T) {
+	blob := fakeBlob()
+	path := filepath.Join(t.TempDir(), "base.en.bin")
+	if err := os.WriteFile(path, blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// First verification hashes the file and records it
+	if err := verifyModel(path, manifestEntry{}, false); err != nil {
+		t.Fatalf("verifyModel returned error: %v", err)
+	}
+	if _, err := readRecord(path); err != nil {
+		t.Fatalf("expected record after verification: %v", err)
+	}
+
+	if err := os.Truncate(path, int64(len(blob)/3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyModel(path, manifestEntry{}, false); err == nil {
+		t.Fatal("expected truncated model to fail verification")
+	}
+}
+
+func TestVerifyModelChecksManifestHash(t *testing.T) {
+	blob := fakeBlob()
+	path := filepath.Join(t.TempDir(), "base.en.bin")
+	if err := os.WriteFile(path, blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyModel(path, manifestEntry{Hash: sha256Of(blob)}, false); err != nil {
+		t.Fatalf("expected matching hash to verify: %v", err)
+	}
+	if err := verifyModel(path, manifestEntry{Hash: sha256Of([]byte("other"))}, false); err == nil {
+		t.Fatal("expected mismatching hash to fail verification")
+	}
+}
+
+// refusingTransport fails and counts every request sent through it
+type refusingTransport struct {
+	calls atomic.Int32
+}
+
+func (rt *refusingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	rt.calls.Add(1)
+	return nil, errors.New("network access attempted")
+}
+
+func withTransport(t *testing.T, rt http.RoundTripper) {
+	old := httpTransport
+	httpTransport = rt
+	t.Cleanup(func() { httpTransport = old })
+}
+
+func TestOfflineModeNeverDials(t *testing.T) {
+	rt := &refusingTransport{}
+	withTransport(t, rt)
+
+	reg := NewRegistry([]string{"http://127.0.0.1:1"}, t.TempDir())
+	reg.offline = true
+
+	_, err := openModel(reg, "tiny.en", nil)
+	if !errors.Is(err, ErrOffline) {
+		t.Fatalf("expected ErrOffline from openModel, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "models import") {
+		t.Fatalf("expected an actionable error, got %q", err)
+	}
+	if err := reg.Pull(context.Background(), "base.en", nil); !errors.Is(err, ErrOffline) {
+		t.Fatalf("expected ErrOffline from Pull, got %v", err)
+	}
+	if n := rt.calls.Load(); n != 0 {
+		t.Fatalf("expected no network requests in offline mode, got %d", n)
+	}
+
+	// The same transport does see traffic when online, so the zero above
+	// isn't because downloads bypass it
+	d := testDownloader()
+	d.attempts = 1
+	dest := filepath.Join(t.TempDir(), "tiny.en.bin")
+	if err := d.fetch(context.Background(), "tiny.en", manifestEntry{URL: "http://127.0.0.1:1/x"}, dest); err == nil {
+		t.Fatal("expected fetch through refusing transport to fail")
+	}
+	if rt.calls.Load() == 0 {
+		t.Fatal("expected online fetch to go through the injected transport")
+	}
+}
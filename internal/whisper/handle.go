@@ -0,0 +1,112 @@
+package whisper
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	whisper "github.com/ggerganov/whisper.cpp/bindings/go/pkg/whisper"
+	"github.com/rs/zerolog/log"
+)
+
+// modelHandle is a reference-counted loaded model. The transcriber holds one
+// reference while the handle is current and every session holds another for
+// its lifetime, so swapping models never frees one that is still decoding.
+type modelHandle struct {
+	name  string
+	path  string
+	model whisper.Model
+
+	refs atomic.Int32
+
+	// decodeMu serializes Process calls: contexts created from the same
+	// model share its underlying whisper_context.
+	decodeMu sync.Mutex
+}
+
+// newModelHandle wraps a loaded model with a single reference owned by the caller
+func newModelHandle(name, path string, model whisper.Model) *modelHandle {
+	h := &modelHandle{
+		name:  name,
+		path:  path,
+		model: model,
+	}
+	h.refs.Store(1)
+	return h
+}
+
+// acquire takes an extra reference. Callers must already hold a reference
+// (or the transcriber lock guarding the current handle).
+func (h *modelHandle) acquire() *modelHandle {
+	h.refs.Add(1)
+	return h
+}
+
+// release drops a reference and frees the model once nobody uses it
+func (h *modelHandle) release() {
+	if h.refs.Add(-1) != 0 {
+		return
+	}
+	log.Debug().Str("model", h.name).Msg("Freeing whisper model")
+	h.model.Close()
+}
+
+// decode runs a full whisper pass over samples and returns its segments.
+// Contexts created from one model share its state, so decodes on the same
+// handle are serialized.
+func (h *modelHandle) decode(samples []float32, opts SessionOpts) ([]Segment, error) {
+	h.decodeMu.Lock()
+	defer h.decodeMu.Unlock()
+
+	context, err := h.model.NewContext()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create context: %w", err)
+	}
+
+	// Set parameters
+	if opts.Threads > 0 {
+		context.SetThreads(uint(opts.Threads))
+	}
+	if opts.Language != "auto" && opts.Language != "" {
+		context.SetLanguage(opts.Language)
+	}
+	context.SetTranslate(false)
+
+	if err := context.Process(samples, nil, nil); err != nil {
+		return nil, fmt.Errorf("whisper process failed: %w", err)
+	}
+
+	var segments []Segment
+	for {
+		segment, err := context.NextSegment()
+		if err != nil {
+			break // EOF or error
+		}
+		segments = append(segments, Segment{
+			Text:       segment.Text,
+			Start:      segment.Start,
+			End:        segment.End,
+			AvgLogProb: avgLogProb(context, segment.Tokens),
+		})
+	}
+	return segments, nil
+}
+
+// avgLogProb averages the log-probability of the text tokens in a segment,
+// skipping timestamps and other special tokens.
+func avgLogProb(context whisper.Context, tokens []whisper.Token) float64 {
+	var sum float64
+	var count int
+	for _, token := range tokens {
+		if !context.IsText(token) || token.P <= 0 {
+			continue
+		}
+		sum += math.Log(float64(token.P))
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
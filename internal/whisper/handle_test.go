@@ -0,0 +1,489 @@
+package whisper
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	whisper "github.com/ggerganov/whisper.cpp/bindings/go/pkg/whisper"
+)
+
+type fakeModel struct {
+	whisper.Model
+	closed atomic.Int32
+
+	// decoded receives the number of samples in each Process call
+	decoded chan int
+	// text, if set, is returned as the single segment of every decode
+	text string
+	// err, if set, fails every decode
+	err error
+}
+
+func (m *fakeModel) Close() error {
+	m.closed.Add(1)
+	return nil
+}
+
+func (m *fakeModel) NewContext() (whisper.Context, error) {
+	return &fakeContext{model: m}, nil
+}
+
+type fakeContext struct {
+	whisper.Context
+	model  *fakeModel
+	served bool
+}
+
+func (c *fakeContext) SetThreads(uint)           {}
+func (c *fakeContext) SetLanguage(string) error  { return nil }
+func (c *fakeContext) SetTranslate(bool)         {}
+func (c *fakeContext) IsText(whisper.Token) bool { return true }
+
+func (c *fakeContext) NextSegment() (whisper.Segment, error) {
+	if c.served || c.model.text == "" {
+		return whisper.Segment{}, io.EOF
+	}
+	c.served = true
+	return whisper.Segment{Text: c.model.text}, nil
+}
+
+func (c *fakeContext) Process(samples []float32, _ whisper.SegmentCallback, _ whisper.ProgressCallback) error {
+	c.model.decoded <- len(samples)
+	return c.model.err
+}
+
+func newFakeModel() *fakeModel {
+	return &fakeModel{decoded: make(chan int, 16)}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestModelSwapWaitsForSessions(t *testing.T) {
+	oldModel := newFakeModel()
+	newModel := newFakeModel()
+
+	w := &whisperTranscriber{current: newModelHandle("base.en", "base.en.bin", oldModel)}
+
+	session, err := w.StartSession(SessionOpts{})
+	if err != nil {
+		t.Fatalf("StartSession returned error: %v", err)
+	}
+
+	// Swap while the session still holds the old model
+	old := w.current
+	w.current = newModelHandle("small.en", "small.en.bin", newModel)
+	old.release()
+
+	if oldModel.closed.Load() != 0 {
+		t.Fatal("old model freed while a session was using it")
+	}
+
+	if err := session.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if n := oldModel.closed.Load(); n != 1 {
+		t.Fatalf("expected old model freed once after last session closed, got %d", n)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("transcriber Close returned error: %v", err)
+	}
+	if n := newModel.closed.Load(); n != 1 {
+		t.Fatalf("expected current model freed on Close, got %d", n)
+	}
+}
+
+func TestSessionCloseIsIdempotent(t *testing.T) {
+	w := &whisperTranscriber{current: newModelHandle("base.en", "base.en.bin", newFakeModel())}
+	defer w.Close()
+
+	session, err := w.StartSession(SessionOpts{})
+	if err != nil {
+		t.Fatalf("StartSession returned error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := session.Close(); err != nil {
+			t.Fatalf("Close %d returned error: %v", i+1, err)
+		}
+	}
+
+	w.mu.Lock()
+	active := w.active
+	w.mu.Unlock()
+	if active != 0 {
+		t.Fatalf("expected the session counted out once, active is %d", active)
+	}
+}
+
+func TestStartSessionAfterClose(t *testing.T) {
+	w := &whisperTranscriber{current: newModelHandle("base.en", "base.en.bin", newFakeModel())}
+	w.Close()
+
+	if _, err := w.StartSession(SessionOpts{}); err == nil {
+		t.Fatal("expected error starting a session on a closed transcriber")
+	}
+}
+
+func TestCloseWaitsForFedChunks(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		m := newFakeModel()
+		m.text = "chunk"
+		w := &whisperTranscriber{model: "base.en", current: newModelHandle("base.en", "base.en.bin", m)}
+
+		session, err := w.StartSession(SessionOpts{})
+		if err != nil {
+			t.Fatalf("StartSession returned error: %v", err)
+		}
+		finals := make(chan int, 1)
+		go func() {
+			n := 0
+			for range session.Finals() {
+				n++
+			}
+			finals <- n
+		}()
+
+		// Close straight after a Feed that spawns a decode, as the server does
+		session.Feed(make([]float32, 16000))
+		if err := session.Close(); err != nil {
+			t.Fatalf("Close returned error: %v", err)
+		}
+		if n := <-finals; n != 1 {
+			t.Fatalf("expected the fed chunk decoded once, got %d finals", n)
+		}
+		if err := session.Feed(make([]float32, 16000)); err == nil {
+			t.Fatal("expected Feed after Close to fail")
+		}
+		w.Close()
+	}
+}
+
+func TestCloseReturnsFinalDecodeError(t *testing.T) {
+	m := newFakeModel()
+	m.err = errors.New("decoder exploded")
+	w := &whisperTranscriber{model: "base.en", current: newModelHandle("base.en", "base.en.bin", m)}
+	defer w.Close()
+
+	session, err := w.StartSession(SessionOpts{})
+	if err != nil {
+		t.Fatalf("StartSession returned error: %v", err)
+	}
+	go func() {
+		for range session.Finals() {
+		}
+	}()
+
+	// Too little audio for a chunk, so Close runs the only decode
+	session.Feed(make([]float32, 1600))
+	if err := session.Close(); !errors.Is(err, m.err) {
+		t.Fatalf("expected Close to return the decode error, got %v", err)
+	}
+}
+
+func TestIdleUnloadReloadsOnDemand(t *testing.T) {
+	var opens atomic.Int32
+	gate := make(chan struct{})
+	reloaded := make(chan *fakeModel, 1)
+
+	w := &whisperTranscriber{
+		open: func(_ *Registry, name string, _ ProgressFunc) (*modelHandle, error) {
+			opens.Add(1)
+			<-gate
+			m := newFakeModel()
+			reloaded <- m
+			return newModelHandle(name, name+".bin", m), nil
+		},
+		idleTimeout: 20 * time.Millisecond,
+		model:       "base.en",
+	}
+	defer w.Close()
+
+	first := newFakeModel()
+	w.mu.Lock()
+	w.current = newModelHandle("base.en", "base.en.bin", first)
+	w.loadedLocked(w.current, false)
+	w.mu.Unlock()
+
+	waitFor(t, "idle unload", func() bool { return first.closed.Load() == 1 })
+
+	// Sessions start straight away and buffer audio while the model reloads
+	s1, err := w.StartSession(SessionOpts{})
+	if err != nil {
+		t.Fatalf("StartSession returned error: %v", err)
+	}
+	s2, err := w.StartSession(SessionOpts{})
+	if err != nil {
+		t.Fatalf("second StartSession returned error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		s1.Feed(make([]float32, 16000))
+	}
+
+	close(gate)
+	if err := s1.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if err := s2.Close(); err != nil {
+		t.Fatalf("second Close returned error: %v", err)
+	}
+
+	if n := opens.Load(); n != 1 {
+		t.Fatalf("expected concurrent sessions to share one reload, got %d", n)
+	}
+
+	m := <-reloaded
+	total := 0
+	for len(m.decoded) > 0 {
+		total += <-m.decoded
+	}
+	if total != 3*16000 {
+		t.Fatalf("expected all buffered audio decoded after reload, got %d samples", total)
+	}
+
+	waitFor(t, "second idle unload", func() bool { return m.closed.Load() == 1 })
+}
+
+func TestIdleUnloadWaitsForTranscribe(t *testing.T) {
+	w := &whisperTranscriber{idleTimeout: 20 * time.Millisecond, model: "base.en"}
+	defer w.Close()
+
+	// An unbuffered channel holds the decode until the test reads it
+	m := &fakeModel{decoded: make(chan int), text: "slow"}
+	w.mu.Lock()
+	w.current = newModelHandle("base.en", "base.en.bin", m)
+	w.loadedLocked(w.current, false)
+	w.mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.Transcribe("base.en", make([]float32, 16000), SessionOpts{}, nil)
+		done <- err
+	}()
+
+	// Decoding outlasts the idle timeout without the model being unloaded
+	time.Sleep(60 * time.Millisecond)
+	w.mu.Lock()
+	unloaded := w.current == nil
+	w.mu.Unlock()
+	if unloaded {
+		t.Fatal("model unloaded while Transcribe was decoding")
+	}
+	<-m.decoded
+	if err := <-done; err != nil {
+		t.Fatalf("Transcribe returned error: %v", err)
+	}
+
+	// The countdown starts over once it's done
+	waitFor(t, "idle unload after Transcribe", func() bool { return m.closed.Load() == 1 })
+}
+
+func TestWarmupDecodesAfterLoad(t *testing.T) {
+	m := newFakeModel()
+	w := &whisperTranscriber{warmup: true, model: "base.en"}
+	defer w.Close()
+
+	w.mu.Lock()
+	w.current = newModelHandle("base.en", "base.en.bin", m)
+	w.loadedLocked(w.current, true)
+	w.mu.Unlock()
+
+	select {
+	case n := <-m.decoded:
+		if n != warmupSamples {
+			t.Fatalf("expected warm-up of %d samples, got %d", warmupSamples, n)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a warm-up decode after load")
+	}
+}
+
+func TestTwoPassPartialsAndFinal(t *testing.T) {
+	accurate := newFakeModel()
+	accurate.text = "final text"
+	fast := newFakeModel()
+	fast.text = "partial text"
+
+	w := &whisperTranscriber{
+		model:   "large-v3",
+		current: newModelHandle("large-v3", "large-v3.bin", accurate),
+		partial: newModelHandle("tiny.en", "tiny.en.bin", fast),
+	}
+
+	session, err := w.StartSession(SessionOpts{})
+	if err != nil {
+		t.Fatalf("StartSession returned error: %v", err)
+	}
+
+	session.Feed(make([]float32, 16000))
+	select {
+	case p := <-session.Partials():
+		if p != "partial text" {
+			t.Fatalf("unexpected partial %q", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a partial from the fast model")
+	}
+	session.Feed(make([]float32, 8000))
+
+	finals := make(chan Segment, 4)
+	go func() {
+		for seg := range session.Finals() {
+			finals <- seg
+		}
+		close(finals)
+	}()
+	if err := session.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	var got []string
+	for seg := range finals {
+		got = append(got, seg.Text)
+	}
+	if len(got) != 1 || got[0] != "final text" {
+		t.Fatalf("expected one final from the main model, got %q", got)
+	}
+	if n := <-accurate.decoded; n != 24000 {
+		t.Fatalf("expected the main model to decode the whole utterance, got %d samples", n)
+	}
+	if len(accurate.decoded) != 0 {
+		t.Fatal("expected the main model to decode only once")
+	}
+
+	// The partials model stays loaded after the session until the transcriber closes
+	if fast.closed.Load() != 0 {
+		t.Fatal("partials model freed with the session")
+	}
+	w.Close()
+	if fast.closed.Load() != 1 || accurate.closed.Load() != 1 {
+		t.Fatal("expected both models freed on Close")
+	}
+}
+
+func TestTranscribeKeepsOtherModelUntilIdle(t *testing.T) {
+	current := newFakeModel()
+	other := newFakeModel()
+	other.text = "from large-v3"
+
+	var opens atomic.Int32
+	w := &whisperTranscriber{
+		open: func(_ *Registry, name string, _ ProgressFunc) (*modelHandle, error) {
+			opens.Add(1)
+			return newModelHandle(name, name+".bin", other), nil
+		},
+		idleTimeout: 50 * time.Millisecond,
+		model:       "small.en",
+		current:     newModelHandle("small.en", "small.en.bin", current),
+	}
+	defer w.Close()
+
+	for i := 0; i < 2; i++ {
+		segments, err := w.Transcribe("large-v3", make([]float32, 16000), SessionOpts{}, nil)
+		if err != nil {
+			t.Fatalf("Transcribe returned error: %v", err)
+		}
+		if len(segments) != 1 || segments[0].Text != "from large-v3" {
+			t.Fatalf("unexpected segments %+v", segments)
+		}
+	}
+	if n := opens.Load(); n != 1 {
+		t.Fatalf("expected the other model loaded once for both calls, got %d", n)
+	}
+	if other.closed.Load() != 0 {
+		t.Fatal("expected the other model kept loaded between calls")
+	}
+	if len(current.decoded) != 0 {
+		t.Fatal("expected the current model to be left alone")
+	}
+
+	// Going idle frees it along with the main model
+	waitFor(t, "idle unload", func() bool { return other.closed.Load() == 1 })
+	if current.closed.Load() != 1 {
+		t.Fatal("expected the main model unloaded too")
+	}
+}
+
+func TestWakeModelStaysLoaded(t *testing.T) {
+	var opens atomic.Int32
+	wake := newFakeModel()
+	wake.text = "hey whisper"
+	w := &whisperTranscriber{
+		open: func(_ *Registry, name string, _ ProgressFunc) (*modelHandle, error) {
+			opens.Add(1)
+			return newModelHandle(name, name+".bin", wake), nil
+		},
+		model: "large-v3",
+	}
+	defer w.Close()
+
+	if err := w.LoadWakeModel("tiny.en", nil); err != nil {
+		t.Fatalf("LoadWakeModel returned error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		segments, err := w.Transcribe("tiny.en", make([]float32, 16000), SessionOpts{}, nil)
+		if err != nil {
+			t.Fatalf("Transcribe returned error: %v", err)
+		}
+		if len(segments) != 1 || segments[0].Text != "hey whisper" {
+			t.Fatalf("unexpected segments %+v", segments)
+		}
+	}
+	if n := opens.Load(); n != 1 {
+		t.Fatalf("expected the wake model loaded once, got %d", n)
+	}
+
+	if err := w.LoadWakeModel("", nil); err != nil {
+		t.Fatalf("LoadWakeModel returned error: %v", err)
+	}
+	if wake.closed.Load() != 1 {
+		t.Fatal("expected the wake model freed")
+	}
+}
+
+func TestTranscribeReloadsIdleMainModel(t *testing.T) {
+	var opens atomic.Int32
+	reloaded := newFakeModel()
+	reloaded.text = "reloaded"
+	w := &whisperTranscriber{
+		open: func(_ *Registry, name string, _ ProgressFunc) (*modelHandle, error) {
+			opens.Add(1)
+			return newModelHandle(name, name+".bin", reloaded), nil
+		},
+		model: "base.en",
+	}
+	defer w.Close()
+
+	// Nothing loaded, as after an idle unload
+	segments, err := w.Transcribe("base.en", make([]float32, 16000), SessionOpts{}, nil)
+	if err != nil {
+		t.Fatalf("Transcribe returned error: %v", err)
+	}
+	if len(segments) != 1 || segments[0].Text != "reloaded" {
+		t.Fatalf("unexpected segments %+v", segments)
+	}
+
+	// The reload becomes the main model, so a session doesn't load it again
+	session, err := w.StartSession(SessionOpts{})
+	if err != nil {
+		t.Fatalf("StartSession returned error: %v", err)
+	}
+	session.Close()
+	if n := opens.Load(); n != 1 {
+		t.Fatalf("expected the main model loaded once, got %d", n)
+	}
+	if reloaded.closed.Load() != 0 {
+		t.Fatal("expected the reloaded model kept as the main model")
+	}
+}
@@ -0,0 +1,277 @@
+package whisper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/petems/whisper-tray/internal/config"
+	"github.com/petems/whisper-tray/internal/wav"
+)
+
+// httpTranscriber posts each utterance to an OpenAI-compatible
+// /audio/transcriptions endpoint, such as a self-hosted whisper or
+// faster-whisper server. When a request fails it can fall back to decoding
+// locally with the configured whisper model.
+type httpTranscriber struct {
+	endpoint string
+	model    string // remote model name
+	token    string
+	client   *http.Client
+	registry *Registry
+
+	// local decodes when the server fails; nil when fallback is off
+	local Transcriber
+
+	mu         sync.Mutex
+	localModel string
+	closed     bool
+}
+
+func newHTTPTranscriber(cfg config.WhisperConfig, registry *Registry) (*httpTranscriber, error) {
+	if cfg.HTTP.BaseURL == "" {
+		return nil, fmt.Errorf("whisper.http.base_url must be set for the http backend")
+	}
+
+	token, err := loadToken(cfg.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" && !safeForToken(cfg.HTTP.BaseURL) {
+		return nil, fmt.Errorf("refusing to send the API token over plain HTTP to %s; use https or drop the token", cfg.HTTP.BaseURL)
+	}
+
+	timeout := time.Duration(cfg.HTTP.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+
+	t := &httpTranscriber{
+		endpoint:   strings.TrimSuffix(cfg.HTTP.BaseURL, "/") + "/audio/transcriptions",
+		model:      cfg.HTTP.Model,
+		token:      token,
+		client:     &http.Client{Transport: httpTransport, Timeout: timeout},
+		registry:   registry,
+		localModel: cfg.Model,
+	}
+	if cfg.HTTP.Fallback {
+		// Nothing is loaded until a request actually fails
+		t.local = &whisperTranscriber{
+			registry: registry,
+			open:     openModel,
+			threads:  cfg.Threads,
+			model:    cfg.Model,
+		}
+	}
+
+	log.Info().Str("endpoint", t.endpoint).Bool("fallback", cfg.HTTP.Fallback).Msg("Using HTTP transcription backend")
+	return t, nil
+}
+
+// loadToken reads the API token from token_file, else from the environment
+// variable named by token_env
+func loadToken(cfg config.HTTPConfig) (string, error) {
+	if cfg.TokenFile != "" {
+		data, err := os.ReadFile(cfg.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read API token: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if cfg.TokenEnv != "" {
+		return os.Getenv(cfg.TokenEnv), nil
+	}
+	return "", nil
+}
+
+// safeForToken reports whether a token can go to baseURL without crossing
+// the network in the clear: it's https, or plain http to this machine
+func safeForToken(baseURL string) bool {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Scheme, "https") {
+		return true
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (t *httpTranscriber) StartSession(opts SessionOpts) (Session, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, fmt.Errorf("transcriber is closed")
+	}
+	localModel := t.localModel
+	return newBufferedSession(func(samples []float32) ([]Segment, error) {
+		segments, err := t.post(samples, opts)
+		if err == nil || t.local == nil {
+			return segments, err
+		}
+		log.Warn().Err(err).Str("model", localModel).Msg("Transcription server failed, falling back to local model")
+		return t.local.Transcribe(localModel, samples, opts, nil)
+	}), nil
+}
+
+// LoadModel selects the local model used for fallback, fetching it up front
+// so a fallback doesn't have to wait on a download
+func (t *httpTranscriber) LoadModel(model string, progress ProgressFunc) error {
+	if t.local != nil {
+		if _, err := ensureModel(t.registry, model, progress); err != nil {
+			return err
+		}
+	}
+
+	t.mu.Lock()
+	t.localModel = model
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *httpTranscriber) LoadPartialModel(model string, _ ProgressFunc) error {
+	if model == "" {
+		return nil
+	}
+	return fmt.Errorf("the http backend doesn't support a partials model")
+}
+
+// LoadWakeModel loads the wake model into the local fallback, which is what
+// listens for the phrase
+func (t *httpTranscriber) LoadWakeModel(model string, progress ProgressFunc) error {
+	if t.local == nil {
+		if model == "" {
+			return nil
+		}
+		return fmt.Errorf("listening for the wake phrase needs whisper.http.fallback enabled")
+	}
+	return t.local.LoadWakeModel(model, progress)
+}
+
+// Transcribe decodes with a named local model, which is what redo asks for
+func (t *httpTranscriber) Transcribe(model string, samples []float32, opts SessionOpts, progress ProgressFunc) ([]Segment, error) {
+	if t.local == nil {
+		return nil, fmt.Errorf("transcribing with local model %s needs whisper.http.fallback enabled", model)
+	}
+	return t.local.Transcribe(model, samples, opts, progress)
+}
+
+func (t *httpTranscriber) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+
+	if t.local != nil {
+		return t.local.Close()
+	}
+	return nil
+}
+
+// transcriptionResponse is the verbose_json response; plain servers may
+// only fill in Text
+type transcriptionResponse struct {
+	Text     string `json:"text"`
+	Segments []struct {
+		Start        float64 `json:"start"`
+		End          float64 `json:"end"`
+		Text         string  `json:"text"`
+		AvgLogProb   float64 `json:"avg_logprob"`
+		NoSpeechProb float64 `json:"no_speech_prob"`
+	} `json:"segments"`
+}
+
+// post sends one utterance to the server
+func (t *httpTranscriber) post(samples []float32, opts SessionOpts) ([]Segment, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	file, err := form.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return nil, err
+	}
+	if err := wav.Write(file, samples, 16000); err != nil {
+		return nil, fmt.Errorf("failed to encode audio: %w", err)
+	}
+	form.WriteField("model", t.model)
+	form.WriteField("response_format", "verbose_json")
+	if opts.Language != "" && opts.Language != "auto" {
+		form.WriteField("language", opts.Language)
+	}
+	if opts.Temperature > 0 {
+		form.WriteField("temperature", strconv.FormatFloat(float64(opts.Temperature), 'f', -1, 32))
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, t.endpoint, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	start := time.Now()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcription response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("transcription server returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var out transcriptionResponse
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse transcription response: %w", err)
+	}
+	log.Debug().
+		Dur("process_time", time.Since(start)).
+		Float64("duration_sec", float64(len(samples))/16000).
+		Msg("Transcription server responded")
+
+	if len(out.Segments) == 0 {
+		if strings.TrimSpace(out.Text) == "" {
+			return nil, nil
+		}
+		return []Segment{{Text: out.Text, End: time.Duration(len(samples)) * time.Second / 16000}}, nil
+	}
+
+	segments := make([]Segment, 0, len(out.Segments))
+	for _, s := range out.Segments {
+		segments = append(segments, Segment{
+			Text:         s.Text,
+			Start:        time.Duration(s.Start * float64(time.Second)),
+			End:          time.Duration(s.End * float64(time.Second)),
+			AvgLogProb:   s.AvgLogProb,
+			NoSpeechProb: s.NoSpeechProb,
+		})
+	}
+	return segments, nil
+}
@@ -0,0 +1,239 @@
+package whisper
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/petems/whisper-tray/internal/config"
+)
+
+func newTestHTTPTranscriber(t *testing.T, url string, fallback bool) *httpTranscriber {
+	t.Helper()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.WhisperConfig{
+		Model: "base.en",
+		HTTP: config.HTTPConfig{
+			BaseURL:   url + "/v1/",
+			Model:     "whisper-1",
+			TokenFile: tokenFile,
+			Fallback:  fallback,
+		},
+	}
+	tr, err := newHTTPTranscriber(cfg, NewRegistry(nil, t.TempDir()))
+	if err != nil {
+		t.Fatalf("newHTTPTranscriber returned error: %v", err)
+	}
+	t.Cleanup(func() { tr.Close() })
+	return tr
+}
+
+// runSession feeds samples through a session and returns its finals
+func runSession(t *testing.T, tr Transcriber, opts SessionOpts, samples []float32) ([]Segment, error) {
+	t.Helper()
+
+	session, err := tr.StartSession(opts)
+	if err != nil {
+		t.Fatalf("StartSession returned error: %v", err)
+	}
+	session.Feed(samples)
+
+	finals := make(chan []Segment, 1)
+	go func() {
+		var got []Segment
+		for seg := range session.Finals() {
+			got = append(got, seg)
+		}
+		finals <- got
+	}()
+	err = session.Close()
+	return <-finals, err
+}
+
+func TestHTTPTranscriberSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/audio/transcriptions" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("expected bearer token from file, got %q", got)
+		}
+		if got := r.FormValue("model"); got != "whisper-1" {
+			t.Errorf("expected model whisper-1, got %q", got)
+		}
+		if got := r.FormValue("language"); got != "de" {
+			t.Errorf("expected language de, got %q", got)
+		}
+		if got := r.FormValue("response_format"); got != "verbose_json" {
+			t.Errorf("expected verbose_json, got %q", got)
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("expected an audio file: %v", err)
+		} else {
+			data, _ := io.ReadAll(file)
+			if len(data) != 32044 || string(data[:4]) != "RIFF" {
+				t.Errorf("expected a 16000-sample WAV, got %d bytes", len(data))
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"text": " Hallo Welt.", "segments": [
+			{"start": 0.0, "end": 1.5, "text": " Hallo Welt.", "avg_logprob": -0.25, "no_speech_prob": 0.01}
+		]}`)
+	}))
+	defer server.Close()
+
+	tr := newTestHTTPTranscriber(t, server.URL, false)
+
+	got, err := runSession(t, tr, SessionOpts{Language: "de"}, make([]float32, 16000))
+	if err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if len(got) != 1 || got[0].Text != " Hallo Welt." {
+		t.Fatalf("unexpected segments %+v", got)
+	}
+	if got[0].End != 1500*time.Millisecond || got[0].AvgLogProb != -0.25 || got[0].NoSpeechProb != 0.01 {
+		t.Fatalf("expected timings and probabilities from verbose_json, got %+v", got[0])
+	}
+}
+
+func TestHTTPTranscriberPlainTextResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("expected a multipart form: %v", err)
+		} else if _, ok := r.MultipartForm.Value["language"]; ok {
+			t.Error("expected no language field for auto-detect")
+		}
+		io.WriteString(w, `{"text": "Hello."}`)
+	}))
+	defer server.Close()
+
+	tr := newTestHTTPTranscriber(t, server.URL, false)
+
+	got, err := runSession(t, tr, SessionOpts{Language: "auto"}, make([]float32, 8000))
+	if err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if len(got) != 1 || got[0].Text != "Hello." || got[0].End != 500*time.Millisecond {
+		t.Fatalf("expected one segment spanning the audio, got %+v", got)
+	}
+}
+
+func TestHTTPTranscriberReportsServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tr := newTestHTTPTranscriber(t, server.URL, false)
+
+	_, err := runSession(t, tr, SessionOpts{}, make([]float32, 16000))
+	if err == nil || !strings.Contains(err.Error(), "503") || !strings.Contains(err.Error(), "model not loaded") {
+		t.Fatalf("expected the server's status and message, got %v", err)
+	}
+}
+
+func TestHTTPTranscriberFallsBackToLocalModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	local := newFakeModel()
+	local.text = "decoded locally"
+	var opened []string
+
+	tr := newTestHTTPTranscriber(t, server.URL, true)
+	tr.local = &whisperTranscriber{
+		open: func(_ *Registry, name string, _ ProgressFunc) (*modelHandle, error) {
+			opened = append(opened, name)
+			return newModelHandle(name, name+".bin", local), nil
+		},
+	}
+
+	got, err := runSession(t, tr, SessionOpts{}, make([]float32, 16000))
+	if err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if len(got) != 1 || got[0].Text != "decoded locally" {
+		t.Fatalf("expected the local model's output, got %+v", got)
+	}
+	if len(opened) != 1 || opened[0] != "base.en" {
+		t.Fatalf("expected fallback to open whisper.model, got %v", opened)
+	}
+}
+
+func TestHTTPTokenOnlySentSecurely(t *testing.T) {
+	t.Setenv("WHISPER_TRAY_HTTP_TOKEN", "secret")
+	tests := []struct {
+		url  string
+		safe bool
+	}{
+		{"https://api.openai.com/v1", true},
+		{"http://127.0.0.1:8000/v1", true},
+		{"http://localhost:8000/v1", true},
+		{"http://[::1]:8000/v1", true},
+		{"http://gpu-box:8000/v1", false},
+		{"http://192.168.1.20:8000/v1", false},
+	}
+	for _, tt := range tests {
+		cfg := config.WhisperConfig{HTTP: config.HTTPConfig{BaseURL: tt.url, TokenEnv: "WHISPER_TRAY_HTTP_TOKEN"}}
+		tr, err := newHTTPTranscriber(cfg, NewRegistry(nil, t.TempDir()))
+		if tt.safe {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.url, err)
+				continue
+			}
+			tr.Close()
+		} else if err == nil {
+			tr.Close()
+			t.Errorf("%s: expected the token refused over plain HTTP", tt.url)
+		}
+	}
+
+	// Without a token any server will do
+	cfg := config.WhisperConfig{HTTP: config.HTTPConfig{BaseURL: "http://gpu-box:8000/v1", TokenEnv: "UNSET_TOKEN_FOR_TEST"}}
+	tr, err := newHTTPTranscriber(cfg, NewRegistry(nil, t.TempDir()))
+	if err != nil {
+		t.Fatalf("unexpected error without a token: %v", err)
+	}
+	tr.Close()
+}
+
+func TestHTTPBackendDisabledOffline(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("APPDATA", filepath.Join(home, "AppData"))
+
+	rt := &refusingTransport{}
+	withTransport(t, rt)
+
+	tr, err := NewLazy(config.WhisperConfig{
+		Backend: "http",
+		Model:   "base.en",
+		Offline: true,
+		HTTP:    config.HTTPConfig{BaseURL: "http://127.0.0.1:1/v1"},
+	})
+	if err != nil {
+		t.Fatalf("NewLazy returned error: %v", err)
+	}
+	defer tr.Close()
+
+	if _, ok := tr.(*whisperTranscriber); !ok {
+		t.Fatalf("expected offline mode to use the local backend, got %T", tr)
+	}
+	if n := rt.calls.Load(); n != 0 {
+		t.Fatalf("expected no network requests in offline mode, got %d", n)
+	}
+}
@@ -0,0 +1,129 @@
+package whisper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Pull downloads a registered model into the models directory, replacing a
+// copy that fails verification. progress may be nil.
+func (r *Registry) Pull(ctx context.Context, name string, progress ProgressFunc) error {
+	info, ok := r.Lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown model: %s", name)
+	}
+	if info.IsLocal() {
+		return fmt.Errorf("model %s is a local file and can't be downloaded", name)
+	}
+
+	path := r.LocalPath(info)
+	if _, err := os.Stat(path); err == nil {
+		if err := verifyModel(path, info.entry(), false); err == nil {
+			return nil
+		}
+		os.Remove(path)
+		os.Remove(recordPath(path))
+	}
+	return downloadModel(ctx, r, info, path, progress)
+}
+
+// Remove deletes a downloaded or imported model along with its verification
+// record and any partial download. Files registered by path are left alone.
+func (r *Registry) Remove(name string) error {
+	info, ok := r.Lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown model: %s", name)
+	}
+	path := r.LocalPath(info)
+	if filepath.Dir(path) != filepath.Clean(r.dir) {
+		return fmt.Errorf("model %s lives outside the models directory (%s); remove it yourself", name, path)
+	}
+
+	removed := false
+	for _, p := range []string{path, recordPath(path), path + ".tmp"} {
+		err := os.Remove(p)
+		if err == nil {
+			removed = true
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", p, err)
+		}
+	}
+	if !removed {
+		return fmt.Errorf("model %s is not downloaded", name)
+	}
+	return nil
+}
+
+// Verify re-hashes a model on disk and checks it against the registry hash,
+// or the digest recorded when it was downloaded if the registry has none.
+func (r *Registry) Verify(name string) error {
+	info, ok := r.Lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown model: %s", name)
+	}
+	return verifyModel(r.LocalPath(info), info.entry(), true)
+}
+
+// Import copies a model file into the models directory under name, for
+// machines that can't download. If name is registered with a hash the copy
+// must match it.
+func (r *Registry) Import(name string, src string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid model name %q", name)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	stat, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create models directory: %w", err)
+	}
+	if err := checkDiskSpace(r.dir, stat.Size()); err != nil {
+		return err
+	}
+
+	dest := filepath.Join(r.dir, name+".bin")
+	tmpPath := dest + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to copy model: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	entry := manifestEntry{}
+	if info, ok := r.find(name); ok {
+		entry = info.entry()
+	}
+	os.Remove(recordPath(dest))
+	if err := verifyModel(tmpPath, entry, true); err != nil {
+		os.Remove(tmpPath)
+		os.Remove(recordPath(tmpPath))
+		return err
+	}
+
+	if err := os.Rename(tmpPath, dest); err != nil {
+		return fmt.Errorf("failed to move model file: %w", err)
+	}
+	os.Rename(recordPath(tmpPath), recordPath(dest))
+	return nil
+}
@@ -0,0 +1,101 @@
+package whisper
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistryPullFromMirror(t *testing.T) {
+	blob := fakeBlob()
+	srv := httptest.NewServer(&fakeModelServer{blob: blob})
+	defer srv.Close()
+
+	dir := t.TempDir()
+	reg := NewRegistry([]string{srv.URL}, dir)
+	if err := reg.Add(ModelInfo{Name: "fake", File: "ggml-fake.bin", Hash: sha256Of(blob)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var lastDownloaded, lastTotal int64
+	err := reg.Pull(context.Background(), "fake", func(downloaded, total int64) {
+		lastDownloaded, lastTotal = downloaded, total
+	})
+	if err != nil {
+		t.Fatalf("Pull returned error: %v", err)
+	}
+	if lastTotal != int64(len(blob)) || lastDownloaded != lastTotal {
+		t.Fatalf("expected final progress %d/%d, got %d/%d", len(blob), len(blob), lastDownloaded, lastTotal)
+	}
+
+	info, _ := reg.Lookup("fake")
+	if !reg.IsDownloaded(info) {
+		t.Fatal("expected model to be downloaded")
+	}
+	if err := reg.Verify("fake"); err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+}
+
+func TestRegistryImportAndRemove(t *testing.T) {
+	blob := fakeBlob()
+	src := filepath.Join(t.TempDir(), "ggml-custom.bin")
+	if err := os.WriteFile(src, blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	reg := NewRegistry(nil, dir)
+	if err := reg.Import("custom", src); err != nil {
+		t.Fatalf("Import returned error: %v", err)
+	}
+
+	info, ok := reg.Lookup("custom")
+	if !ok {
+		t.Fatal("expected imported model to resolve")
+	}
+	got, err := os.ReadFile(reg.LocalPath(info))
+	if err != nil || !bytes.Equal(got, blob) {
+		t.Fatalf("imported file does not match source (err=%v)", err)
+	}
+	if imported := reg.Imported(); len(imported) != 1 || imported[0].Name != "custom" {
+		t.Fatalf("expected custom in imported list, got %+v", imported)
+	}
+
+	// Corrupting the copy must be caught by a full verify
+	if err := os.WriteFile(reg.LocalPath(info), append(blob[:len(blob)-1], 'x'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Verify("custom"); err == nil {
+		t.Fatal("expected corrupted import to fail verification")
+	}
+
+	if err := reg.Remove("custom"); err != nil {
+		t.Fatalf("Remove returned error: %v", err)
+	}
+	if _, ok := reg.Lookup("custom"); ok {
+		t.Fatal("expected removed model to be gone")
+	}
+	if _, err := os.Stat(recordPath(filepath.Join(dir, "custom.bin"))); !os.IsNotExist(err) {
+		t.Fatal("expected verification record to be removed")
+	}
+}
+
+func TestRegistryImportChecksRegisteredHash(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "ggml-base.en.bin")
+	if err := os.WriteFile(src, []byte("not the real base.en"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	reg := NewRegistry(nil, dir)
+	if err := reg.Import("base.en", src); err == nil {
+		t.Fatal("expected import of a mismatching base.en to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "base.en.bin")); !os.IsNotExist(err) {
+		t.Fatal("expected rejected import to leave nothing behind")
+	}
+}
@@ -0,0 +1,139 @@
+package whisper
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// manifestEntry describes where to fetch a model and how to check it
+type manifestEntry struct {
+	URL string
+	// Size is the expected file size in bytes; 0 when not pinned, in which
+	// case the size reported by the server at download time is used.
+	Size int64
+	// Hash is "<algo>:<hex>" with algo sha1 or sha256; empty when unknown.
+	Hash string
+}
+
+// modelRecord is written next to a model once it has been verified, so later
+// startups can detect truncation with a stat instead of re-hashing gigabytes.
+type modelRecord struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash"`
+}
+
+func recordPath(modelPath string) string {
+	return modelPath + ".verified"
+}
+
+func readRecord(modelPath string) (*modelRecord, error) {
+	data, err := os.ReadFile(recordPath(modelPath))
+	if err != nil {
+		return nil, err
+	}
+	var rec modelRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func writeRecord(modelPath string, hash string) error {
+	info, err := os.Stat(modelPath)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(modelRecord{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hash:    hash,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(recordPath(modelPath), data, 0644)
+}
+
+// verifyModel checks a model file on disk against its manifest entry and the
+// record written after its last successful verification. Unless full is set,
+// the hash is only computed when nothing has vouched for the file yet.
+func verifyModel(modelPath string, entry manifestEntry, full bool) error {
+	info, err := os.Stat(modelPath)
+	if err != nil {
+		return err
+	}
+
+	if entry.Size > 0 && info.Size() != entry.Size {
+		return fmt.Errorf("model file %s is %d bytes, expected %d (truncated or corrupt)", modelPath, info.Size(), entry.Size)
+	}
+
+	rec, err := readRecord(modelPath)
+	if err == nil && (entry.Hash == "" || strings.EqualFold(rec.Hash, entry.Hash)) {
+		if info.Size() != rec.Size {
+			return fmt.Errorf("model file %s is %d bytes, expected %d (truncated or corrupt)", modelPath, info.Size(), rec.Size)
+		}
+		if !full && info.ModTime().Equal(rec.ModTime) {
+			return nil
+		}
+	}
+
+	log.Info().Str("path", modelPath).Msg("Verifying model checksum")
+	algo := "sha256"
+	if entry.Hash != "" {
+		algo, _, _ = strings.Cut(entry.Hash, ":")
+	}
+	sum, err := hashFile(modelPath, algo)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case entry.Hash != "" && !strings.EqualFold(sum, entry.Hash):
+		return fmt.Errorf("model file %s has checksum %s, expected %s", modelPath, sum, entry.Hash)
+	case entry.Hash == "" && rec != nil && rec.Size == info.Size() && !strings.EqualFold(sum, rec.Hash):
+		return fmt.Errorf("model file %s has checksum %s, expected %s from last download", modelPath, sum, rec.Hash)
+	}
+
+	return writeRecord(modelPath, sum)
+}
+
+// hashFile returns "<algo>:<hex>" for the file at path
+func hashFile(path string, algo string) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return algo + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func newHash(algo string) (hash.Hash, error) {
+	switch strings.ToLower(algo) {
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %q", algo)
+	}
+}
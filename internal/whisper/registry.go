@@ -0,0 +1,229 @@
+package whisper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/petems/whisper-tray/internal/config"
+)
+
+const huggingFaceBase = "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/"
+
+// ModelInfo describes a model the app can download or load
+type ModelInfo struct {
+	Name string `json:"name"`
+	// File is the file name under each mirror base URL (e.g. "ggml-base.en.bin")
+	File string `json:"file,omitempty"`
+	// URL downloads the model from a fixed location, bypassing mirrors
+	URL string `json:"url,omitempty"`
+	// Path points at a local .bin file that is loaded in place and never downloaded
+	Path string `json:"path,omitempty"`
+	// Hash is "<algo>:<hex>" with algo sha1 or sha256; empty when unknown
+	Hash string `json:"hash,omitempty"`
+	// Size is the expected file size in bytes; 0 when not pinned
+	Size         int64  `json:"size,omitempty"`
+	Multilingual bool   `json:"multilingual"`
+	Quantization string `json:"quantization,omitempty"` // "", "q5_0", "q5_1", "q8_0"
+}
+
+// IsLocal reports whether the model is a user-supplied file rather than a download
+func (m ModelInfo) IsLocal() bool {
+	return m.Path != ""
+}
+
+// builtinModels are always available. Only the full-precision tiny through
+// large-v3 models pin a hash and size: the SHA-1 sums and byte counts
+// published alongside the whisper.cpp models. large-v3-turbo, the quantized
+// variants and distil-large-v3 pin neither, so nothing checks their first
+// download; later loads only check the file against the digest recorded
+// then. Pin them in models.json to verify them properly.
+var builtinModels = []ModelInfo{
+	{Name: "tiny.en", File: "ggml-tiny.en.bin", Hash: "sha1:c78c86eb1a8faa21b369bcd33207cc90d64ae9df", Size: 77704715},
+	{Name: "tiny", File: "ggml-tiny.bin", Hash: "sha1:bd577a113a864445d4c299885e0cb97d4ba92b5f", Size: 77691713, Multilingual: true},
+	{Name: "base.en", File: "ggml-base.en.bin", Hash: "sha1:137c40403d78fd54d454da0f9bd998f78703390c", Size: 147964211},
+	{Name: "base", File: "ggml-base.bin", Hash: "sha1:465707469ff3a37a2b9b8d8f89f2f99de7299dac", Size: 147951465, Multilingual: true},
+	{Name: "small.en", File: "ggml-small.en.bin", Hash: "sha1:db8a495a91d927739e50b3fc1cc4c6b8f6c2d022", Size: 487614201},
+	{Name: "small", File: "ggml-small.bin", Hash: "sha1:55356645c2b361a969dfd0ef2c5a50d530afd8d5", Size: 487601967, Multilingual: true},
+	{Name: "medium.en", File: "ggml-medium.en.bin", Hash: "sha1:8c30f0e44ce9560643ebd10bbe50cd20eafd3723", Size: 1533774781},
+	{Name: "medium", File: "ggml-medium.bin", Hash: "sha1:fd9727b6e1217c2f614f9b698455c4ffd82463b4", Size: 1533763059, Multilingual: true},
+	{Name: "large-v3", File: "ggml-large-v3.bin", Hash: "sha1:ad82bf6a9043ceed055076d0fd39f5f186ff8062", Size: 3095033483, Multilingual: true},
+	{Name: "large-v3-turbo", File: "ggml-large-v3-turbo.bin", Multilingual: true},
+
+	// Quantized variants trade a little accuracy for much less memory
+	{Name: "base.en-q5_1", File: "ggml-base.en-q5_1.bin", Quantization: "q5_1"},
+	{Name: "small.en-q5_1", File: "ggml-small.en-q5_1.bin", Quantization: "q5_1"},
+	{Name: "small-q8_0", File: "ggml-small-q8_0.bin", Quantization: "q8_0", Multilingual: true},
+	{Name: "medium.en-q5_0", File: "ggml-medium.en-q5_0.bin", Quantization: "q5_0"},
+	{Name: "medium-q8_0", File: "ggml-medium-q8_0.bin", Quantization: "q8_0", Multilingual: true},
+	{Name: "large-v3-q5_0", File: "ggml-large-v3-q5_0.bin", Quantization: "q5_0", Multilingual: true},
+	{Name: "large-v3-turbo-q5_0", File: "ggml-large-v3-turbo-q5_0.bin", Quantization: "q5_0", Multilingual: true},
+	{Name: "large-v3-turbo-q8_0", File: "ggml-large-v3-turbo-q8_0.bin", Quantization: "q8_0", Multilingual: true},
+
+	// Distilled models live outside the whisper.cpp repository
+	{Name: "distil-large-v3", URL: "https://huggingface.co/distil-whisper/distil-large-v3-ggml/resolve/main/ggml-distil-large-v3.bin"},
+}
+
+// Registry is the set of known models: the built-ins plus anything added or
+// overridden in the user's models.json.
+type Registry struct {
+	models  []ModelInfo
+	mirrors []string
+	dir     string
+	// offline forbids downloads; models must already be on disk
+	offline bool
+}
+
+// registryFile is the on-disk format of the user registry
+type registryFile struct {
+	Models []ModelInfo `json:"models"`
+}
+
+// LoadRegistry builds the registry from built-in defaults, the user registry
+// file and the configured mirrors.
+func LoadRegistry(cfg config.WhisperConfig) (*Registry, error) {
+	r := NewRegistry(cfg.Mirrors, config.ModelsPath())
+	r.offline = cfg.Offline
+
+	data, err := os.ReadFile(config.RegistryPath())
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model registry: %w", err)
+	}
+
+	var file registryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse model registry %s: %w", config.RegistryPath(), err)
+	}
+	for _, m := range file.Models {
+		if err := r.Add(m); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// NewRegistry returns a registry holding only the built-in models
+func NewRegistry(mirrors []string, modelsDir string) *Registry {
+	r := &Registry{
+		models:  append([]ModelInfo(nil), builtinModels...),
+		mirrors: mirrors,
+		dir:     modelsDir,
+	}
+	return r
+}
+
+// Add registers a model, replacing any existing entry with the same name
+func (r *Registry) Add(m ModelInfo) error {
+	if m.Name == "" {
+		return fmt.Errorf("model registry entry is missing a name")
+	}
+	if m.File == "" && m.URL == "" && m.Path == "" {
+		return fmt.Errorf("model %q needs a file, url or path", m.Name)
+	}
+	for i := range r.models {
+		if r.models[i].Name == m.Name {
+			r.models[i] = m
+			return nil
+		}
+	}
+	r.models = append(r.models, m)
+	return nil
+}
+
+// Models returns every known model in registry order
+func (r *Registry) Models() []ModelInfo {
+	return append([]ModelInfo(nil), r.models...)
+}
+
+// Lookup finds a model by name. A name ending in .bin that isn't registered
+// is treated as a path to a local model file, and any other unregistered
+// name resolves to a file imported into the models directory.
+func (r *Registry) Lookup(name string) (ModelInfo, bool) {
+	if m, ok := r.find(name); ok {
+		return m, true
+	}
+	if strings.HasSuffix(name, ".bin") {
+		return ModelInfo{Name: name, Path: name, Multilingual: true}, true
+	}
+	// Models imported into the models directory under a name of their own
+	path := filepath.Join(r.dir, name+".bin")
+	if _, err := os.Stat(path); err == nil {
+		return ModelInfo{Name: name, Path: path, Multilingual: true}, true
+	}
+	return ModelInfo{}, false
+}
+
+// Imported lists model files in the models directory that aren't registered
+func (r *Registry) Imported() []ModelInfo {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return nil
+	}
+
+	var imported []ModelInfo
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".bin")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if _, registered := r.find(name); registered {
+			continue
+		}
+		imported = append(imported, ModelInfo{
+			Name:         name,
+			Path:         filepath.Join(r.dir, e.Name()),
+			Multilingual: true,
+		})
+	}
+	return imported
+}
+
+func (r *Registry) find(name string) (ModelInfo, bool) {
+	for _, m := range r.models {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return ModelInfo{}, false
+}
+
+// LocalPath is where the model lives (or will live once downloaded)
+func (r *Registry) LocalPath(m ModelInfo) string {
+	if m.IsLocal() {
+		return m.Path
+	}
+	return filepath.Join(r.dir, m.Name+".bin")
+}
+
+// IsDownloaded reports whether the model file is present on disk
+func (r *Registry) IsDownloaded(m ModelInfo) bool {
+	_, err := os.Stat(r.LocalPath(m))
+	return err == nil
+}
+
+// DownloadURLs lists where a model can be fetched from, in the order to try
+// them: an explicit URL, else each configured mirror then Hugging Face.
+func (r *Registry) DownloadURLs(m ModelInfo) []string {
+	if m.IsLocal() {
+		return nil
+	}
+	if m.URL != "" {
+		return []string{m.URL}
+	}
+
+	urls := make([]string, 0, len(r.mirrors)+1)
+	for _, base := range r.mirrors {
+		urls = append(urls, strings.TrimSuffix(base, "/")+"/"+m.File)
+	}
+	return append(urls, huggingFaceBase+m.File)
+}
+
+// entry is the download and verification description of a model
+func (m ModelInfo) entry() manifestEntry {
+	return manifestEntry{Size: m.Size, Hash: m.Hash}
+}
@@ -0,0 +1,105 @@
+package whisper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/petems/whisper-tray/internal/config"
+)
+
+func TestLoadRegistryMergesUserFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("APPDATA", filepath.Join(home, "AppData"))
+
+	path := config.RegistryPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	registry := `{"models": [
+		{"name": "base.en", "url": "https://models.example.com/base.en.bin", "hash": "sha256:abc"},
+		{"name": "my-finetune", "path": "/opt/models/finetune.bin", "multilingual": true}
+	]}`
+	if err := os.WriteFile(path, []byte(registry), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := LoadRegistry(config.WhisperConfig{})
+	if err != nil {
+		t.Fatalf("LoadRegistry returned error: %v", err)
+	}
+
+	base, ok := reg.Lookup("base.en")
+	if !ok || base.URL != "https://models.example.com/base.en.bin" || base.Hash != "sha256:abc" {
+		t.Fatalf("expected user entry to override base.en, got %+v", base)
+	}
+	if got := len(reg.Models()); got != len(builtinModels)+1 {
+		t.Fatalf("expected %d models, got %d", len(builtinModels)+1, got)
+	}
+
+	custom, ok := reg.Lookup("my-finetune")
+	if !ok || !custom.IsLocal() || reg.LocalPath(custom) != "/opt/models/finetune.bin" {
+		t.Fatalf("expected local custom model, got %+v", custom)
+	}
+	if urls := reg.DownloadURLs(custom); len(urls) != 0 {
+		t.Fatalf("local models must not be downloaded, got %v", urls)
+	}
+}
+
+func TestLoadRegistryRejectsIncompleteEntries(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("APPDATA", filepath.Join(home, "AppData"))
+
+	path := config.RegistryPath()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte(`{"models": [{"name": "nowhere"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadRegistry(config.WhisperConfig{}); err == nil {
+		t.Fatal("expected error for an entry with no file, url or path")
+	}
+}
+
+func TestRegistryDownloadURLsUsesMirrors(t *testing.T) {
+	reg := NewRegistry([]string{"https://mirror.internal/whisper/", "https://backup.internal"}, t.TempDir())
+
+	info, ok := reg.Lookup("small.en-q5_1")
+	if !ok {
+		t.Fatal("expected quantized built-in model")
+	}
+	if info.Quantization != "q5_1" {
+		t.Fatalf("expected q5_1 quantization, got %q", info.Quantization)
+	}
+
+	want := []string{
+		"https://mirror.internal/whisper/ggml-small.en-q5_1.bin",
+		"https://backup.internal/ggml-small.en-q5_1.bin",
+		huggingFaceBase + "ggml-small.en-q5_1.bin",
+	}
+	got := reg.DownloadURLs(info)
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("url %d: expected %s, got %s", i, want[i], got[i])
+		}
+	}
+}
+
+func TestRegistryLookupLocalPath(t *testing.T) {
+	reg := NewRegistry(nil, t.TempDir())
+
+	info, ok := reg.Lookup("/data/ggml-custom.bin")
+	if !ok || !info.IsLocal() || reg.LocalPath(info) != "/data/ggml-custom.bin" {
+		t.Fatalf("expected .bin path to resolve to a local model, got %+v", info)
+	}
+	if _, ok := reg.Lookup("no-such-model"); ok {
+		t.Fatal("expected unknown model lookup to fail")
+	}
+}
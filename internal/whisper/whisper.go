@@ -1,9 +1,11 @@
 package whisper
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,18 +18,62 @@ import (
 // Transcriber interface for speech-to-text
 type Transcriber interface {
 	StartSession(opts SessionOpts) (Session, error)
-	LoadModel(model string) error
+	LoadModel(model string, progress ProgressFunc) error
+	// LoadPartialModel loads a second, faster model that decodes live
+	// partials while recording; the main model then decodes the whole
+	// utterance once on release. "" turns two-pass transcription off.
+	LoadPartialModel(model string, progress ProgressFunc) error
+	// LoadWakeModel keeps a small model loaded for Transcribe to listen for
+	// the wake phrase with, so each burst of speech doesn't load one. ""
+	// frees it.
+	LoadWakeModel(model string, progress ProgressFunc) error
+	// Transcribe decodes a complete recording with the named model, loading
+	// it if it isn't already. A model other than the main or partials one
+	// stays loaded for the next call until the transcriber goes idle.
+	Transcribe(model string, samples []float32, opts SessionOpts, progress ProgressFunc) ([]Segment, error)
 	Close() error
 }
 
+// ProgressFunc reports download progress while a model is fetched; total is
+// 0 when the size is unknown
+type ProgressFunc func(downloaded, total int64)
+
 // Session represents an active transcription session
 type Session interface {
 	Feed(samples []float32) error
 	Partials() <-chan string
-	Finals() <-chan string
+	Finals() <-chan Segment
 	Close() error
 }
 
+// Segment is a finalized piece of transcript along with the decoder's
+// confidence signals, which downstream filters use to drop hallucinations.
+type Segment struct {
+	Text  string
+	Start time.Duration
+	End   time.Duration
+
+	// AvgLogProb is the mean log-probability of the segment's text tokens.
+	// Zero means the backend did not report it.
+	AvgLogProb float64
+	// NoSpeechProb is the probability that the segment contains no speech.
+	// Zero means the backend did not report it; see ReportsNoSpeechProb.
+	NoSpeechProb float64
+}
+
+// Remote reports whether cfg sends audio to a transcription server rather
+// than decoding it on this machine
+func Remote(cfg config.WhisperConfig) bool {
+	return cfg.Backend == "http" && !cfg.Offline
+}
+
+// ReportsNoSpeechProb reports whether the backend cfg selects fills in
+// Segment.NoSpeechProb. Only the http backend does: the vendored whisper.cpp
+// exposes it neither to the bindings nor in the CLI's JSON.
+func ReportsNoSpeechProb(cfg config.WhisperConfig) bool {
+	return Remote(cfg)
+}
+
 // SessionOpts configures a transcription session
 type SessionOpts struct {
 	Language    string
@@ -38,20 +84,114 @@ type SessionOpts struct {
 }
 
 type whisperTranscriber struct {
-	model     whisper.Model
-	modelPath string
-	mu        sync.Mutex
+	registry *Registry
+	// open loads a model by name; replaced in tests
+	open func(registry *Registry, name string, progress ProgressFunc) (*modelHandle, error)
+
+	idleTimeout time.Duration
+	warmup      bool
+	threads     int
+
+	mu       sync.Mutex
+	model    string       // selected model, remembered while unloaded
+	current  *modelHandle // nil while unloaded
+	partial  *modelHandle // two-pass partials model; small, so never idle-unloaded
+	wake     *modelHandle // wake phrase model; small too
+	oneOff   *modelHandle // last model Transcribe loaded besides these, kept until idle
+	loading  *pendingLoad // in-flight reload of model, if any
+	active   int          // open sessions and other decodes in flight
+	lastUsed time.Time
+	idle     *time.Timer
+	closed   bool
 }
 
-// New creates a new Whisper transcriber
+// pendingLoad is the model a session decodes with. Sessions started while
+// the model is unloaded share one that resolves when the reload finishes.
+type pendingLoad struct {
+	name    string
+	done    chan struct{}
+	waiters int // sessions owed a reference once loaded; guarded by the transcriber lock
+	handle  *modelHandle
+	err     error
+}
+
+// loadedHandle wraps a handle that is already available
+func loadedHandle(h *modelHandle) *pendingLoad {
+	p := &pendingLoad{name: h.name, done: make(chan struct{}), handle: h}
+	close(p.done)
+	return p
+}
+
+func (p *pendingLoad) wait() (*modelHandle, error) {
+	<-p.done
+	return p.handle, p.err
+}
+
+// warmupSamples is one second of silence decoded after a load so the
+// first real dictation doesn't pay for whisper.cpp's lazy initialization
+const warmupSamples = 16000
+
+// New creates a new Whisper transcriber, downloading and loading its model
+// before returning
 func New(cfg config.WhisperConfig) (Transcriber, error) {
-	modelPath := filepath.Join(config.ModelsPath(), cfg.Model+".bin")
+	t, err := NewLazy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.LoadModel(cfg.Model, nil); err != nil {
+		return nil, err
+	}
+	if err := t.LoadPartialModel(cfg.PartialModel, nil); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
 
-	// Check if model exists, download if needed
-	if _, err := os.Stat(modelPath); os.IsNotExist(err) {
-		if err := downloadModel(cfg.Model, modelPath); err != nil {
-			return nil, fmt.Errorf("failed to download model: %w", err)
+// NewLazy creates a transcriber without loading a model, so callers can show
+// UI straight away. LoadModel loads it; a session started first loads it too.
+func NewLazy(cfg config.WhisperConfig) (Transcriber, error) {
+	registry, err := LoadRegistry(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	info, _ := registry.Lookup(cfg.Model)
+	if !info.Multilingual && cfg.Language != "" && cfg.Language != "auto" && cfg.Language != "en" {
+		log.Warn().
+			Str("model", cfg.Model).
+			Str("language", cfg.Language).
+			Msg("Model is English-only; pick a multilingual model for this language")
+	}
+
+	switch cfg.Backend {
+	case "", "bindings":
+	case "cli":
+		return newCLITranscriber(cfg, registry)
+	case "http":
+		if !cfg.Offline {
+			return newHTTPTranscriber(cfg, registry)
 		}
+		log.Warn().Msg("Offline mode: ignoring the http backend and transcribing locally")
+	default:
+		return nil, fmt.Errorf("unknown whisper backend %q", cfg.Backend)
+	}
+
+	return &whisperTranscriber{
+		registry:    registry,
+		open:        openModel,
+		idleTimeout: time.Duration(cfg.IdleUnloadMinutes) * time.Minute,
+		warmup:      cfg.Warmup,
+		threads:     cfg.Threads,
+		model:       cfg.Model,
+	}, nil
+}
+
+// openModel downloads the named model if needed and loads it. progress may be nil.
+func openModel(registry *Registry, name string, progress ProgressFunc) (*modelHandle, error) {
+	modelPath, err := ensureModel(registry, name, progress)
+	if err != nil {
+		return nil, err
 	}
 
 	// Load model using official bindings
@@ -60,96 +200,530 @@ func New(cfg config.WhisperConfig) (Transcriber, error) {
 		return nil, fmt.Errorf("failed to load model: %w", err)
 	}
 
-	return &whisperTranscriber{
-		model:     model,
-		modelPath: modelPath,
-	}, nil
+	return newModelHandle(name, modelPath, model), nil
+}
+
+// ensureModel makes sure a verified copy of the named model is on disk,
+// downloading it if needed, and returns its path
+func ensureModel(registry *Registry, name string, progress ProgressFunc) (string, error) {
+	info, ok := registry.Lookup(name)
+	if !ok {
+		return "", fmt.Errorf("unknown model: %s", name)
+	}
+	modelPath := registry.LocalPath(info)
+
+	// Catch truncated or corrupt files before handing them to whisper.cpp.
+	// Local files are only checked when the registry pins a hash for them.
+	if _, err := os.Stat(modelPath); err == nil && (!info.IsLocal() || info.Hash != "") {
+		if err := verifyModel(modelPath, info.entry(), false); err != nil {
+			if info.IsLocal() {
+				return "", err
+			}
+			log.Warn().Err(err).Str("model", name).Msg("Model failed verification, downloading again")
+			os.Remove(modelPath)
+			os.Remove(recordPath(modelPath))
+		}
+	}
+
+	// Check if model exists, download if needed
+	if _, err := os.Stat(modelPath); os.IsNotExist(err) {
+		if info.IsLocal() {
+			return "", fmt.Errorf("model file not found: %s", modelPath)
+		}
+		if err := downloadModel(context.Background(), registry, info, modelPath, progress); err != nil {
+			if errors.Is(err, ErrOffline) {
+				return "", err
+			}
+			return "", fmt.Errorf("failed to download model: %w", err)
+		}
+	}
+
+	return modelPath, nil
 }
 
 func (w *whisperTranscriber) StartSession(opts SessionOpts) (Session, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if w.closed {
+		return nil, fmt.Errorf("transcriber is closed")
+	}
+
+	// An unloaded model is reloaded in the background; the session buffers
+	// audio until it's ready so capture can start right away
+	var load *pendingLoad
+	if w.current != nil {
+		load = loadedHandle(w.current.acquire())
+	} else {
+		load = w.reloadLocked()
+		load.waiters++
+	}
+
+	var partial *modelHandle
+	if w.partial != nil {
+		partial = w.partial.acquire()
+	}
+
+	w.beginUseLocked()
+
 	session := &whisperSession{
-		transcriber: w,
-		opts:        opts,
-		partials:    make(chan string, 10),
-		finals:      make(chan string, 10),
-		samples:     make([]float32, 0, 16000*30), // 30 second buffer
-		done:        make(chan struct{}),
+		load:     load,
+		partial:  partial,
+		opts:     opts,
+		onClose:  w.endUse,
+		partials: make(chan string, 10),
+		finals:   make(chan Segment, 10),
+		samples:  make([]float32, 0, 16000*30), // 30 second buffer
 	}
 
 	return session, nil
 }
 
-func (w *whisperTranscriber) LoadModel(model string) error {
+// LoadModel loads (downloading if needed) a model and makes it current for
+// new sessions, reporting download progress to progress if it isn't nil.
+// The slow part happens without holding the lock; sessions already running
+// keep decoding with the model they started on, which is freed once the
+// last of them closes.
+func (w *whisperTranscriber) LoadModel(model string, progress ProgressFunc) error {
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	if w.current != nil && w.model == model {
+		w.mu.Unlock()
+		return nil
+	}
+	w.mu.Unlock()
 
-	if w.model != nil {
-		w.model.Close()
+	handle, err := w.open(w.registry, model, progress)
+	if err != nil {
+		return err
 	}
 
-	modelPath := filepath.Join(config.ModelsPath(), model+".bin")
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		handle.release()
+		return fmt.Errorf("transcriber is closed")
+	}
+	old := w.current
+	w.current = handle
+	w.model = model
+	w.loadedLocked(handle, true)
+	w.mu.Unlock()
+
+	if old != nil {
+		old.release()
+	}
 
-	newModel, err := whisper.New(modelPath)
-	if err != nil {
-		return fmt.Errorf("failed to load model: %w", err)
+	log.Info().Str("model", model).Str("path", handle.path).Msg("Whisper model loaded")
+	return nil
+}
+
+// LoadPartialModel swaps the two-pass partials model the same way LoadModel
+// swaps the main one
+func (w *whisperTranscriber) LoadPartialModel(model string, progress ProgressFunc) error {
+	handle, changed, err := w.swapSmall(&w.partial, model, progress)
+	if err != nil || !changed {
+		return err
+	}
+	if handle == nil {
+		log.Info().Msg("Two-pass transcription off")
+	} else {
+		log.Info().Str("model", model).Str("path", handle.path).Msg("Partials model loaded")
 	}
+	return nil
+}
 
-	w.model = newModel
-	w.modelPath = modelPath
+func (w *whisperTranscriber) LoadWakeModel(model string, progress ProgressFunc) error {
+	handle, changed, err := w.swapSmall(&w.wake, model, progress)
+	if err != nil || !changed {
+		return err
+	}
+	if handle == nil {
+		log.Info().Msg("Wake model unloaded")
+	} else {
+		log.Info().Str("model", model).Str("path", handle.path).Msg("Wake model loaded")
+	}
 	return nil
 }
 
+// swapSmall loads model into slot, one of the small models kept loaded
+// beside the main one, freeing the one it replaces. It returns the new
+// handle, nil for "", and whether anything changed.
+func (w *whisperTranscriber) swapSmall(slot **modelHandle, model string, progress ProgressFunc) (*modelHandle, bool, error) {
+	w.mu.Lock()
+	unchanged := model == "" && *slot == nil || *slot != nil && (*slot).name == model
+	w.mu.Unlock()
+	if unchanged {
+		return nil, false, nil
+	}
+
+	var handle *modelHandle
+	if model != "" {
+		var err error
+		if handle, err = w.open(w.registry, model, progress); err != nil {
+			return nil, false, err
+		}
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		if handle != nil {
+			handle.release()
+		}
+		return nil, false, fmt.Errorf("transcriber is closed")
+	}
+	old := *slot
+	*slot = handle
+	if handle != nil && w.warmup {
+		w.beginUseLocked()
+		go w.warmUp(handle.acquire())
+	}
+	w.mu.Unlock()
+
+	if old != nil {
+		old.release()
+	}
+	return handle, true, nil
+}
+
+func (w *whisperTranscriber) Transcribe(model string, samples []float32, opts SessionOpts, progress ProgressFunc) ([]Segment, error) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil, fmt.Errorf("transcriber is closed")
+	}
+	// Counts as use so the idle timer can't unload the model mid-decode
+	w.beginUseLocked()
+	defer w.endUse()
+
+	var load *pendingLoad
+	switch {
+	case w.model == model && w.current != nil:
+		load = loadedHandle(w.current.acquire())
+	case w.model == model:
+		// The main model was unloaded while idle; bring it back for
+		// sessions too rather than loading a copy just for this call
+		load = w.reloadLocked()
+		load.waiters++
+	case w.partial != nil && w.partial.name == model:
+		load = loadedHandle(w.partial.acquire())
+	case w.wake != nil && w.wake.name == model:
+		load = loadedHandle(w.wake.acquire())
+	case w.oneOff != nil && w.oneOff.name == model:
+		load = loadedHandle(w.oneOff.acquire())
+	}
+	w.mu.Unlock()
+
+	var handle *modelHandle
+	if load != nil {
+		var err error
+		if handle, err = load.wait(); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if handle, err = w.openOneOff(model, progress); err != nil {
+			return nil, err
+		}
+	}
+	defer handle.release()
+
+	return handle.decode(samples, opts)
+}
+
+// openOneOff loads a model for Transcribe and keeps it as the one-off model,
+// so redoing dictation after dictation doesn't reload it every time. It
+// returns a reference for the caller.
+func (w *whisperTranscriber) openOneOff(model string, progress ProgressFunc) (*modelHandle, error) {
+	log.Info().Str("model", model).Msg("Loading model for one-off transcription")
+	handle, err := w.open(w.registry, model, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		// Ours is the only reference; the caller's decode frees it
+		w.mu.Unlock()
+		return handle, nil
+	}
+	old := w.oneOff
+	w.oneOff = handle.acquire()
+	w.mu.Unlock()
+
+	if old != nil {
+		old.release()
+	}
+	return handle, nil
+}
+
 func (w *whisperTranscriber) Close() error {
 	w.mu.Lock()
-	defer w.mu.Unlock()
+	old, partial, wake, oneOff := w.current, w.partial, w.wake, w.oneOff
+	w.current, w.partial, w.wake, w.oneOff = nil, nil, nil, nil
+	w.closed = true
+	if w.idle != nil {
+		w.idle.Stop()
+	}
+	w.mu.Unlock()
 
-	if w.model != nil {
-		w.model.Close()
-		w.model = nil
+	for _, h := range []*modelHandle{old, partial, wake, oneOff} {
+		if h != nil {
+			h.release()
+		}
 	}
 	return nil
 }
 
+// reloadLocked starts loading the selected model again after an idle unload,
+// or joins a reload that is already under way
+func (w *whisperTranscriber) reloadLocked() *pendingLoad {
+	if w.loading != nil {
+		return w.loading
+	}
+
+	p := &pendingLoad{name: w.model, done: make(chan struct{})}
+	w.loading = p
+	log.Info().Str("model", p.name).Msg("Reloading idle whisper model")
+	go w.finishReload(p)
+	return p
+}
+
+func (w *whisperTranscriber) finishReload(p *pendingLoad) {
+	start := time.Now()
+	handle, err := w.open(w.registry, p.name, nil)
+
+	w.mu.Lock()
+	w.loading = nil
+	if err != nil {
+		p.err = err
+		close(p.done)
+		w.mu.Unlock()
+		log.Error().Err(err).Str("model", p.name).Msg("Failed to reload whisper model")
+		return
+	}
+
+	// Every waiting session gets its own reference; ours becomes the
+	// transcriber's unless the model was swapped or closed meanwhile
+	handle.refs.Add(int32(p.waiters))
+	p.handle = handle
+	close(p.done)
+
+	keep := !w.closed && w.current == nil && w.model == p.name
+	if keep {
+		w.current = handle
+		// A waiting session's first decode warms the model anyway
+		w.loadedLocked(handle, p.waiters == 0)
+	}
+	w.mu.Unlock()
+
+	if !keep {
+		handle.release()
+		return
+	}
+	log.Info().Str("model", p.name).Dur("took", time.Since(start)).Msg("Whisper model reloaded")
+}
+
+// loadedLocked runs the optional warm-up for a freshly loaded model and arms
+// the idle timer
+func (w *whisperTranscriber) loadedLocked(h *modelHandle, warm bool) {
+	if w.warmup && warm {
+		w.beginUseLocked()
+		go w.warmUp(h.acquire())
+	}
+	w.lastUsed = time.Now()
+	w.armIdleLocked()
+}
+
+func (w *whisperTranscriber) warmUp(h *modelHandle) {
+	defer w.endUse()
+	defer h.release()
+
+	start := time.Now()
+	if _, err := h.decode(make([]float32, warmupSamples), SessionOpts{Threads: w.threads}); err != nil {
+		log.Warn().Err(err).Str("model", h.name).Msg("Model warm-up failed")
+		return
+	}
+	log.Debug().Str("model", h.name).Dur("took", time.Since(start)).Msg("Model warmed up")
+}
+
+// armIdleLocked (re)starts the idle countdown when nothing is using the model
+func (w *whisperTranscriber) armIdleLocked() {
+	if w.idleTimeout <= 0 || w.active > 0 || w.current == nil && w.oneOff == nil || w.closed {
+		return
+	}
+	if w.idle == nil {
+		w.idle = time.AfterFunc(w.idleTimeout, w.unloadIdle)
+		return
+	}
+	w.idle.Reset(w.idleTimeout)
+}
+
+// beginUseLocked counts a session or decode as using the model, holding off
+// the idle timer until endUse
+func (w *whisperTranscriber) beginUseLocked() {
+	w.active++
+	if w.idle != nil {
+		w.idle.Stop()
+	}
+}
+
+func (w *whisperTranscriber) endUse() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.active--
+	w.lastUsed = time.Now()
+	w.armIdleLocked()
+}
+
+// unloadIdle frees the model after idleTimeout without dictation or any
+// other decode. Sessions still decoding hold their own reference, so this
+// never pulls the model out from under them.
+func (w *whisperTranscriber) unloadIdle() {
+	w.mu.Lock()
+	// A timer that fired just as a session started or was re-armed is stale
+	if w.active > 0 || w.current == nil && w.oneOff == nil || w.closed || time.Since(w.lastUsed) < w.idleTimeout {
+		w.mu.Unlock()
+		return
+	}
+	old, oneOff := w.current, w.oneOff
+	w.current, w.oneOff = nil, nil
+	w.mu.Unlock()
+
+	for _, h := range []*modelHandle{old, oneOff} {
+		if h != nil {
+			log.Info().Str("model", h.name).Dur("idle", w.idleTimeout).Msg("Unloading idle whisper model")
+			h.release()
+		}
+	}
+}
+
 // ===== SESSION =====
 
 type whisperSession struct {
-	transcriber *whisperTranscriber
-	opts        SessionOpts
+	load    *pendingLoad
+	opts    SessionOpts
+	onClose func()
+
+	// partial, when set, switches the session to two-pass: it decodes the
+	// recent audio for partials as it arrives, and the whole utterance is
+	// decoded by the main model once on Close
+	partial *modelHandle
 
 	mu         sync.Mutex
 	samples    []float32
+	partialAt  int // len(samples) at the last partial decode
 	partials   chan string
-	finals     chan string
-	done       chan struct{}
-	processing bool
+	finals     chan Segment
+	processing bool // a decode spawned by Feed is running
+	closed     bool
+
+	// decodes tracks the goroutines Feed spawns, which Close waits for
+	// before closing the channels they send on
+	decodes sync.WaitGroup
 }
 
+// partialWindow bounds the audio re-decoded for each partial so their cost
+// stays flat however long the utterance runs
+const partialWindow = 16000 * 30
+
 func (s *whisperSession) Feed(samples []float32) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.closed {
+		return fmt.Errorf("session is closed")
+	}
+
 	// Append to buffer
 	s.samples = append(s.samples, samples...)
 
+	if s.partial != nil {
+		// Two-pass: keep everything for the final decode, refreshing the
+		// partial every second of new audio
+		if len(s.samples)-s.partialAt >= 16000 && !s.processing {
+			s.spawnLocked(s.processPartial)
+		}
+		return nil
+	}
+
 	// Process when we have enough audio (1 second chunks)
 	if len(s.samples) >= 16000 && !s.processing {
-		go s.processChunk()
+		s.spawnLocked(func() {
+			if err := s.processChunk(); err != nil {
+				log.Error().Err(err).Msg("Chunk decode failed")
+			}
+		})
 	}
 
 	return nil
 }
 
-func (s *whisperSession) processChunk() error {
+// spawnLocked runs decode in the background, one at a time. It's marked
+// as running before the goroutine starts, so Close can't miss it.
+func (s *whisperSession) spawnLocked(decode func()) {
+	s.processing = true
+	s.decodes.Add(1)
+	go func() {
+		defer s.decodes.Done()
+		defer func() {
+			s.mu.Lock()
+			s.processing = false
+			s.mu.Unlock()
+		}()
+		decode()
+	}()
+}
+
+// processPartial decodes the trailing window of the utterance with the
+// partials model. Partials are advisory, so one is dropped rather than
+// blocking if the reader falls behind.
+func (s *whisperSession) processPartial() {
 	s.mu.Lock()
-	if s.processing {
+	s.partialAt = len(s.samples)
+	window := s.samples[max(0, len(s.samples)-partialWindow):]
+	samplesToProcess := make([]float32, len(window))
+	copy(samplesToProcess, window)
+	s.mu.Unlock()
+
+	start := time.Now()
+	segments, err := s.partial.decode(samplesToProcess, s.opts)
+	if err != nil {
+		log.Debug().Err(err).Msg("Partial decode failed")
+		return
+	}
+
+	texts := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		texts = append(texts, strings.TrimSpace(seg.Text))
+	}
+	text := strings.Join(texts, " ")
+	log.Debug().
+		Str("model", s.partial.name).
+		Dur("process_time", time.Since(start)).
+		Str("text", text).
+		Msg("Partial transcription")
+
+	select {
+	case s.partials <- text:
+	default:
+	}
+}
+
+// processChunk decodes everything buffered with the main model. Only one
+// runs at a time: either spawned by Feed or, once those are done, from Close.
+func (s *whisperSession) processChunk() error {
+	// Audio keeps buffering while an unloaded model comes back
+	handle, err := s.load.wait()
+	if err != nil {
+		s.mu.Lock()
+		s.samples = s.samples[:0]
 		s.mu.Unlock()
-		return nil
+		return err
 	}
-	s.processing = true
 
+	s.mu.Lock()
 	// Copy samples to process
 	samplesToProcess := make([]float32, len(s.samples))
 	copy(samplesToProcess, s.samples)
@@ -168,32 +742,9 @@ func (s *whisperSession) processChunk() error {
 	start := time.Now()
 
 	// Process audio with whisper
-	model := s.transcriber.model
-
-	// Create context
-	context, err := model.NewContext()
+	segments, err := handle.decode(samplesToProcess, s.opts)
 	if err != nil {
-		s.mu.Lock()
-		s.processing = false
-		s.mu.Unlock()
-		return fmt.Errorf("failed to create context: %w", err)
-	}
-
-	// Set parameters
-	if s.opts.Threads > 0 {
-		context.SetThreads(uint(s.opts.Threads))
-	}
-	if s.opts.Language != "auto" && s.opts.Language != "" {
-		context.SetLanguage(s.opts.Language)
-	}
-	context.SetTranslate(false)
-
-	// Process the audio
-	if err := context.Process(samplesToProcess, nil, nil); err != nil {
-		s.mu.Lock()
-		s.processing = false
-		s.mu.Unlock()
-		return fmt.Errorf("whisper process failed: %w", err)
+		return err
 	}
 
 	processTime := time.Since(start)
@@ -202,33 +753,25 @@ func (s *whisperSession) processChunk() error {
 		Float64("realtime_factor", processTime.Seconds()/duration).
 		Msg("Whisper processing complete")
 
-	// Get transcription segments
+	// Send transcription segments
 	segmentCount := 0
-	for {
-		segment, err := context.NextSegment()
-		if err != nil {
-			break // EOF or error
-		}
-		text := segment.Text
+	for _, final := range segments {
 		segmentCount++
 
 		log.Debug().
-			Str("text", text).
+			Str("text", final.Text).
+			Float64("avg_logprob", final.AvgLogProb).
 			Int("segment", segmentCount).
 			Msg("Got transcription segment")
 
 		// Send as final (blocking send to ensure delivery)
-		s.finals <- text
+		s.finals <- final
 	}
 
 	log.Debug().
 		Int("segments", segmentCount).
 		Msg("Finished processing chunk")
 
-	s.mu.Lock()
-	s.processing = false
-	s.mu.Unlock()
-
 	return nil
 }
 
@@ -236,52 +779,41 @@ func (s *whisperSession) Partials() <-chan string {
 	return s.partials
 }
 
-func (s *whisperSession) Finals() <-chan string {
+func (s *whisperSession) Finals() <-chan Segment {
 	return s.finals
 }
 
 func (s *whisperSession) Close() error {
 	log.Debug().Msg("Closing whisper session")
 
-	// Signal done first
-	close(s.done)
-
-	// Wait for any ongoing processing to finish
+	// No more audio, so nothing new is spawned; wait out what was. Only
+	// the first Close does anything, so callers can also defer one.
 	s.mu.Lock()
-	waitCount := 0
-	for s.processing {
+	if s.closed {
 		s.mu.Unlock()
-		time.Sleep(10 * time.Millisecond)
-		waitCount++
-		if waitCount%100 == 0 {
-			log.Debug().Int("wait_ms", waitCount*10).Msg("Still waiting for processing to complete")
-		}
-		s.mu.Lock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+	// Even if a decode below panics the transcriber must stop counting the
+	// session, or it never unloads the model when idle
+	if s.onClose != nil {
+		defer s.onClose()
 	}
+	s.decodes.Wait()
 
-	hasRemaining := len(s.samples) > 0
+	s.mu.Lock()
 	remainingSamples := len(s.samples)
 	s.mu.Unlock()
 
 	// Process any remaining samples if we have them
-	if hasRemaining {
+	var decodeErr error
+	if remainingSamples > 0 {
 		log.Debug().Int("samples", remainingSamples).Msg("Processing remaining samples")
-		s.processChunk()
-	}
-
-	// Wait again to ensure final processChunk completes
-	s.mu.Lock()
-	waitCount = 0
-	for s.processing {
-		s.mu.Unlock()
-		time.Sleep(10 * time.Millisecond)
-		waitCount++
-		if waitCount%100 == 0 {
-			log.Debug().Int("wait_ms", waitCount*10).Msg("Still waiting for final processing to complete")
+		if decodeErr = s.processChunk(); decodeErr != nil {
+			log.Error().Err(decodeErr).Msg("Final decode failed")
 		}
-		s.mu.Lock()
 	}
-	s.mu.Unlock()
 
 	log.Debug().Msg("Closing channels")
 
@@ -289,6 +821,18 @@ func (s *whisperSession) Close() error {
 	close(s.partials)
 	close(s.finals)
 
+	// Drop our references; frees a model if it was swapped out meanwhile.
+	// A failed load is also what the final decode failed with, so it's
+	// only reported once.
+	handle, err := s.load.wait()
+	if err == nil {
+		handle.release()
+		err = decodeErr
+	}
+	if s.partial != nil {
+		s.partial.release()
+	}
+
 	log.Debug().Msg("Session closed")
-	return nil
-}
\ No newline at end of file
+	return err
+}